@@ -1,108 +1,21 @@
 package main
 
 import (
-	"context"
 	"log"
-	"sync"
 	"time"
 
-	"github.com/coreos/etcd/mvcc/mvccpb"
-	"go.etcd.io/etcd/clientv3"
+	"rpcimpl/rpcserver/discover"
 	"rpcimpl/rpcserver/discover/path"
 )
 
-//ServiceDiscovery 服务发现
-type ServiceDiscovery struct {
-	cli        *clientv3.Client  //etcd client
-	serverList map[string]string //服务列表
-	lock       sync.Mutex
-}
-
-//NewServiceDiscovery  新建发现服务
-func NewServiceDiscovery(endpoints []string) *ServiceDiscovery {
-	cli, err := clientv3.New(clientv3.Config{
-		Endpoints:   endpoints,
-		DialTimeout: 5 * time.Second,
-	})
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	return &ServiceDiscovery{
-		cli:        cli,
-		serverList: make(map[string]string),
-	}
-}
-
-//WatchService 初始化服务列表和监视
-func (s *ServiceDiscovery) WatchService(prefix string) error {
-	//根据前缀获取现有的key
-	resp, err := s.cli.Get(context.Background(), prefix, clientv3.WithPrefix())
-	if err != nil {
-		return err
-	}
-
-	for _, ev := range resp.Kvs {
-		s.SetServiceList(string(ev.Key), string(ev.Value))
-	}
-
-	//监视前缀，修改变更的server
-	go s.watcher(prefix)
-	return nil
-}
-
-//watcher 监听前缀
-func (s *ServiceDiscovery) watcher(prefix string) {
-	rch := s.cli.Watch(context.Background(), prefix, clientv3.WithPrefix())
-	log.Printf("watching prefix:%s now...", prefix)
-	for wresp := range rch {
-		for _, ev := range wresp.Events {
-			switch ev.Type {
-			case mvccpb.PUT: //修改或者新增
-				s.SetServiceList(string(ev.Kv.Key), string(ev.Kv.Value))
-			case mvccpb.DELETE: //删除
-				s.DelServiceList(string(ev.Kv.Key))
-			}
-		}
-	}
-}
-
-//SetServiceList 新增服务地址
-func (s *ServiceDiscovery) SetServiceList(key, val string) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-	s.serverList[key] = string(val)
-	log.Println("put key :", key, "val:", val)
-}
-
-//DelServiceList 删除服务地址
-func (s *ServiceDiscovery) DelServiceList(key string) {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-	delete(s.serverList, key)
-	log.Println("del key:", key)
-}
-
-//GetServices 获取服务地址
-func (s *ServiceDiscovery) GetServices() []string {
-	s.lock.Lock()
-	defer s.lock.Unlock()
-	addrs := make([]string, 0)
-
-	for _, v := range s.serverList {
-		addrs = append(addrs, v)
-	}
-	return addrs
-}
-
-//Close 关闭服务
-func (s *ServiceDiscovery) Close() error {
-	return s.cli.Close()
-}
-
 func main() {
 	var endpoints = []string{"localhost:2379"}
-	ser := NewServiceDiscovery(endpoints)
+	reg, err := discover.NewEtcdRegistry(endpoints)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer reg.Close()
+	ser := discover.NewServiceDiscovery(reg)
 	defer ser.Close()
 
 	var service = path.DefaultDiscoverPath{
@@ -110,11 +23,13 @@ func main() {
 		Version:     "1.0.0",
 		ServiceName: "gamex",
 	}
-	ser.WatchService(service.GetPath())
+	if err := ser.WatchService(service.GetPath()); err != nil {
+		log.Fatalln(err)
+	}
 	for {
 		select {
 		case <-time.Tick(10 * time.Second):
-			log.Println(ser.GetServices())
+			log.Println(ser.GetInstances())
 		}
 	}
 }
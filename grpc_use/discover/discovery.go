@@ -0,0 +1,185 @@
+package discover
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+//ServiceDiscovery 服务发现
+type ServiceDiscovery struct {
+	reg        Registry          //注册中心
+	serverList map[string]string //服务列表
+	lock       sync.Mutex
+	onChange   func(map[string]string) //服务列表变更回调, lock 保护
+	notify     sync.Mutex              //按变更的顺序依次回调
+	cancel     context.CancelFunc
+}
+
+//NewServiceDiscovery  新建发现服务, Close 不关闭 reg
+func NewServiceDiscovery(reg Registry) *ServiceDiscovery {
+	return &ServiceDiscovery{
+		reg:        reg,
+		serverList: make(map[string]string),
+	}
+}
+
+//OnChange 设置服务列表变更回调, 参数为服务列表的拷贝, 回调依次调用, 不会并发
+func (s *ServiceDiscovery) OnChange(f func(map[string]string)) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.onChange = f
+}
+
+//WatchService 初始化服务列表和监视
+func (s *ServiceDiscovery) WatchService(prefix string) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := s.reg.Watch(ctx, prefix)
+	if err != nil {
+		cancel()
+		return err
+	}
+	s.cancel = cancel
+
+	//第一批为现有的服务列表
+	s.apply(<-ch, true)
+	log.Printf("watching prefix:%s now...", prefix)
+	go s.watcher(ctx, prefix, ch)
+	return nil
+}
+
+//watcher 监听前缀, chan 因 watch 出错关闭时(如版本被压缩, 连接丢失)以退避重新监视
+func (s *ServiceDiscovery) watcher(ctx context.Context, prefix string, ch <-chan []Event) {
+	for {
+		for evs := range ch {
+			s.apply(evs, false)
+		}
+		if ctx.Err() != nil {
+			return
+		}
+		log.Printf("watch prefix:%s closed, rewatching", prefix)
+		if ch = s.rewatch(ctx, prefix); ch == nil {
+			return
+		}
+		//重新监视的第一批为当前服务列表, 替换掉期间可能已删除的服务
+		select {
+		case evs, ok := <-ch:
+			if ok {
+				s.apply(evs, true)
+			}
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+//rewatch 以指数退避重新监视, ctx 结束或注册中心关闭时返回 nil
+func (s *ServiceDiscovery) rewatch(ctx context.Context, prefix string) <-chan []Event {
+	var backoff = minBackoff
+	for {
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil
+		}
+		ch, err := s.reg.Watch(ctx, prefix)
+		if err == nil {
+			return ch
+		}
+		if errors.Is(err, ErrClosed) || ctx.Err() != nil {
+			return nil
+		}
+		log.Printf("rewatch prefix:%s err:%v retry in %v", prefix, err, backoff)
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+//apply 应用一批变更, 通知一次, reset 时 evs 为完整的服务列表
+//通知的服务列表与变更在同一临界区内生成, notify 保证回调顺序与变更顺序一致
+func (s *ServiceDiscovery) apply(evs []Event, reset bool) {
+	s.notify.Lock()
+	defer s.notify.Unlock()
+	s.lock.Lock()
+	if reset {
+		s.serverList = make(map[string]string, len(evs))
+	}
+	for _, ev := range evs {
+		switch ev.Type {
+		case EventPut: //修改或者新增
+			s.serverList[ev.Key] = ev.Value
+			log.Println("put key :", ev.Key, "val:", ev.Value)
+		case EventDelete: //删除
+			delete(s.serverList, ev.Key)
+			log.Println("del key:", ev.Key)
+		}
+	}
+	var onChange, list = s.onChange, s.snapshot()
+	s.lock.Unlock()
+	if onChange != nil {
+		onChange(list)
+	}
+}
+
+//SetServiceList 新增服务地址
+func (s *ServiceDiscovery) SetServiceList(key, val string) {
+	s.apply([]Event{{Type: EventPut, Key: key, Value: val}}, false)
+}
+
+//DelServiceList 删除服务地址
+func (s *ServiceDiscovery) DelServiceList(key string) {
+	s.apply([]Event{{Type: EventDelete, Key: key}}, false)
+}
+
+//snapshot 服务列表的拷贝, 需持有锁
+func (s *ServiceDiscovery) snapshot() map[string]string {
+	var list = make(map[string]string, len(s.serverList))
+	for k, v := range s.serverList {
+		list[k] = v
+	}
+	return list
+}
+
+//GetServices 获取服务地址
+func (s *ServiceDiscovery) GetServices() []string {
+	var ins = s.GetInstances()
+	addrs := make([]string, 0, len(ins))
+	for _, i := range ins {
+		addrs = append(addrs, i.Addr)
+	}
+	return addrs
+}
+
+//GetInstances 获取服务实例, 无法解析的 value 被忽略
+func (s *ServiceDiscovery) GetInstances() []Instance {
+	return s.Select(Selector{})
+}
+
+//Select 获取被 sel 选择的服务实例
+func (s *ServiceDiscovery) Select(sel Selector) []Instance {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	ins := make([]Instance, 0, len(s.serverList))
+	for k, v := range s.serverList {
+		i, err := ParseInstance(v)
+		if err != nil {
+			log.Printf("parse instance key:%s err:%v", k, err)
+			continue
+		}
+		if sel.Match(i) {
+			ins = append(ins, i)
+		}
+	}
+	return ins
+}
+
+//Close 停止监视
+func (s *ServiceDiscovery) Close() error {
+	if s.cancel != nil {
+		s.cancel()
+	}
+	return nil
+}
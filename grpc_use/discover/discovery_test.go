@@ -0,0 +1,135 @@
+package discover
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// fastBackoff shortens the backoff of re-registering and re-watching for the test.
+func fastBackoff(t *testing.T) {
+	var min, max = minBackoff, maxBackoff
+	minBackoff, maxBackoff = 10*time.Millisecond, 50*time.Millisecond
+	t.Cleanup(func() {
+		minBackoff, maxBackoff = min, max
+	})
+}
+
+// eventually polls f until it is true or fails the test.
+func eventually(t *testing.T, what string, f func() bool) {
+	t.Helper()
+	var deadline = time.Now().Add(waitTimeout)
+	for !f() {
+		if time.Now().After(deadline) {
+			t.Fatalf("%s not in %v", what, waitTimeout)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestServiceDiscoveryApply(t *testing.T) {
+	var sd = NewServiceDiscovery(NewMemoryRegistry())
+	var lists []map[string]string
+	sd.OnChange(func(list map[string]string) {
+		lists = append(lists, list)
+	})
+
+	sd.apply([]Event{
+		{Type: EventPut, Key: "/svc/a", Value: "127.0.0.1:1"},
+		{Type: EventPut, Key: "/svc/b", Value: `{"id":"b","addr":"127.0.0.1:2","weight":3}`},
+		{Type: EventPut, Key: "/svc/c", Value: "{bad"},
+	}, false)
+	sd.apply([]Event{
+		{Type: EventDelete, Key: "/svc/a"},
+		{Type: EventPut, Key: "/svc/d", Value: "127.0.0.1:4"},
+	}, false)
+
+	var addrs = sd.GetServices()
+	sort.Strings(addrs)
+	if want := []string{"127.0.0.1:2", "127.0.0.1:4"}; !reflect.DeepEqual(addrs, want) {
+		t.Fatalf("services %v want %v", addrs, want)
+	}
+
+	//每批通知一次, 参数为当时的服务列表的拷贝
+	if len(lists) != 2 {
+		t.Fatalf("notified %d times want 2", len(lists))
+	}
+	if _, ok := lists[0]["/svc/a"]; !ok || len(lists[0]) != 3 {
+		t.Fatalf("first list %v", lists[0])
+	}
+	lists[1]["/svc/x"] = "changed"
+	if len(sd.GetInstances()) != 2 {
+		t.Fatalf("list changed by the callback")
+	}
+
+	//reset 替换整个服务列表
+	sd.apply([]Event{{Type: EventPut, Key: "/svc/e", Value: "127.0.0.1:5"}}, true)
+	if want := map[string]string{"/svc/e": "127.0.0.1:5"}; !reflect.DeepEqual(lists[2], want) {
+		t.Fatalf("reset list %v want %v", lists[2], want)
+	}
+}
+
+func TestServiceDiscoveryWatch(t *testing.T) {
+	var reg = NewMemoryRegistry()
+	defer reg.Close()
+	var ctx = context.Background()
+	if _, err := reg.Register(ctx, "/svc/a", "127.0.0.1:1", 5); err != nil {
+		t.Fatalf("register err %v", err)
+	}
+
+	var sd = NewServiceDiscovery(reg)
+	defer sd.Close()
+	if err := sd.WatchService("/svc/"); err != nil {
+		t.Fatalf("watch service err %v", err)
+	}
+	if addrs := sd.GetServices(); !reflect.DeepEqual(addrs, []string{"127.0.0.1:1"}) {
+		t.Fatalf("services %v after watch", addrs)
+	}
+	if _, err := reg.Register(ctx, "/svc/b", "127.0.0.1:2", 5); err != nil {
+		t.Fatalf("register err %v", err)
+	}
+	if err := reg.Deregister(ctx, "/svc/a"); err != nil {
+		t.Fatalf("deregister err %v", err)
+	}
+	eventually(t, "watched changes", func() bool {
+		return reflect.DeepEqual(sd.GetServices(), []string{"127.0.0.1:2"})
+	})
+}
+
+func TestServiceRegisterReregister(t *testing.T) {
+	fastBackoff(t)
+	var reg = NewMemoryRegistry()
+	defer reg.Close()
+	var ctx = context.Background()
+
+	ser, err := NewServiceRegister(reg, "/svc/a", "127.0.0.1:1", 5)
+	if err != nil {
+		t.Fatalf("new service register err %v", err)
+	}
+	if !ser.Healthy() {
+		t.Fatalf("not healthy after register")
+	}
+
+	//不是注册者自己的注销模拟租约丢失
+	if err := reg.Deregister(ctx, "/svc/a"); err != nil {
+		t.Fatalf("deregister err %v", err)
+	}
+	eventually(t, "re-registered", func() bool {
+		list, _ := reg.List(ctx, "/svc/")
+		return list["/svc/a"] == "127.0.0.1:1" && ser.Healthy()
+	})
+
+	if err := ser.Close(); err != nil {
+		t.Fatalf("close err %v", err)
+	}
+	if ser.Healthy() {
+		t.Fatalf("healthy after close")
+	}
+	for range ser.Health() {
+	}
+	if list, _ := reg.List(ctx, "/svc/"); len(list) != 0 {
+		t.Fatalf("list %v after close", list)
+	}
+}
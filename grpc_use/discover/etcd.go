@@ -0,0 +1,212 @@
+package discover
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/coreos/etcd/mvcc/mvccpb"
+	"go.etcd.io/etcd/clientv3"
+)
+
+//revokeTimeout 撤销租约的超时
+const revokeTimeout = 5 * time.Second
+
+//etcdRegistry etcd 注册中心, 每个 key 绑定一个租约
+type etcdRegistry struct {
+	cli    *clientv3.Client //etcd client
+	ownCli bool             //Close 时是否关闭 cli
+	lock   sync.Mutex
+	leases map[string]*etcdLease
+	closed bool
+}
+
+//etcdLease 注册 key 的租约
+type etcdLease struct {
+	id     clientv3.LeaseID //租约ID
+	cancel context.CancelFunc
+	done   chan struct{} //续租结束时关闭
+}
+
+//NewEtcdRegistry 连接 etcd 新建注册中心
+func NewEtcdRegistry(endpoints []string) (Registry, error) {
+	cli, err := clientv3.New(clientv3.Config{
+		Endpoints:   endpoints,
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		return nil, err
+	}
+	var r = newEtcdRegistry(cli)
+	r.ownCli = true
+	return r, nil
+}
+
+//NewEtcdRegistryWithClient 使用已有的 client 新建注册中心, Close 不关闭 cli
+func NewEtcdRegistryWithClient(cli *clientv3.Client) Registry {
+	return newEtcdRegistry(cli)
+}
+
+func newEtcdRegistry(cli *clientv3.Client) *etcdRegistry {
+	return &etcdRegistry{cli: cli, leases: make(map[string]*etcdLease)}
+}
+
+//Register 的 etcd 请求不持有锁, 只在替换 leases[key] 时加锁
+func (r *etcdRegistry) Register(ctx context.Context, key, val string, ttl int64) (<-chan struct{}, error) {
+	r.lock.Lock()
+	var closed = r.closed
+	r.lock.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+
+	//设置租约时间
+	resp, err := r.cli.Grant(ctx, ttl)
+	if err != nil {
+		return nil, err
+	}
+	//注册服务并绑定租约
+	if _, err = r.cli.Put(ctx, key, val, clientv3.WithLease(resp.ID)); err != nil {
+		r.revoke(resp.ID)
+		return nil, err
+	}
+	//设置续租 定期发送需求请求
+	kctx, cancel := context.WithCancel(context.Background())
+	ch, err := r.cli.KeepAlive(kctx, resp.ID)
+	if err != nil {
+		cancel()
+		r.revoke(resp.ID)
+		return nil, err
+	}
+	var l = &etcdLease{id: resp.ID, cancel: cancel, done: make(chan struct{})}
+
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		cancel()
+		r.revoke(resp.ID)
+		return nil, ErrClosed
+	}
+	var old = r.leases[key]
+	r.leases[key] = l
+	r.lock.Unlock()
+	if old != nil {
+		//重复注册时撤销旧租约, key 已绑定新租约不会被删除
+		old.cancel()
+		r.revoke(old.id)
+	}
+
+	//租约过期或续租被取消时 ch 关闭
+	go func() {
+		for range ch {
+		}
+		log.Printf("关闭续租 key:%s", key)
+		r.lock.Lock()
+		if r.leases[key] == l {
+			delete(r.leases, key)
+		}
+		r.lock.Unlock()
+		close(l.done)
+	}()
+	log.Printf("Put key:%s  val:%s  success!", key, val)
+	return l.done, nil
+}
+
+//revoke 撤销租约, 失败时只记录, 租约到期后 etcd 自行删除
+func (r *etcdRegistry) revoke(id clientv3.LeaseID) {
+	ctx, cancel := context.WithTimeout(context.Background(), revokeTimeout)
+	defer cancel()
+	if _, err := r.cli.Revoke(ctx, id); err != nil {
+		log.Printf("revoke lease:%x err:%v", id, err)
+	}
+}
+
+func (r *etcdRegistry) Deregister(ctx context.Context, key string) error {
+	r.lock.Lock()
+	var l, ok = r.leases[key]
+	delete(r.leases, key)
+	r.lock.Unlock()
+	if !ok {
+		_, err := r.cli.Delete(ctx, key)
+		return err
+	}
+	//撤销租约
+	l.cancel()
+	_, err := r.cli.Revoke(ctx, l.id)
+	return err
+}
+
+func (r *etcdRegistry) List(ctx context.Context, prefix string) (map[string]string, error) {
+	resp, err := r.cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var kvs = make(map[string]string, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		kvs[string(kv.Key)] = string(kv.Value)
+	}
+	return kvs, nil
+}
+
+func (r *etcdRegistry) Watch(ctx context.Context, prefix string) (<-chan []Event, error) {
+	//根据前缀获取现有的key
+	resp, err := r.cli.Get(ctx, prefix, clientv3.WithPrefix())
+	if err != nil {
+		return nil, err
+	}
+	var first = make([]Event, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		first = append(first, Event{Type: EventPut, Key: string(kv.Key), Value: string(kv.Value)})
+	}
+
+	//从 Get 之后的版本开始监视, 不漏掉中间的变更
+	rch := r.cli.Watch(ctx, prefix, clientv3.WithPrefix(), clientv3.WithRev(resp.Header.Revision+1))
+	var out = make(chan []Event, 1)
+	out <- first
+	go func() {
+		defer close(out)
+		for wresp := range rch {
+			if err := wresp.Err(); err != nil {
+				log.Printf("watch prefix:%s err:%v", prefix, err)
+				return
+			}
+			var evs = make([]Event, 0, len(wresp.Events))
+			for _, ev := range wresp.Events {
+				switch ev.Type {
+				case mvccpb.PUT:
+					evs = append(evs, Event{Type: EventPut, Key: string(ev.Kv.Key), Value: string(ev.Kv.Value)})
+				case mvccpb.DELETE:
+					evs = append(evs, Event{Type: EventDelete, Key: string(ev.Kv.Key)})
+				}
+			}
+			select {
+			case out <- evs:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+func (r *etcdRegistry) Close() error {
+	r.lock.Lock()
+	if r.closed {
+		r.lock.Unlock()
+		return nil
+	}
+	r.closed = true
+	var leases = r.leases
+	r.leases = nil
+	r.lock.Unlock()
+
+	for _, l := range leases {
+		l.cancel()
+		r.revoke(l.id)
+	}
+	if !r.ownCli {
+		return nil
+	}
+	return r.cli.Close()
+}
@@ -0,0 +1,215 @@
+package discover
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+//fileRegistry 以 json 文件保存服务列表的注册中心, 轮询文件实现监视, ttl 被忽略
+//同一文件可被多个进程监视, 写入只在进程内互斥
+type fileRegistry struct {
+	path     string
+	interval time.Duration //轮询间隔
+	lock     sync.Mutex
+	keys     map[string]chan struct{} //本 registry 注册的 key, 注册结束时关闭
+	watchers map[*watcher]struct{}
+	closed   bool
+}
+
+//NewFileRegistry 新建文件注册中心, interval 为监视的轮询间隔, 不大于 0 时为 1 秒
+func NewFileRegistry(path string, interval time.Duration) Registry {
+	if interval <= 0 {
+		interval = time.Second
+	}
+	return &fileRegistry{
+		path:     path,
+		interval: interval,
+		keys:     make(map[string]chan struct{}),
+		watchers: make(map[*watcher]struct{}),
+	}
+}
+
+//load 读取服务列表, 文件不存在时为空
+func (r *fileRegistry) load() (map[string]string, error) {
+	var kvs = make(map[string]string)
+	b, err := ioutil.ReadFile(r.path)
+	if os.IsNotExist(err) {
+		return kvs, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(b) == 0 {
+		return kvs, nil
+	}
+	if err := json.Unmarshal(b, &kvs); err != nil {
+		return nil, err
+	}
+	return kvs, nil
+}
+
+//save 先写临时文件再改名, 监视者不会读到写了一半的文件
+func (r *fileRegistry) save(kvs map[string]string) error {
+	b, err := json.MarshalIndent(kvs, "", "\t")
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(r.path), filepath.Base(r.path)+".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), r.path)
+}
+
+//update 读取, 修改并保存服务列表, 需持有锁
+func (r *fileRegistry) update(f func(kvs map[string]string)) error {
+	kvs, err := r.load()
+	if err != nil {
+		return err
+	}
+	f(kvs)
+	return r.save(kvs)
+}
+
+func (r *fileRegistry) Register(_ context.Context, key, val string, _ int64) (<-chan struct{}, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil, ErrClosed
+	}
+	if err := r.update(func(kvs map[string]string) { kvs[key] = val }); err != nil {
+		return nil, err
+	}
+	r.end(key)
+	var done = make(chan struct{})
+	r.keys[key] = done
+	return done, nil
+}
+
+//end 结束 key 的注册, 需持有锁
+func (r *fileRegistry) end(key string) {
+	if done, ok := r.keys[key]; ok {
+		close(done)
+		delete(r.keys, key)
+	}
+}
+
+func (r *fileRegistry) Deregister(_ context.Context, key string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	r.end(key)
+	return r.update(func(kvs map[string]string) { delete(kvs, key) })
+}
+
+func (r *fileRegistry) List(_ context.Context, prefix string) (map[string]string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	kvs, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	var list = make(map[string]string)
+	for _, ev := range snapshot(kvs, prefix) {
+		list[ev.Key] = ev.Value
+	}
+	return list, nil
+}
+
+func (r *fileRegistry) Watch(ctx context.Context, prefix string) (<-chan []Event, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil, ErrClosed
+	}
+	last, err := r.load()
+	if err != nil {
+		return nil, err
+	}
+	var w = newWatcher(prefix, snapshot(last, prefix))
+	r.watchers[w] = struct{}{}
+	go w.run(ctx)
+	go func() {
+		defer func() {
+			r.lock.Lock()
+			delete(r.watchers, w)
+			r.lock.Unlock()
+		}()
+		var tick = time.NewTicker(r.interval)
+		defer tick.Stop()
+		for {
+			select {
+			case <-tick.C:
+			case <-ctx.Done():
+				return
+			case <-w.done:
+				return
+			}
+			kvs, err := r.load()
+			if err != nil {
+				log.Printf("watch file:%s err:%v", r.path, err)
+				continue
+			}
+			w.push(diff(last, kvs)...)
+			last = kvs
+		}
+	}()
+	return w.out, nil
+}
+
+//diff 返回从 old 到 cur 的变更
+func diff(old, cur map[string]string) []Event {
+	var evs []Event
+	for k, v := range cur {
+		if o, ok := old[k]; !ok || o != v {
+			evs = append(evs, Event{Type: EventPut, Key: k, Value: v})
+		}
+	}
+	for k := range old {
+		if _, ok := cur[k]; !ok {
+			evs = append(evs, Event{Type: EventDelete, Key: k})
+		}
+	}
+	return evs
+}
+
+func (r *fileRegistry) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	for w := range r.watchers {
+		w.stop()
+	}
+	if len(r.keys) == 0 {
+		return nil
+	}
+	var err = r.update(func(kvs map[string]string) {
+		for k := range r.keys {
+			delete(kvs, k)
+		}
+	})
+	for k := range r.keys {
+		r.end(k)
+	}
+	return err
+}
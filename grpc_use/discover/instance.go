@@ -0,0 +1,62 @@
+package discover
+
+import (
+	"encoding/json"
+	"strings"
+
+	"rpcimpl/rpcserver/discover/path"
+)
+
+//Instance 注册的服务实例, 作为 value 以 json 保存在服务路径下以 ID 结尾的 key
+//旧的纯地址 value 以地址为 ID, 按权重 1 读取
+type Instance struct {
+	ID       string            `json:"id"`
+	Addr     string            `json:"addr"`
+	Weight   int               `json:"weight,omitempty"`
+	Zone     string            `json:"zone,omitempty"`
+	Version  string            `json:"version,omitempty"` //实例的版本, 用于金丝雀等按版本选择
+	Tags     []string          `json:"tags,omitempty"`
+	Metadata map[string]string `json:"metadata,omitempty"`
+}
+
+//ParseInstance 解析注册的 value
+func ParseInstance(val string) (Instance, error) {
+	var ins Instance
+	if !strings.HasPrefix(strings.TrimSpace(val), "{") {
+		ins.Addr = strings.TrimSpace(val)
+	} else if err := json.Unmarshal([]byte(val), &ins); err != nil {
+		return ins, err
+	}
+	if ins.ID == "" {
+		ins.ID = ins.Addr
+	}
+	if ins.Weight <= 0 {
+		ins.Weight = 1
+	}
+	return ins, nil
+}
+
+//Value 编码为注册的 value
+func (i Instance) Value() string {
+	var b, _ = json.Marshal(i)
+	return string(b)
+}
+
+//Key 返回实例在服务路径 p 下的 key, 没有 ID 时以地址代替
+func (i Instance) Key(p path.IServiceDiscoverPath) string {
+	var id = i.ID
+	if id == "" {
+		id = i.Addr
+	}
+	return path.InstancePath(p, id)
+}
+
+//HasTag 是否有 tag
+func (i Instance) HasTag(tag string) bool {
+	for _, t := range i.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,49 @@
+package discover
+
+import (
+	"reflect"
+	"testing"
+
+	"rpcimpl/rpcserver/discover/path"
+)
+
+func TestParseInstance(t *testing.T) {
+	var cases = []struct {
+		val  string
+		want Instance
+	}{
+		//旧的纯地址 value
+		{"127.0.0.1:1", Instance{ID: "127.0.0.1:1", Addr: "127.0.0.1:1", Weight: 1}},
+		{" 127.0.0.1:1\n", Instance{ID: "127.0.0.1:1", Addr: "127.0.0.1:1", Weight: 1}},
+		{`{"addr":"127.0.0.1:2","weight":-1}`, Instance{ID: "127.0.0.1:2", Addr: "127.0.0.1:2", Weight: 1}},
+		{`{"id":"b","addr":"127.0.0.1:2","weight":3,"version":"1.2.0","tags":["canary"]}`,
+			Instance{ID: "b", Addr: "127.0.0.1:2", Weight: 3, Version: "1.2.0", Tags: []string{"canary"}}},
+	}
+	for _, c := range cases {
+		got, err := ParseInstance(c.val)
+		if err != nil {
+			t.Fatalf("parse %q err %v", c.val, err)
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("parse %q = %+v want %+v", c.val, got, c.want)
+		}
+	}
+	if _, err := ParseInstance("{bad"); err == nil {
+		t.Fatalf("parse bad json succeeded")
+	}
+}
+
+func TestInstanceValue(t *testing.T) {
+	var ins = Instance{ID: "a", Addr: "127.0.0.1:1", Weight: 2, Zone: "cn", Metadata: map[string]string{"k": "v"}}
+	got, err := ParseInstance(ins.Value())
+	if err != nil {
+		t.Fatalf("parse err %v", err)
+	}
+	if !reflect.DeepEqual(got, ins) {
+		t.Fatalf("instance %+v want %+v", got, ins)
+	}
+	var p = path.DefaultDiscoverPath{Company: "taiyouxi", Version: "1.0.0", ServiceName: "gamex"}
+	if k := (Instance{Addr: "127.0.0.1:1"}).Key(p); k != path.InstancePath(p, "127.0.0.1:1") {
+		t.Fatalf("key %s without id", k)
+	}
+}
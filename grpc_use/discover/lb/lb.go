@@ -0,0 +1,115 @@
+//Package lb 基于服务发现地址属性的 grpc 负载均衡
+package lb
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"google.golang.org/grpc/attributes"
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+//负载均衡策略名, 通过 service config 的 loadBalancingPolicy 选择
+const (
+	RoundRobin = "discover_round_robin"
+	Weighted   = "discover_weighted"
+)
+
+func init() {
+	balancer.Register(base.NewBalancerBuilderV2(RoundRobin, &rrBuilder{}, base.Config{}))
+	balancer.Register(base.NewBalancerBuilderV2(Weighted, &weightedBuilder{}, base.Config{}))
+}
+
+type weightKey struct{}
+
+//WithWeight 返回带权重属性的地址
+func WithWeight(addr resolver.Address, weight int) resolver.Address {
+	if addr.Attributes == nil {
+		addr.Attributes = attributes.New(weightKey{}, weight)
+	} else {
+		addr.Attributes = addr.Attributes.WithValues(weightKey{}, weight)
+	}
+	return addr
+}
+
+//Weight 返回地址的权重, 没有或不合法时为 1
+func Weight(addr resolver.Address) int {
+	if addr.Attributes == nil {
+		return 1
+	}
+	if w, ok := addr.Attributes.Value(weightKey{}).(int); ok && w > 0 {
+		return w
+	}
+	return 1
+}
+
+//round robin ----------------------------------------------------------------------------------------------------
+
+type rrBuilder struct{}
+
+func (*rrBuilder) Build(info base.PickerBuildInfo) balancer.V2Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPickerV2(balancer.ErrNoSubConnAvailable)
+	}
+	var scs = make([]balancer.SubConn, 0, len(info.ReadySCs))
+	for sc := range info.ReadySCs {
+		scs = append(scs, sc)
+	}
+	return &rrPicker{scs: scs}
+}
+
+//rrPicker 依次选择 subConn
+type rrPicker struct {
+	scs  []balancer.SubConn
+	next uint32
+}
+
+func (p *rrPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	var n = atomic.AddUint32(&p.next, 1)
+	return balancer.PickResult{SubConn: p.scs[(n-1)%uint32(len(p.scs))]}, nil
+}
+
+//weighted ----------------------------------------------------------------------------------------------------
+
+type weightedBuilder struct{}
+
+func (*weightedBuilder) Build(info base.PickerBuildInfo) balancer.V2Picker {
+	if len(info.ReadySCs) == 0 {
+		return base.NewErrPickerV2(balancer.ErrNoSubConnAvailable)
+	}
+	var p = &weightedPicker{nodes: make([]*weightedNode, 0, len(info.ReadySCs))}
+	for sc, i := range info.ReadySCs {
+		p.nodes = append(p.nodes, &weightedNode{sc: sc, weight: Weight(i.Address)})
+	}
+	return p
+}
+
+type weightedNode struct {
+	sc      balancer.SubConn
+	weight  int
+	current int
+}
+
+//weightedPicker 平滑加权轮询, 权重 3:1 时选择顺序为 a a b a, 当前值相同时选权重大的
+type weightedPicker struct {
+	lock  sync.Mutex
+	nodes []*weightedNode
+}
+
+func (p *weightedPicker) Pick(balancer.PickInfo) (balancer.PickResult, error) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	var total int
+	var best *weightedNode
+	for _, n := range p.nodes {
+		n.current += n.weight
+		total += n.weight
+		if best == nil || n.current > best.current || n.current == best.current && n.weight > best.weight {
+			best = n
+		}
+	}
+	best.current -= total
+	return balancer.PickResult{SubConn: best.sc}, nil
+}
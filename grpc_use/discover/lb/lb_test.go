@@ -0,0 +1,88 @@
+package lb
+
+import (
+	"errors"
+	"testing"
+
+	"google.golang.org/grpc/balancer"
+	"google.golang.org/grpc/balancer/base"
+	"google.golang.org/grpc/resolver"
+)
+
+type testSC struct {
+	balancer.SubConn
+	name string
+}
+
+//build 用权重 ws 的 ready subConn 构建 picker
+func build(b base.V2PickerBuilder, ws map[string]int) balancer.V2Picker {
+	var info = base.PickerBuildInfo{ReadySCs: make(map[balancer.SubConn]base.SubConnInfo, len(ws))}
+	for name, w := range ws {
+		info.ReadySCs[&testSC{name: name}] = base.SubConnInfo{Address: WithWeight(resolver.Address{Addr: name}, w)}
+	}
+	return b.Build(info)
+}
+
+//picks 返回 n 次选择的 subConn 名
+func picks(t *testing.T, p balancer.V2Picker, n int) []string {
+	t.Helper()
+	var names = make([]string, 0, n)
+	for i := 0; i < n; i++ {
+		r, err := p.Pick(balancer.PickInfo{})
+		if err != nil {
+			t.Fatalf("pick err %v", err)
+		}
+		names = append(names, r.SubConn.(*testSC).name)
+	}
+	return names
+}
+
+func TestRoundRobin(t *testing.T) {
+	var got = picks(t, build(&rrBuilder{}, map[string]int{"a": 3, "b": 1, "c": 1}), 9)
+	//每轮每个 subConn 选一次, 之后按相同顺序重复
+	var seen = make(map[string]bool, 3)
+	for i, name := range got {
+		if i < 3 {
+			seen[name] = true
+		} else if name != got[i-3] {
+			t.Fatalf("picks %v not in order", got)
+		}
+	}
+	if len(seen) != 3 {
+		t.Fatalf("picks %v not all subConns in a round", got)
+	}
+}
+
+func TestWeighted(t *testing.T) {
+	//多次构建以覆盖 map 的不同遍历顺序
+	for i := 0; i < 20; i++ {
+		var got = picks(t, build(&weightedBuilder{}, map[string]int{"a": 3, "b": 1}), 8)
+		for j, want := range []string{"a", "a", "b", "a", "a", "a", "b", "a"} {
+			if got[j] != want {
+				t.Fatalf("picks %v want a a b a a a b a", got)
+			}
+		}
+	}
+}
+
+func TestWeight(t *testing.T) {
+	var addr = resolver.Address{Addr: "a"}
+	if w := Weight(addr); w != 1 {
+		t.Fatalf("weight %d without attribute want 1", w)
+	}
+	if w := Weight(WithWeight(addr, 0)); w != 1 {
+		t.Fatalf("weight %d of 0 want 1", w)
+	}
+	if w := Weight(WithWeight(WithWeight(addr, 2), 5)); w != 5 {
+		t.Fatalf("weight %d want 5", w)
+	}
+}
+
+func TestEmpty(t *testing.T) {
+	for name, b := range map[string]base.V2PickerBuilder{RoundRobin: &rrBuilder{}, Weighted: &weightedBuilder{}} {
+		var p = build(b, nil)
+		if _, err := p.Pick(balancer.PickInfo{}); !errors.Is(err, balancer.ErrNoSubConnAvailable) {
+			t.Fatalf("%s empty pick err %v want %v", name, err, balancer.ErrNoSubConnAvailable)
+		}
+	}
+}
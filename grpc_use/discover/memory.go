@@ -0,0 +1,192 @@
+package discover
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+//memoryRegistry 进程内注册中心, 用于无 etcd 的测试, ttl 被忽略
+//Deregister 不是注册者自己的 key 可模拟租约丢失
+type memoryRegistry struct {
+	lock     sync.Mutex
+	kvs      map[string]string
+	dones    map[string]chan struct{} //注册的 key 结束时关闭
+	watchers map[*watcher]struct{}
+	closed   bool
+}
+
+//NewMemoryRegistry 新建进程内注册中心
+func NewMemoryRegistry() Registry {
+	return &memoryRegistry{
+		kvs:      make(map[string]string),
+		dones:    make(map[string]chan struct{}),
+		watchers: make(map[*watcher]struct{}),
+	}
+}
+
+func (r *memoryRegistry) Register(_ context.Context, key, val string, _ int64) (<-chan struct{}, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil, ErrClosed
+	}
+	r.end(key)
+	var done = make(chan struct{})
+	r.dones[key] = done
+	r.kvs[key] = val
+	r.publish(Event{Type: EventPut, Key: key, Value: val})
+	return done, nil
+}
+
+//end 结束 key 的注册, 需持有锁
+func (r *memoryRegistry) end(key string) {
+	if done, ok := r.dones[key]; ok {
+		close(done)
+		delete(r.dones, key)
+	}
+}
+
+func (r *memoryRegistry) Deregister(_ context.Context, key string) error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return ErrClosed
+	}
+	r.end(key)
+	if _, ok := r.kvs[key]; ok {
+		delete(r.kvs, key)
+		r.publish(Event{Type: EventDelete, Key: key})
+	}
+	return nil
+}
+
+func (r *memoryRegistry) List(_ context.Context, prefix string) (map[string]string, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil, ErrClosed
+	}
+	var kvs = make(map[string]string)
+	for _, ev := range snapshot(r.kvs, prefix) {
+		kvs[ev.Key] = ev.Value
+	}
+	return kvs, nil
+}
+
+func (r *memoryRegistry) Watch(ctx context.Context, prefix string) (<-chan []Event, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil, ErrClosed
+	}
+	var w = newWatcher(prefix, snapshot(r.kvs, prefix))
+	r.watchers[w] = struct{}{}
+	go func() {
+		w.run(ctx)
+		r.lock.Lock()
+		delete(r.watchers, w)
+		r.lock.Unlock()
+	}()
+	return w.out, nil
+}
+
+//publish 通知监视者, 需持有锁
+func (r *memoryRegistry) publish(ev Event) {
+	for w := range r.watchers {
+		w.push(ev)
+	}
+}
+
+func (r *memoryRegistry) Close() error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	r.kvs = nil
+	for key := range r.dones {
+		r.end(key)
+	}
+	for w := range r.watchers {
+		w.stop()
+	}
+	return nil
+}
+
+//watcher ----------------------------------------------------------------------------------------------------
+
+//watcher 将变更合并成批发送, push 不阻塞
+type watcher struct {
+	prefix  string
+	lock    sync.Mutex
+	pending []Event
+	notify  chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	out     chan []Event
+}
+
+//newWatcher 新建监视者, first 作为第一批发送
+func newWatcher(prefix string, first []Event) *watcher {
+	var w = &watcher{
+		prefix:  prefix,
+		pending: first,
+		notify:  make(chan struct{}, 1),
+		done:    make(chan struct{}),
+		out:     make(chan []Event),
+	}
+	w.notify <- struct{}{}
+	return w
+}
+
+func (w *watcher) push(evs ...Event) {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	var n = len(w.pending)
+	for _, ev := range evs {
+		if strings.HasPrefix(ev.Key, w.prefix) {
+			w.pending = append(w.pending, ev)
+		}
+	}
+	if len(w.pending) == n {
+		return
+	}
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) stop() {
+	w.once.Do(func() { close(w.done) })
+}
+
+//run 发送变更直到 ctx 结束或 stop, 退出时关闭 out
+func (w *watcher) run(ctx context.Context) {
+	defer close(w.out)
+	for {
+		select {
+		case <-w.notify:
+		case <-ctx.Done():
+			return
+		case <-w.done:
+			return
+		}
+		w.lock.Lock()
+		var evs = w.pending
+		w.pending = nil
+		w.lock.Unlock()
+		if evs == nil {
+			evs = make([]Event, 0)
+		}
+		select {
+		case w.out <- evs:
+		case <-ctx.Done():
+			return
+		case <-w.done:
+			return
+		}
+	}
+}
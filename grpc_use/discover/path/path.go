@@ -1,6 +1,9 @@
 package path
 
-import "fmt"
+import (
+	"fmt"
+	"strings"
+)
 
 // IServiceDiscoverPath 服务发现路径
 type IServiceDiscoverPath interface {
@@ -32,3 +35,8 @@ func (d DefaultDiscoverPath) GetVersion() string {
 func (d DefaultDiscoverPath) GetServiceName() string {
 	return d.ServiceName
 }
+
+//InstancePath 服务实例的路径, 同一服务的实例各自注册在服务路径下
+func InstancePath(p IServiceDiscoverPath, id string) string {
+	return p.GetPath() + strings.Trim(id, "/")
+}
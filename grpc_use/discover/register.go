@@ -0,0 +1,138 @@
+package discover
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"rpcimpl/rpcserver/discover/path"
+)
+
+//重新注册的退避时间
+var (
+	minBackoff      = time.Second
+	maxBackoff      = 30 * time.Second
+	registerTimeout = 5 * time.Second //每次注册的超时
+)
+
+//ServiceRegister 创建租约注册服务, 租约丢失时以退避重新注册
+type ServiceRegister struct {
+	reg    Registry //注册中心
+	key    string   //key
+	val    string   //value
+	lease  int64    //租约秒数
+	lock   sync.Mutex
+	health chan bool //注册状态, 只保留最新的
+	ok     bool
+	stop   chan struct{}
+	exited chan struct{} //keep 退出时关闭
+	once   sync.Once
+}
+
+//NewServiceRegister 新建注册服务, 租约 lease 秒由 reg 续约
+func NewServiceRegister(reg Registry, key, val string, lease int64) (*ServiceRegister, error) {
+	ser := &ServiceRegister{
+		reg:    reg,
+		key:    key,
+		val:    val,
+		lease:  lease,
+		health: make(chan bool, 1),
+		stop:   make(chan struct{}),
+		exited: make(chan struct{}),
+	}
+	done, err := ser.register()
+	if err != nil {
+		return nil, err
+	}
+	ser.setHealth(true)
+	go ser.keep(done)
+	return ser, nil
+}
+
+//RegisterInstance 在服务路径 p 下以实例自己的 key 注册 ins
+func RegisterInstance(reg Registry, p path.IServiceDiscoverPath, ins Instance, lease int64) (*ServiceRegister, error) {
+	return NewServiceRegister(reg, ins.Key(p), ins.Value(), lease)
+}
+
+func (s *ServiceRegister) register() (<-chan struct{}, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), registerTimeout)
+	defer cancel()
+	return s.reg.Register(ctx, s.key, s.val, s.lease)
+}
+
+//keep 注册结束且没有 Close 时重新注册, 失败以指数退避重试
+func (s *ServiceRegister) keep(done <-chan struct{}) {
+	defer close(s.exited)
+	for {
+		select {
+		case <-done:
+		case <-s.stop:
+			return
+		}
+		log.Printf("租约丢失 key:%s", s.key)
+		s.setHealth(false)
+
+		var backoff = minBackoff
+		for {
+			select {
+			case <-time.After(backoff):
+			case <-s.stop:
+				return
+			}
+			d, err := s.register()
+			if err == nil {
+				done = d
+				break
+			}
+			log.Printf("重新注册 key:%s err:%v retry in %v", s.key, err, backoff)
+			if backoff *= 2; backoff > maxBackoff {
+				backoff = maxBackoff
+			}
+		}
+		log.Printf("重新注册 key:%s success!", s.key)
+		s.setHealth(true)
+	}
+}
+
+//setHealth 更新注册状态, 不阻塞
+func (s *ServiceRegister) setHealth(ok bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	s.ok = ok
+	select {
+	case <-s.health:
+	default:
+	}
+	s.health <- ok
+}
+
+//Health 注册状态变更的 chan, 只保留最新状态, Close 后关闭
+func (s *ServiceRegister) Health() <-chan bool {
+	return s.health
+}
+
+//Healthy 当前是否已注册
+func (s *ServiceRegister) Healthy() bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	return s.ok
+}
+
+// Close 注销服务, 停止重新注册
+func (s *ServiceRegister) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.stop)
+		<-s.exited
+		s.lock.Lock()
+		s.ok = false
+		close(s.health)
+		s.lock.Unlock()
+		if err = s.reg.Deregister(context.Background(), s.key); err != nil {
+			return
+		}
+		log.Println("撤销租约")
+	})
+	return err
+}
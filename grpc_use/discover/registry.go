@@ -0,0 +1,51 @@
+package discover
+
+import (
+	"context"
+	"errors"
+	"strings"
+)
+
+//ErrClosed registry 已关闭
+var ErrClosed = errors.New("discover registry closed")
+
+//EventType 服务变更类型
+type EventType int
+
+const (
+	EventPut    EventType = iota //修改或者新增
+	EventDelete                  //删除
+)
+
+//Event 服务变更, 删除时 Value 为空
+type Event struct {
+	Type  EventType
+	Key   string
+	Value string
+}
+
+//Registry 服务注册中心
+type Registry interface {
+	//Register 注册 key, 租约 ttl 秒, 由 registry 续约直到 Deregister 或 Close
+	//注册结束时关闭返回的 chan, 包括租约丢失, 被注销, 重复注册和 Close
+	Register(ctx context.Context, key, val string, ttl int64) (<-chan struct{}, error)
+	//Deregister 注销 key
+	Deregister(ctx context.Context, key string) error
+	//List 获取前缀下的服务列表
+	List(ctx context.Context, prefix string) (map[string]string, error)
+	//Watch 监视前缀, 第一批为当前服务列表的 EventPut, 之后为变更, ctx 结束, Close 或 watch 出错时关闭 chan
+	Watch(ctx context.Context, prefix string) (<-chan []Event, error)
+	//Close 停止续约并释放资源, 已注册的 key 会被注销
+	Close() error
+}
+
+//snapshot 返回 kvs 中前缀为 prefix 的服务列表的 EventPut
+func snapshot(kvs map[string]string, prefix string) []Event {
+	var evs = make([]Event, 0)
+	for k, v := range kvs {
+		if strings.HasPrefix(k, prefix) {
+			evs = append(evs, Event{Type: EventPut, Key: k, Value: v})
+		}
+	}
+	return evs
+}
@@ -0,0 +1,226 @@
+package discover
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+const waitTimeout = 2 * time.Second
+
+// backends returns a registry per implementation that can run without etcd.
+func backends(t *testing.T) map[string]Registry {
+	var file = filepath.Join(t.TempDir(), "registry.json")
+	return map[string]Registry{
+		"memory": NewMemoryRegistry(),
+		"file":   NewFileRegistry(file, 10*time.Millisecond),
+	}
+}
+
+// collect reads batches from ch until n events are received.
+func collect(t *testing.T, ch <-chan []Event, n int) [][]Event {
+	t.Helper()
+	var batches [][]Event
+	var timer = time.NewTimer(waitTimeout)
+	defer timer.Stop()
+	for got := 0; got < n; {
+		select {
+		case evs, ok := <-ch:
+			if !ok {
+				t.Fatalf("watch closed after %d of %d events", got, n)
+			}
+			if len(evs) == 0 {
+				continue
+			}
+			batches = append(batches, evs)
+			got += len(evs)
+		case <-timer.C:
+			t.Fatalf("received %d of %d events in %v", got, n, waitTimeout)
+		}
+	}
+	return batches
+}
+
+// events flattens batches into a map of key to the last event of the key.
+func events(batches [][]Event) map[string]Event {
+	var evs = make(map[string]Event)
+	for _, b := range batches {
+		for _, ev := range b {
+			evs[ev.Key] = ev
+		}
+	}
+	return evs
+}
+
+func closed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	case <-time.After(waitTimeout):
+		return false
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	for name, reg := range backends(t) {
+		reg := reg
+		t.Run(name, func(t *testing.T) {
+			defer reg.Close()
+			var ctx = context.Background()
+			done, err := reg.Register(ctx, "/svc/a", "1", 5)
+			if err != nil {
+				t.Fatalf("register err %v", err)
+			}
+			if _, err := reg.Register(ctx, "/other/b", "2", 5); err != nil {
+				t.Fatalf("register err %v", err)
+			}
+
+			list, err := reg.List(ctx, "/svc/")
+			if err != nil {
+				t.Fatalf("list err %v", err)
+			}
+			if want := map[string]string{"/svc/a": "1"}; !reflect.DeepEqual(list, want) {
+				t.Fatalf("list %v want %v", list, want)
+			}
+
+			//重复注册结束之前的注册
+			again, err := reg.Register(ctx, "/svc/a", "3", 5)
+			if err != nil {
+				t.Fatalf("register again err %v", err)
+			}
+			if !closed(done) {
+				t.Fatalf("done of the replaced register not closed")
+			}
+			if err := reg.Deregister(ctx, "/svc/a"); err != nil {
+				t.Fatalf("deregister err %v", err)
+			}
+			if !closed(again) {
+				t.Fatalf("done not closed by deregister")
+			}
+			if list, _ := reg.List(ctx, "/svc/"); len(list) != 0 {
+				t.Fatalf("list %v after deregister", list)
+			}
+		})
+	}
+}
+
+func TestRegistryWatch(t *testing.T) {
+	for name, reg := range backends(t) {
+		reg := reg
+		t.Run(name, func(t *testing.T) {
+			defer reg.Close()
+			var ctx, cancel = context.WithCancel(context.Background())
+			defer cancel()
+			if _, err := reg.Register(ctx, "/svc/a", "1", 5); err != nil {
+				t.Fatalf("register err %v", err)
+			}
+			ch, err := reg.Watch(ctx, "/svc/")
+			if err != nil {
+				t.Fatalf("watch err %v", err)
+			}
+			var first = collect(t, ch, 1)
+			if want := []Event{{Type: EventPut, Key: "/svc/a", Value: "1"}}; !reflect.DeepEqual(first[0], want) {
+				t.Fatalf("first batch %v want %v", first[0], want)
+			}
+
+			//不读取时内存的变更合并成批, 其他前缀被过滤
+			for _, k := range []string{"/svc/b", "/other/x", "/svc/c"} {
+				if _, err := reg.Register(ctx, k, "2", 5); err != nil {
+					t.Fatalf("register err %v", err)
+				}
+			}
+			if err := reg.Deregister(ctx, "/svc/a"); err != nil {
+				t.Fatalf("deregister err %v", err)
+			}
+			var batches = collect(t, ch, 3)
+			if name == "memory" && len(batches) > 2 {
+				t.Fatalf("changes not batched %v", batches)
+			}
+			var want = map[string]Event{
+				"/svc/a": {Type: EventDelete, Key: "/svc/a"},
+				"/svc/b": {Type: EventPut, Key: "/svc/b", Value: "2"},
+				"/svc/c": {Type: EventPut, Key: "/svc/c", Value: "2"},
+			}
+			if got := events(batches); !reflect.DeepEqual(got, want) {
+				t.Fatalf("events %v want %v", got, want)
+			}
+
+			cancel()
+			select {
+			case _, ok := <-ch:
+				if ok {
+					for range ch {
+					}
+				}
+			case <-time.After(waitTimeout):
+				t.Fatalf("watch not closed by ctx")
+			}
+		})
+	}
+}
+
+func TestRegistryClose(t *testing.T) {
+	for name, reg := range backends(t) {
+		reg := reg
+		t.Run(name, func(t *testing.T) {
+			var ctx = context.Background()
+			done, err := reg.Register(ctx, "/svc/a", "1", 5)
+			if err != nil {
+				t.Fatalf("register err %v", err)
+			}
+			ch, err := reg.Watch(ctx, "/svc/")
+			if err != nil {
+				t.Fatalf("watch err %v", err)
+			}
+			collect(t, ch, 1)
+
+			if err := reg.Close(); err != nil {
+				t.Fatalf("close err %v", err)
+			}
+			if !closed(done) {
+				t.Fatalf("done not closed by close")
+			}
+			for range ch {
+			}
+			if _, err := reg.Register(ctx, "/svc/b", "1", 5); !errors.Is(err, ErrClosed) {
+				t.Fatalf("register after close err %v want %v", err, ErrClosed)
+			}
+		})
+	}
+}
+
+// TestFileRegistryShared watches the changes of another registry on the same file.
+func TestFileRegistryShared(t *testing.T) {
+	var file = filepath.Join(t.TempDir(), "registry.json")
+	var a, b = NewFileRegistry(file, 10*time.Millisecond), NewFileRegistry(file, 10*time.Millisecond)
+	defer a.Close()
+	defer b.Close()
+
+	var ctx = context.Background()
+	ch, err := b.Watch(ctx, "/svc/")
+	if err != nil {
+		t.Fatalf("watch err %v", err)
+	}
+	if evs := <-ch; len(evs) != 0 {
+		t.Fatalf("first batch %v want empty", evs)
+	}
+	if _, err := a.Register(ctx, "/svc/a", "1", 5); err != nil {
+		t.Fatalf("register err %v", err)
+	}
+	var got = events(collect(t, ch, 1))
+	if want := (Event{Type: EventPut, Key: "/svc/a", Value: "1"}); got["/svc/a"] != want {
+		t.Fatalf("event %v want %v", got["/svc/a"], want)
+	}
+
+	//Close 注销本 registry 注册的 key
+	if err := a.Close(); err != nil {
+		t.Fatalf("close err %v", err)
+	}
+	got = events(collect(t, ch, 1))
+	if want := (Event{Type: EventDelete, Key: "/svc/a"}); got["/svc/a"] != want {
+		t.Fatalf("event %v want %v", got["/svc/a"], want)
+	}
+}
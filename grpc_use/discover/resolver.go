@@ -0,0 +1,96 @@
+package discover
+
+import (
+	"net/url"
+	"strings"
+
+	"google.golang.org/grpc/resolver"
+	"rpcimpl/rpcserver/discover/lb"
+	"rpcimpl/rpcserver/discover/path"
+)
+
+//Scheme 服务发现 resolver 的 scheme, 与注册中心的实现无关, target 如 etcd:///taiyouxi/1.0.0/gamex
+//target 可带 Selector 的 query 只解析被选择的实例, 如 etcd:///taiyouxi/1.0.0/gamex?min_version=1.2.0&tag=canary
+const Scheme = "etcd"
+
+//Target 返回服务发现路径对应的 grpc dial target
+func Target(p path.IServiceDiscoverPath) string {
+	return Scheme + "://" + "/" + strings.Trim(p.GetPath(), "/")
+}
+
+//SelectTarget 返回只解析被 sel 选择的实例的 target
+func SelectTarget(p path.IServiceDiscoverPath, sel Selector) string {
+	var q = sel.Encode()
+	if q == "" {
+		return Target(p)
+	}
+	return Target(p) + "?" + q
+}
+
+//RegisterResolver 以 reg 注册全局的服务发现 resolver, 需在 grpc.Dial 前调用
+func RegisterResolver(reg Registry) {
+	resolver.Register(NewResolverBuilder(reg))
+}
+
+//resolverBuilder 监视 target 路径下的服务, 变更时更新 grpc 连接的地址
+type resolverBuilder struct {
+	reg Registry
+}
+
+//NewResolverBuilder 新建服务发现 resolver builder
+func NewResolverBuilder(reg Registry) resolver.Builder {
+	return &resolverBuilder{reg: reg}
+}
+
+func (b *resolverBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	//grpc 固定在 v1.26, Target 还没有解析好的 URL 字段, Endpoint 包含 query, 拼回 url 再解析
+	//升级 grpc 后改用 target.URL
+	u, err := url.Parse(Scheme + "://" + target.Authority + "/" + target.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	sel, err := ParseSelector(u.RawQuery)
+	if err != nil {
+		return nil, err
+	}
+	var prefix = "/" + strings.Trim(u.Path, "/") + "/"
+	var r = &etcdResolver{cc: cc, sd: NewServiceDiscovery(b.reg), sel: sel}
+	r.sd.OnChange(r.update)
+	if err := r.sd.WatchService(prefix); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (b *resolverBuilder) Scheme() string {
+	return Scheme
+}
+
+//etcdResolver 服务列表变更时更新 cc
+type etcdResolver struct {
+	cc  resolver.ClientConn
+	sd  *ServiceDiscovery
+	sel Selector
+}
+
+//update 以服务列表中被选择的实例更新地址, 同一地址只保留一个, 权重写入地址属性
+func (r *etcdResolver) update(list map[string]string) {
+	var seen = make(map[string]bool, len(list))
+	var addrs = make([]resolver.Address, 0, len(list))
+	for _, v := range list {
+		i, err := ParseInstance(v)
+		if err != nil || i.Addr == "" || seen[i.Addr] || !r.sel.Match(i) {
+			continue
+		}
+		seen[i.Addr] = true
+		addrs = append(addrs, lb.WithWeight(resolver.Address{Addr: i.Addr}, i.Weight))
+	}
+	r.cc.UpdateState(resolver.State{Addresses: addrs})
+}
+
+//ResolveNow watch 已实时更新, 无需处理
+func (r *etcdResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (r *etcdResolver) Close() {
+	r.sd.Close()
+}
@@ -0,0 +1,183 @@
+package discover
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+	"rpcimpl/rpcserver/discover/lb"
+	"rpcimpl/rpcserver/discover/path"
+)
+
+// testConn records the states updated by the resolver.
+type testConn struct {
+	states chan resolver.State
+}
+
+func (c *testConn) UpdateState(s resolver.State)  { c.states <- s }
+func (c *testConn) ReportError(error)             {}
+func (c *testConn) NewAddress([]resolver.Address) {}
+func (c *testConn) NewServiceConfig(string)       {}
+func (c *testConn) ParseServiceConfig(string) *serviceconfig.ParseResult {
+	return nil
+}
+
+// weights returns the addresses of s with their weights.
+func weights(s resolver.State) map[string]int {
+	var ws = make(map[string]int, len(s.Addresses))
+	for _, addr := range s.Addresses {
+		ws[addr.Addr] = lb.Weight(addr)
+	}
+	return ws
+}
+
+// wait waits for a state with the addresses and weights of want.
+func (c *testConn) wait(t *testing.T, want map[string]int) {
+	t.Helper()
+	var timer = time.NewTimer(waitTimeout)
+	defer timer.Stop()
+	var got map[string]int
+	for {
+		select {
+		case s := <-c.states:
+			if got = weights(s); reflect.DeepEqual(got, want) {
+				return
+			}
+		case <-timer.C:
+			t.Fatalf("state %v want %v", got, want)
+		}
+	}
+}
+
+// parseTarget splits target like grpc v1.26.
+func parseTarget(target string) resolver.Target {
+	var scheme, rest = target[:strings.Index(target, "://")], target[strings.Index(target, "://")+3:]
+	var i = strings.IndexByte(rest, '/')
+	return resolver.Target{Scheme: scheme, Authority: rest[:i], Endpoint: rest[i+1:]}
+}
+
+func TestResolver(t *testing.T) {
+	var reg = NewMemoryRegistry()
+	defer reg.Close()
+	var p = path.DefaultDiscoverPath{Company: "taiyouxi", Version: "1.0.0", ServiceName: "gamex"}
+	var ctx = context.Background()
+	for _, ins := range []Instance{
+		{ID: "a", Addr: "127.0.0.1:1", Weight: 3, Version: "1.2.0", Tags: []string{"canary"}},
+		{ID: "b", Addr: "127.0.0.1:2", Version: "1.1.0", Tags: []string{"canary"}},
+		{ID: "c", Addr: "127.0.0.1:3", Version: "1.3.0"},
+		{ID: "d", Addr: "127.0.0.1:1", Weight: 5, Version: "1.2.0", Tags: []string{"canary"}},
+	} {
+		if _, err := reg.Register(ctx, ins.Key(p), ins.Value(), 5); err != nil {
+			t.Fatalf("register err %v", err)
+		}
+	}
+	if _, err := reg.Register(ctx, "/taiyouxi/1.0.0/gamexx/e", "127.0.0.1:9", 5); err != nil {
+		t.Fatalf("register err %v", err)
+	}
+
+	var cc = &testConn{states: make(chan resolver.State, 16)}
+	var target = SelectTarget(p, Selector{MinVersion: "1.2.0", Tags: []string{"canary"}})
+	r, err := NewResolverBuilder(reg).Build(parseTarget(target), cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatalf("build %s err %v", target, err)
+	}
+	defer r.Close()
+
+	//同一地址只保留一个
+	var s = <-cc.states
+	if len(s.Addresses) != 1 || s.Addresses[0].Addr != "127.0.0.1:1" {
+		t.Fatalf("addresses %v", s.Addresses)
+	}
+	if w := lb.Weight(s.Addresses[0]); w != 3 && w != 5 {
+		t.Fatalf("weight %d want 3 or 5", w)
+	}
+
+	var f = Instance{ID: "f", Addr: "127.0.0.1:6", Weight: 2, Version: "2.0.0", Tags: []string{"canary"}}
+	if _, err := reg.Register(ctx, f.Key(p), f.Value(), 5); err != nil {
+		t.Fatalf("register err %v", err)
+	}
+	for _, id := range []string{"a", "d"} {
+		if err := reg.Deregister(ctx, path.InstancePath(p, id)); err != nil {
+			t.Fatalf("deregister err %v", err)
+		}
+	}
+	cc.wait(t, map[string]int{"127.0.0.1:6": 2})
+}
+
+func TestResolverBadSelector(t *testing.T) {
+	var reg = NewMemoryRegistry()
+	defer reg.Close()
+	var cc = &testConn{states: make(chan resolver.State, 1)}
+	var target = parseTarget(Scheme + ":///taiyouxi/1.0.0/gamex?tag=%zz")
+	if _, err := NewResolverBuilder(reg).Build(target, cc, resolver.BuildOptions{}); err == nil {
+		t.Fatalf("build with a bad selector succeeded")
+	}
+}
+
+// breakRegistry is a memory registry whose watches can be broken like a lost etcd connection.
+type breakRegistry struct {
+	Registry
+	lock    sync.Mutex
+	cancels []context.CancelFunc
+}
+
+func (r *breakRegistry) Watch(ctx context.Context, prefix string) (<-chan []Event, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	r.lock.Lock()
+	r.cancels = append(r.cancels, cancel)
+	r.lock.Unlock()
+	return r.Registry.Watch(ctx, prefix)
+}
+
+// cut closes the watch channels without ending the ctx of watchers.
+func (r *breakRegistry) cut() {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, cancel := range r.cancels {
+		cancel()
+	}
+	r.cancels = nil
+}
+
+func TestServiceDiscoveryRewatch(t *testing.T) {
+	fastBackoff(t)
+	var reg = &breakRegistry{Registry: NewMemoryRegistry()}
+	defer reg.Close()
+	var ctx = context.Background()
+	if _, err := reg.Register(ctx, "/svc/a", "127.0.0.1:1", 5); err != nil {
+		t.Fatalf("register err %v", err)
+	}
+	var sd = NewServiceDiscovery(reg)
+	defer sd.Close()
+	if err := sd.WatchService("/svc/"); err != nil {
+		t.Fatalf("watch service err %v", err)
+	}
+
+	//监视断开期间的变更由重新监视的服务列表替换
+	reg.cut()
+	if err := reg.Deregister(ctx, "/svc/a"); err != nil {
+		t.Fatalf("deregister err %v", err)
+	}
+	if _, err := reg.Register(ctx, "/svc/b", "127.0.0.1:2", 5); err != nil {
+		t.Fatalf("register err %v", err)
+	}
+	eventually(t, "rewatched list", func() bool {
+		return reflect.DeepEqual(sd.GetServices(), []string{"127.0.0.1:2"})
+	})
+
+	//重新监视后继续接收变更
+	if _, err := reg.Register(ctx, "/svc/c", "127.0.0.1:3", 5); err != nil {
+		t.Fatalf("register err %v", err)
+	}
+	eventually(t, "changes after rewatch", func() bool {
+		var addrs = sd.GetServices()
+		sort.Strings(addrs)
+		return reflect.DeepEqual(addrs, []string{"127.0.0.1:2", "127.0.0.1:3"})
+	})
+}
@@ -0,0 +1,137 @@
+package discover
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+//Selector 按版本范围, tag 和 zone 选择实例, 零值选择全部
+type Selector struct {
+	MinVersion string   //最低版本, 包含
+	MaxVersion string   //最高版本, 不包含
+	Tags       []string //需有全部 tag
+	Zone       string
+}
+
+//Match 实例是否被选择, 设置了版本范围时没有版本的实例不被选择
+func (s Selector) Match(i Instance) bool {
+	if s.Zone != "" && i.Zone != s.Zone {
+		return false
+	}
+	for _, t := range s.Tags {
+		if !i.HasTag(t) {
+			return false
+		}
+	}
+	if s.MinVersion == "" && s.MaxVersion == "" {
+		return true
+	}
+	if i.Version == "" {
+		return false
+	}
+	if s.MinVersion != "" && CompareVersion(i.Version, s.MinVersion) < 0 {
+		return false
+	}
+	if s.MaxVersion != "" && CompareVersion(i.Version, s.MaxVersion) >= 0 {
+		return false
+	}
+	return true
+}
+
+//Encode 编码为 url query, 用于 resolver target
+func (s Selector) Encode() string {
+	var q = url.Values{}
+	if s.MinVersion != "" {
+		q.Set("min_version", s.MinVersion)
+	}
+	if s.MaxVersion != "" {
+		q.Set("max_version", s.MaxVersion)
+	}
+	if s.Zone != "" {
+		q.Set("zone", s.Zone)
+	}
+	for _, t := range s.Tags {
+		q.Add("tag", t)
+	}
+	return q.Encode()
+}
+
+//ParseSelector 解析 Encode 的 url query
+func ParseSelector(query string) (Selector, error) {
+	q, err := url.ParseQuery(query)
+	if err != nil {
+		return Selector{}, fmt.Errorf("discover selector %q err %v", query, err)
+	}
+	for k := range q {
+		switch k {
+		case "min_version", "max_version", "zone", "tag":
+		default:
+			return Selector{}, fmt.Errorf("discover selector %q unknown key %s", query, k)
+		}
+	}
+	return Selector{
+		MinVersion: q.Get("min_version"),
+		MaxVersion: q.Get("max_version"),
+		Tags:       q["tag"],
+		Zone:       q.Get("zone"),
+	}, nil
+}
+
+//CompareVersion 比较版本 a 与 b, 返回 -1, 0, 1
+//版本形如 v1.2.3-canary, 数字段逐段比较, 缺少的段为 0, 相同时带预发布后缀的较小
+func CompareVersion(a, b string) int {
+	var an, ap = splitVersion(a)
+	var bn, bp = splitVersion(b)
+	for i := 0; i < len(an) || i < len(bn); i++ {
+		var x, y = versionPart(an, i), versionPart(bn, i)
+		if c := compareNum(x, y); c != 0 {
+			return c
+		}
+	}
+	switch {
+	case ap == bp:
+		return 0
+	case ap == "":
+		return 1
+	case bp == "":
+		return -1
+	case ap < bp:
+		return -1
+	default:
+		return 1
+	}
+}
+
+func splitVersion(v string) ([]string, string) {
+	v = strings.TrimPrefix(strings.TrimSpace(v), "v")
+	var pre string
+	if i := strings.IndexByte(v, '-'); i >= 0 {
+		v, pre = v[:i], v[i+1:]
+	}
+	return strings.Split(v, "."), pre
+}
+
+func versionPart(parts []string, i int) string {
+	if i < len(parts) && parts[i] != "" {
+		return parts[i]
+	}
+	return "0"
+}
+
+//compareNum 数字按大小比较, 非数字按字符串比较
+func compareNum(x, y string) int {
+	var xi, xerr = strconv.ParseUint(x, 10, 64)
+	var yi, yerr = strconv.ParseUint(y, 10, 64)
+	if xerr == nil && yerr == nil {
+		switch {
+		case xi < yi:
+			return -1
+		case xi > yi:
+			return 1
+		}
+		return 0
+	}
+	return strings.Compare(x, y)
+}
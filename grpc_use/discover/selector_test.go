@@ -0,0 +1,78 @@
+package discover
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestCompareVersion(t *testing.T) {
+	var cases = []struct {
+		a, b string
+		want int
+	}{
+		{"1.2.0", "1.2.0", 0},
+		{"1.2.0", "1.10.0", -1},
+		{"2.0", "1.9.9", 1},
+		//缺少的段为 0
+		{"1.2", "1.2.0", 0},
+		{"1.2", "1.2.1", -1},
+		{"1.2.0.1", "1.2", 1},
+		//v 前缀
+		{"v1.2.0", "1.2.0", 0},
+		{"v1.3", "v1.2.9", 1},
+		//预发布后缀小于正式版本
+		{"1.2.0-canary", "1.2.0", -1},
+		{"1.2.0", "1.2.0-canary", 1},
+		{"1.2.0-alpha", "1.2.0-beta", -1},
+		{"1.2.1-canary", "1.2.0", 1},
+		//非数字段按字符串比较
+		{"1.x", "1.2", 1},
+		{"1.a.0", "1.b.0", -1},
+	}
+	for _, c := range cases {
+		if got := CompareVersion(c.a, c.b); got != c.want {
+			t.Fatalf("compare %s %s = %d want %d", c.a, c.b, got, c.want)
+		}
+		if got := CompareVersion(c.b, c.a); got != -c.want {
+			t.Fatalf("compare %s %s = %d want %d", c.b, c.a, got, -c.want)
+		}
+	}
+}
+
+func TestSelectorMatch(t *testing.T) {
+	var s = Selector{MinVersion: "1.2.0", MaxVersion: "2.0.0", Tags: []string{"canary"}}
+	var cases = []struct {
+		ins  Instance
+		want bool
+	}{
+		{Instance{Version: "1.2.0", Tags: []string{"canary"}}, true},
+		{Instance{Version: "1.2.0-canary", Tags: []string{"canary"}}, false},
+		{Instance{Version: "1.9.9", Tags: []string{"a", "canary"}}, true},
+		{Instance{Version: "2.0.0-rc1", Tags: []string{"canary"}}, true},
+		{Instance{Version: "2.0.0", Tags: []string{"canary"}}, false},
+		{Instance{Version: "1.5.0"}, false},
+		{Instance{Tags: []string{"canary"}}, false},
+	}
+	for _, c := range cases {
+		if got := s.Match(c.ins); got != c.want {
+			t.Fatalf("match %+v = %v want %v", c.ins, got, c.want)
+		}
+	}
+	if !(Selector{}).Match(Instance{}) {
+		t.Fatalf("zero selector not match")
+	}
+}
+
+func TestParseSelector(t *testing.T) {
+	var s = Selector{MinVersion: "1.2.0", MaxVersion: "v2", Tags: []string{"a", "b"}, Zone: "cn"}
+	got, err := ParseSelector(s.Encode())
+	if err != nil {
+		t.Fatalf("parse err %v", err)
+	}
+	if !reflect.DeepEqual(got, s) {
+		t.Fatalf("selector %+v want %+v", got, s)
+	}
+	if _, err := ParseSelector("version=1"); err == nil {
+		t.Fatalf("parse unknown key succeeded")
+	}
+}
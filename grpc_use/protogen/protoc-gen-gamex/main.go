@@ -0,0 +1,146 @@
+// protoc-gen-gamex generates gamex rpc servers from proto services.
+//
+// For each service it writes under rpcserver/<service>:
+//
+//	handler/<rpc>handler.go  handler stub, only when the file does not exist yet
+//	server/server.go         server type stub, only when the file does not exist yet
+//	server/reghandler.go     server methods calling the handlers, always regenerated
+//	client/client.go         typed client wrapper, always regenerated
+//
+// Install with go install ./protogen/protoc-gen-gamex, then from the module root:
+//
+//	protoc -I rpcproto rpcproto/msg.proto --gamex_out=. --gamex_opt=Mmsg.proto=rpcimpl/rpcserver/rpcproto
+//
+// Options:
+//
+//	root     directory of --gamex_out, to find existing handler files, default "."
+//	out_pkg  import path of --gamex_out, default "rpcimpl/rpcserver"
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/template"
+
+	"google.golang.org/protobuf/compiler/protogen"
+)
+
+var (
+	serverDir  = "rpcserver"
+	serverFile = "server.go"
+	regFile    = "reghandler.go"
+	clientDir  = "client"
+	lbPkg      = protogen.GoImportPath("rpcimpl/rpcserver/discover/lb")
+)
+
+func main() {
+	var flags flag.FlagSet
+	var root = flags.String("root", ".", "directory of --gamex_out")
+	var outPkg = flags.String("out_pkg", "rpcimpl/rpcserver", "import path of --gamex_out")
+	protogen.Options{ParamFunc: flags.Set}.Run(func(gen *protogen.Plugin) error {
+		return generate(gen, *root, *outPkg)
+	})
+}
+
+// generate generates the services of the files to generate.
+func generate(gen *protogen.Plugin, root, outPkg string) error {
+	for _, f := range gen.Files {
+		if !f.Generate {
+			continue
+		}
+		for _, s := range f.Services {
+			if err := genService(gen, f, s, root, outPkg); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// service is the template data of a service.
+type service struct {
+	*protogen.Service
+	Dir     string                // output dir of the service
+	Proto   protogen.GoImportPath // package of the proto file
+	Handler protogen.GoImportPath
+	LB      protogen.GoImportPath
+	RegFile string
+	Methods []*protogen.Method // unary methods
+}
+
+func genService(gen *protogen.Plugin, f *protogen.File, s *protogen.Service, root, outPkg string) error {
+	var dir = path.Join(serverDir, strings.ToLower(s.GoName))
+	var data = &service{
+		Service: s,
+		Dir:     dir,
+		Proto:   f.GoImportPath,
+		Handler: protogen.GoImportPath(path.Join(outPkg, dir, "handler")),
+		LB:      lbPkg,
+		RegFile: regFile,
+	}
+	for _, m := range s.Methods {
+		if m.Desc.IsStreamingClient() || m.Desc.IsStreamingServer() {
+			fmt.Fprintf(os.Stderr, "protoc-gen-gamex: %s.%s streaming not supported, skipped\n", s.GoName, m.GoName)
+			continue
+		}
+		data.Methods = append(data.Methods, m)
+	}
+
+	// stubs are hand written once generated, never overwrite them
+	for _, m := range data.Methods {
+		var name = path.Join(dir, "handler", strings.ToLower(m.GoName)+"handler.go")
+		if err := stub(gen, root, name, data.Handler, handlerTmpl, m); err != nil {
+			return err
+		}
+	}
+	if err := stub(gen, root, path.Join(dir, "server", serverFile), "", serverTmpl, data); err != nil {
+		return err
+	}
+
+	if err := execute(gen, path.Join(dir, "server", regFile), "", regTmpl, data); err != nil {
+		return err
+	}
+	return execute(gen, path.Join(dir, clientDir, "client.go"), "", clientTmpl, data)
+}
+
+// stub executes tmpl like execute only when name does not exist under root.
+func stub(gen *protogen.Plugin, root, name string, importPath protogen.GoImportPath, tmpl string, data interface{}) error {
+	if _, err := os.Stat(filepath.Join(root, filepath.FromSlash(name))); err == nil {
+		return nil
+	} else if !os.IsNotExist(err) {
+		return fmt.Errorf("stat stub %s err %v", name, err)
+	}
+	return execute(gen, name, importPath, tmpl, data)
+}
+
+// execute writes tmpl with data to the generated file name, identifiers written by the ident func are
+// imported by the generated file.
+func execute(gen *protogen.Plugin, name string, importPath protogen.GoImportPath, tmpl string, data interface{}) error {
+	var g = gen.NewGeneratedFile(name, importPath)
+	var t, err = template.New(name).Funcs(template.FuncMap{
+		"ident": func(importPath interface{}, name string) string {
+			var p, ok = importPath.(protogen.GoImportPath)
+			if !ok {
+				p = protogen.GoImportPath(importPath.(string))
+			}
+			return g.QualifiedGoIdent(p.Ident(name))
+		},
+		"type": func(m *protogen.Message) string {
+			return g.QualifiedGoIdent(m.GoIdent)
+		},
+	}).Parse(tmpl)
+	if err != nil {
+		return fmt.Errorf("template %s err %v", name, err)
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, data); err != nil {
+		return fmt.Errorf("template %s execute err %v", name, err)
+	}
+	_, err = g.Write(buf.Bytes())
+	return err
+}
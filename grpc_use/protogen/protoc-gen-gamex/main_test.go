@@ -0,0 +1,157 @@
+package main
+
+import (
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/compiler/protogen"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/descriptorpb"
+	"google.golang.org/protobuf/types/pluginpb"
+)
+
+func message(name string) *descriptorpb.DescriptorProto {
+	return &descriptorpb.DescriptorProto{Name: proto.String(name), Field: []*descriptorpb.FieldDescriptorProto{{
+		Name:     proto.String("name"),
+		Number:   proto.Int32(1),
+		Label:    descriptorpb.FieldDescriptorProto_LABEL_OPTIONAL.Enum(),
+		Type:     descriptorpb.FieldDescriptorProto_TYPE_STRING.Enum(),
+		JsonName: proto.String("name"),
+	}}}
+}
+
+func method(name, in, out string, stream bool) *descriptorpb.MethodDescriptorProto {
+	return &descriptorpb.MethodDescriptorProto{
+		Name:            proto.String(name),
+		InputType:       proto.String(".rpcproto." + in),
+		OutputType:      proto.String(".rpcproto." + out),
+		ServerStreaming: proto.Bool(stream),
+	}
+}
+
+// request is a CodeGeneratorRequest of a msg.proto with a GameX and a Chat service.
+func request() *pluginpb.CodeGeneratorRequest {
+	var f = &descriptorpb.FileDescriptorProto{
+		Name:        proto.String("msg.proto"),
+		Package:     proto.String("rpcproto"),
+		Syntax:      proto.String("proto3"),
+		Options:     &descriptorpb.FileOptions{GoPackage: proto.String("rpcimpl/rpcserver/rpcproto")},
+		MessageType: []*descriptorpb.DescriptorProto{message("HelloReq"), message("HelloRsp")},
+		Service: []*descriptorpb.ServiceDescriptorProto{{
+			Name: proto.String("GameX"),
+			Method: []*descriptorpb.MethodDescriptorProto{
+				method("HelloGameX", "HelloReq", "HelloRsp", false),
+				method("ByeGameX", "HelloReq", "HelloRsp", false),
+				method("WatchGameX", "HelloReq", "HelloRsp", true),
+			},
+		}, {
+			Name:   proto.String("Chat"),
+			Method: []*descriptorpb.MethodDescriptorProto{method("Say", "HelloReq", "HelloRsp", false)},
+		}},
+	}
+	return &pluginpb.CodeGeneratorRequest{FileToGenerate: []string{"msg.proto"}, ProtoFile: []*descriptorpb.FileDescriptorProto{f}}
+}
+
+// run runs the plugin over request with root and writes the generated files to root.
+func run(t *testing.T, root string) map[string]string {
+	t.Helper()
+	var gen, err = protogen.Options{}.New(request())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := generate(gen, root, "rpcimpl/rpcserver"); err != nil {
+		t.Fatal(err)
+	}
+	var rsp = gen.Response()
+	if rsp.Error != nil {
+		t.Fatal(rsp.GetError())
+	}
+	var files = make(map[string]string)
+	for _, f := range rsp.File {
+		files[f.GetName()] = f.GetContent()
+		var name = filepath.Join(root, filepath.FromSlash(f.GetName()))
+		if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(name, []byte(f.GetContent()), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return files
+}
+
+func names(files map[string]string) []string {
+	var s []string
+	for name := range files {
+		s = append(s, name)
+	}
+	sort.Strings(s)
+	return s
+}
+
+func TestGenerate(t *testing.T) {
+	const (
+		hello      = "rpcserver/gamex/handler/hellogamexhandler.go"
+		bye        = "rpcserver/gamex/handler/byegamexhandler.go"
+		server     = "rpcserver/gamex/server/server.go"
+		reg        = "rpcserver/gamex/server/reghandler.go"
+		client     = "rpcserver/gamex/client/client.go"
+		say        = "rpcserver/chat/handler/sayhandler.go"
+		chatServer = "rpcserver/chat/server/server.go"
+		chatReg    = "rpcserver/chat/server/reghandler.go"
+		chatClient = "rpcserver/chat/client/client.go"
+	)
+	var root = t.TempDir()
+
+	var first = run(t, root)
+	var want = []string{chatClient, say, chatReg, chatServer, client, bye, hello, reg, server}
+	if got, want := strings.Join(names(first), " "), strings.Join(want, " "); got != want {
+		t.Fatalf("first files %s want %s", got, want)
+	}
+	for name, content := range first {
+		if strings.Contains(content, "WatchGameX") {
+			t.Fatalf("streaming method generated in %s", name)
+		}
+		if _, err := parser.ParseFile(token.NewFileSet(), name, content, 0); err != nil {
+			t.Fatalf("parse %s err %v\n%s", name, err, content)
+		}
+	}
+	if !strings.Contains(first[reg], "handler.HelloGameXHandler(ctx, in, out)") {
+		t.Fatalf("reghandler\n%s", first[reg])
+	}
+	// the methods in reghandler.go need the server type of every service
+	for _, c := range []struct{ server, unimplemented string }{
+		{server, "rpcproto.UnimplementedGameXServer"},
+		{chatServer, "rpcproto.UnimplementedChatServer"},
+	} {
+		if !strings.Contains(first[c.server], "type server struct") || !strings.Contains(first[c.server], c.unimplemented) {
+			t.Fatalf("server stub\n%s", first[c.server])
+		}
+	}
+	if !strings.Contains(first[chatReg], "func (s *server) Say(") {
+		t.Fatalf("chat reghandler\n%s", first[chatReg])
+	}
+
+	var written = "package handler\n\n// hand written\n"
+	if err := os.WriteFile(filepath.Join(root, filepath.FromSlash(hello)), []byte(written), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var second = run(t, root)
+	want = []string{chatClient, chatReg, client, reg}
+	if got, want := strings.Join(names(second), " "), strings.Join(want, " "); got != want {
+		t.Fatalf("second files %s want %s", got, want)
+	}
+	for _, name := range want {
+		if second[name] != first[name] {
+			t.Fatalf("regenerated %s differs", name)
+		}
+	}
+	if b, _ := os.ReadFile(filepath.Join(root, filepath.FromSlash(hello))); string(b) != written {
+		t.Fatalf("handler overwritten\n%s", b)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+const handlerTmpl = `package handler
+
+func {{.GoName}}Handler(ctx {{ident "context" "Context"}}, in *{{type .Input}}, out *{{type .Output}}) error {
+	return nil
+}
+`
+
+const serverTmpl = `package server
+
+// server is used to implement rpc methods, the methods are generated in {{.RegFile}}.
+type server struct {
+	{{ident .Proto (print "Unimplemented" .GoName "Server")}}
+}
+`
+
+const regTmpl = `// Code generated by protoc-gen-gamex. DO NOT EDIT.
+
+package server
+{{range .Methods}}
+func (s *server) {{.GoName}}(ctx {{ident "context" "Context"}}, in *{{type .Input}}) (*{{type .Output}}, error) {
+	var out = &{{type .Output}}{}
+	return out, {{ident $.Handler (print .GoName "Handler")}}(ctx, in, out)
+}
+{{end}}`
+
+const clientTmpl = `// Code generated by protoc-gen-gamex. DO NOT EDIT.
+
+package client
+
+{{$grpc := "google.golang.org/grpc"}}
+// Client is the typed {{.GoName}} client, servers are resolved by discover and picked by weight.
+type Client struct {
+	conn *{{ident $grpc "ClientConn"}}
+	cli  {{ident .Proto (print .GoName "Client")}}
+}
+
+// Dial dials target such as discover.Target of the service path with the discover weighted balancer.
+func Dial(target string, opts ...{{ident $grpc "DialOption"}}) (*Client, error) {
+	var config = "{\"loadBalancingPolicy\":\"" + {{ident .LB "Weighted"}} + "\"}"
+	opts = append([]{{ident $grpc "DialOption"}}{ {{- ident $grpc "WithDefaultServiceConfig"}}(config)}, opts...)
+	conn, err := {{ident $grpc "Dial"}}(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return New(conn), nil
+}
+
+// New wraps conn, it is closed by Close.
+func New(conn *{{ident $grpc "ClientConn"}}) *Client {
+	return &Client{conn: conn, cli: {{ident .Proto (print "New" .GoName "Client")}}(conn)}
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+{{range .Methods}}
+func (c *Client) {{.GoName}}(ctx {{ident "context" "Context"}}, in *{{type .Input}}, opts ...{{ident $grpc "CallOption"}}) (*{{type .Output}}, error) {
+	return c.cli.{{.GoName}}(ctx, in, opts...)
+}
+{{end}}`
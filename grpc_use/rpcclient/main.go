@@ -8,22 +8,36 @@ import (
 	"time"
 
 	"google.golang.org/grpc"
+	"rpcimpl/rpcserver/discover"
+	"rpcimpl/rpcserver/discover/path"
 	"rpcimpl/rpcserver/rpcproto"
+	"rpcimpl/rpcserver/rpcserver/gamex/client"
 )
 
 const (
-	address     = "localhost:50051"
 	defaultName = "RPC Cli"
 )
 
 func main() {
+	// Resolve gamex servers from etcd, picking by the weights they registered.
+	reg, err := discover.NewEtcdRegistry([]string{"localhost:2379"})
+	if err != nil {
+		log.Fatalf("etcd connect: %v", err)
+	}
+	defer reg.Close()
+	discover.RegisterResolver(reg)
+	var service = path.DefaultDiscoverPath{
+		Company:     "taiyouxi",
+		Version:     "1.0.0",
+		ServiceName: "gamex",
+	}
+
 	// Set up a connection to the server.
-	conn, err := grpc.Dial(address, grpc.WithInsecure(), grpc.WithBlock())
+	c, err := client.Dial(discover.Target(service), grpc.WithInsecure(), grpc.WithBlock())
 	if err != nil {
 		log.Fatalf("did not connect: %v", err)
 	}
-	defer conn.Close()
-	c := rpcproto.NewGameXClient(conn)
+	defer c.Close()
 
 	// Contact the server and print out its response.
 	name := defaultName
@@ -1,4 +1,5 @@
 #!/usr/bin/env bash
 
+go install ../protogen/protoc-gen-gamex
 protoc *.proto --go_out=plugins=grpc:./
-go run ../protogen/protogen.go $GOPATH
\ No newline at end of file
+protoc *.proto --gamex_out=.. --gamex_opt=root=..,Mmsg.proto=rpcimpl/rpcserver/rpcproto
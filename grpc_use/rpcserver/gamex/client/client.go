@@ -0,0 +1,44 @@
+// Code generated by protoc-gen-gamex. DO NOT EDIT.
+
+package client
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	lb "rpcimpl/rpcserver/discover/lb"
+	rpcproto "rpcimpl/rpcserver/rpcproto"
+)
+
+// Client is the typed GameX client, servers are resolved by discover and picked by weight.
+type Client struct {
+	conn *grpc.ClientConn
+	cli  rpcproto.GameXClient
+}
+
+// Dial dials target such as discover.Target of the service path with the discover weighted balancer.
+func Dial(target string, opts ...grpc.DialOption) (*Client, error) {
+	var config = "{\"loadBalancingPolicy\":\"" + lb.Weighted + "\"}"
+	opts = append([]grpc.DialOption{grpc.WithDefaultServiceConfig(config)}, opts...)
+	conn, err := grpc.Dial(target, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return New(conn), nil
+}
+
+// New wraps conn, it is closed by Close.
+func New(conn *grpc.ClientConn) *Client {
+	return &Client{conn: conn, cli: rpcproto.NewGameXClient(conn)}
+}
+
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) HelloGameX(ctx context.Context, in *rpcproto.HelloReq, opts ...grpc.CallOption) (*rpcproto.HelloRsp, error) {
+	return c.cli.HelloGameX(ctx, in, opts...)
+}
+
+func (c *Client) ByeGameX(ctx context.Context, in *rpcproto.ByeReq, opts ...grpc.CallOption) (*rpcproto.ByeRsp, error) {
+	return c.cli.ByeGameX(ctx, in, opts...)
+}
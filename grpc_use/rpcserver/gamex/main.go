@@ -1,12 +1,36 @@
 package main
 
-import "rpcimpl/rpcserver/rpcserver/gamex/server"
+import (
+	"log"
+
+	"rpcimpl/rpcserver/discover"
+	"rpcimpl/rpcserver/discover/path"
+	"rpcimpl/rpcserver/rpcserver/gamex/server"
+)
 
 const (
 	netType = "tcp"
 	port    = ":50051"
+	lease   = 5 //注册的租约秒数
 )
 
 func main() {
-	server.RunRPCService(netType, port)
+	reg, err := discover.NewEtcdRegistry([]string{"localhost:2379"})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	defer reg.Close()
+
+	var service = path.DefaultDiscoverPath{
+		Company:     "taiyouxi",
+		Version:     "1.0.0",
+		ServiceName: "gamex",
+	}
+	var ins = discover.Instance{
+		ID:      "gamex-1",
+		Addr:    "localhost" + port,
+		Weight:  1,
+		Version: "1.0.0",
+	}
+	server.RunRegisteredRPCService(netType, port, reg, service, ins, lease)
 }
@@ -3,8 +3,13 @@ package server
 import (
 	"log"
 	"net"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"google.golang.org/grpc"
+	"rpcimpl/rpcserver/discover"
+	"rpcimpl/rpcserver/discover/path"
 	"rpcimpl/rpcserver/rpcproto"
 )
 
@@ -15,12 +20,43 @@ type server struct {
 
 //RunRPCService simply run a rpc server.
 func RunRPCService(netType string, lisPort string) {
+	RunRegisteredRPCService(netType, lisPort, nil, nil, discover.Instance{}, 0)
+}
+
+//RunRegisteredRPCService run a rpc server registered as ins under p with a lease of lease seconds when reg is not nil.
+//On SIGTERM or interrupt ins is deregistered before the server stops, so clients move away first.
+func RunRegisteredRPCService(netType string, lisPort string, reg discover.Registry, p path.IServiceDiscoverPath, ins discover.Instance, lease int64) {
 	var lis, err = net.Listen(netType, lisPort)
 	if err != nil {
 		log.Fatalf("failed to listen: %v", err)
 	}
 	var s = grpc.NewServer()
 	rpcproto.RegisterGameXServer(s, &server{})
+
+	var ser *discover.ServiceRegister
+	if reg != nil {
+		if ser, err = discover.RegisterInstance(reg, p, ins, lease); err != nil {
+			log.Fatalf("failed to register: %v", err)
+		}
+		go func() {
+			for ok := range ser.Health() {
+				log.Printf("register %s healthy: %v", ins.ID, ok)
+			}
+		}()
+	}
+
+	var sigs = make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		log.Printf("receive signal %v, stopping", <-sigs)
+		if ser != nil {
+			if err := ser.Close(); err != nil {
+				log.Printf("failed to deregister: %v", err)
+			}
+		}
+		s.GracefulStop()
+	}()
+
 	if err := s.Serve(lis); err != nil {
 		log.Fatalf("failed to serve: %v", err)
 	}
@@ -0,0 +1,3 @@
+module github.com/akutz/memconn
+
+go 1.17
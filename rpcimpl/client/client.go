@@ -1,73 +1,670 @@
 package client
 
 import (
-	"encoding/binary"
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
+	"sync"
 	"time"
 
+	"tiny_rpc/codes"
 	"tiny_rpc/log"
 	"tiny_rpc/msg"
+	"tiny_rpc/trace"
+	"tiny_rpc/transport"
+	"tiny_rpc/util"
 )
 
+const (
+	HeartbeatDef = 10 * time.Second
+	ReadIdleDef  = 30 * time.Second
+	DialTimeout  = time.Second
+)
+
+var (
+	ErrShutdown     = errors.New("client connection is shut down")
+	ErrKicked       = errors.New("client kicked by another login")
+	errResumeReject = errors.New("client resume rejected")
+)
+
+// Call ----------------------------------------------------------------------------------------------------
+type Call struct {
+	Mode  uint32
+	Req   interface{}
+	Rsp   interface{}
+	Code  uint32
+	Error error
+	Done  chan *Call
+	Trace trace.SpanContext // span of the server handle, set when the server traces the call
+	seq   uint32
+	flag  msg.Flag
+	span  trace.SpanContext // span of the caller sent with the request
+}
+
+func (c *Call) done() {
+	select {
+	case c.Done <- c:
+	default:
+		log.Warn("client call mode %d done chan block, discard", c.Mode)
+	}
+}
+
+type encoder interface {
+	Encode(w io.Writer) error
+}
+
+// PushHandle handle server push data encoded with client Codec, called in the client receive goroutine.
+// data is owned by handle.
+type PushHandle func(data []byte)
+
+// Client ----------------------------------------------------------------------------------------------------
 type Client struct {
-	conn net.Conn
+	network string
+	address string
+	conn    net.Conn
+
+	wl sync.Mutex // guard write and conn swap on resume
+	w  *msg.Writer
+
+	codec msg.SerializerType
+
+	pl      sync.RWMutex
+	pushes  map[uint32]PushHandle
+	pushDef func(mode uint32, data []byte)
+
+	l        sync.Mutex // guard follows
+	seq      uint32
+	pending  map[uint32]*Call
+	closing  bool
+	shutdown bool
+	err      error
+
+	heartbeat time.Duration
+	readIdle  time.Duration
+	resume    time.Duration
+	token     []byte
+	done      chan struct{}
+	hbChange  chan struct{} // wakes keepalive when heartbeat changed
+	ready     chan struct{} // closed when a resume in progress ends, nil when not resuming
+
+	want *msg.Transform // frame flags asked in handshake, restores incoming frames, guarded by l
+	tf   *msg.Transform // negotiated, guarded by wl
 }
 
 func NewClient(network, address string) *Client {
-	var conn, err = net.DialTimeout(network, address, time.Second)
+	var c = &Client{
+		network:   network,
+		address:   address,
+		pending:   make(map[uint32]*Call),
+		pushes:    make(map[uint32]PushHandle),
+		codec:     msg.DefSerializer(),
+		heartbeat: HeartbeatDef,
+		readIdle:  ReadIdleDef,
+		done:      make(chan struct{}),
+		hbChange:  make(chan struct{}, 1),
+	}
+	var conn, err = transport.Dial(network, address, DialTimeout)
 	if err != nil {
 		log.Error("NewClient err %v", err)
+		c.shutdown = true
+		c.err = err
+		close(c.done)
+		return c
 	}
-	return &Client{
-		conn: conn,
+	c.conn = conn
+	c.w = msg.NewWriter(conn)
+	go c.receive()
+	go c.keepalive()
+	return c
+}
+
+// SetCodec sets the serializer of the client frames, call it before any call.
+// Default is msg.DefSerializer when the client created.
+func (c *Client) SetCodec(codec msg.SerializerType) {
+	c.codec = codec
+}
+
+// Codec returns the client serializer, push data is encoded with it.
+func (c *Client) Codec() msg.SerializerType {
+	return c.codec
+}
+
+// SetHeartbeat sets the ping interval and the read idle timeout, the connection is treated
+// as lost when nothing received in readIdle. Zero disables each.
+// It applies to a running client: the ping ticker restarts and the next read uses readIdle.
+func (c *Client) SetHeartbeat(interval, readIdle time.Duration) {
+	c.l.Lock()
+	c.heartbeat = interval
+	c.readIdle = readIdle
+	c.l.Unlock()
+	select {
+	case c.hbChange <- struct{}{}:
+	default:
 	}
 }
 
-func (c *Client) Call(mode uint32, req interface{}, rsp interface{}) (uint32, error) {
-	var baseReq = new(msg.RequestBase)
-	var data, _ = msg.Marshal(req)
-	baseReq.FillIn(mode, data)
-	var streamSlice = make([]byte, baseReq.Len+4+1+4)
-	binary.BigEndian.PutUint32(streamSlice[0:4], baseReq.Len)
-	streamSlice[4] = byte(baseReq.MType)
-	binary.BigEndian.PutUint32(streamSlice[5:9], baseReq.Mode)
-	copy(streamSlice[9:], baseReq.Data)
-	n, err := c.conn.Write(streamSlice)
+// SetResume enables reconnect when the connection lost after Login, the client retries
+// within window and resumes the server session, pending calls keep waiting meanwhile.
+func (c *Client) SetResume(window time.Duration) {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.resume = window
+}
+
+// SetTransform sets the frame flags asked in Login, such as compression and encryption.
+// key is the AES key shared with server for msg.FlagEncrypt. Call it before Login.
+// The login and resume handshakes are not encrypted, see net.SessionMgr.SetTransform.
+func (c *Client) SetTransform(flag msg.Flag, key []byte) error {
+	var tf, err = msg.NewTransform(flag, key)
 	if err != nil {
-		return 0, fmt.Errorf("Client Call %v  %v", n, err)
+		return err
 	}
+	c.l.Lock()
+	c.want = tf
+	c.l.Unlock()
+	return nil
+}
 
-	var slice4byte = make([]byte, 4)
-	n, err = io.ReadFull(c.conn, slice4byte)
+// wanted returns the transform asked in handshake.
+func (c *Client) wanted() *msg.Transform {
+	c.l.Lock()
+	defer c.l.Unlock()
+	return c.want
+}
+
+// Go invokes mode asynchronously, the call is sent to done when finished.
+// A nil done allocates a new channel, a non-nil done must be buffered.
+// A call made while the session is being resumed waits for the resume.
+func (c *Client) Go(mode uint32, req interface{}, rsp interface{}, done chan *Call) *Call {
+	return c.goCtx(context.Background(), mode, req, rsp, done)
+}
+
+// goCtx is Go sending the span of ctx with the request, it stops waiting for a resume when ctx done.
+func (c *Client) goCtx(ctx context.Context, mode uint32, req interface{}, rsp interface{}, done chan *Call) *Call {
+	var call = &Call{
+		Mode: mode,
+		Req:  req,
+		Rsp:  rsp,
+		span: trace.FromContext(ctx),
+	}
+	if done == nil {
+		done = make(chan *Call, 1)
+	} else if cap(done) == 0 {
+		panic("client done channel is unbuffered")
+	}
+	call.Done = done
+
+	var data, err = msg.MarshalWith(c.codec, req)
 	if err != nil {
-		return 0, fmt.Errorf("Client read packet len err %v  %v", n, err)
+		call.Error = fmt.Errorf("client marshal mode %d err %w", mode, err)
+		call.done()
+		return call
 	}
-	var l = binary.BigEndian.Uint32(slice4byte)
+	c.send(ctx, call, data)
+	return call
+}
+
+// Call invokes mode and waits for the response.
+// A non-zero code is returned with an error matching codes.Err(code) by errors.Is.
+func (c *Client) Call(mode uint32, req interface{}, rsp interface{}) (uint32, error) {
+	return c.CallContext(context.Background(), mode, req, rsp)
+}
+
+// CallTimeout invokes mode and waits at most timeout for the response.
+func (c *Client) CallTimeout(timeout time.Duration, mode uint32, req interface{}, rsp interface{}) (uint32, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return c.CallContext(ctx, mode, req, rsp)
+}
+
+// CallContext invokes mode and waits for the response until ctx is done.
+// The trace carried by ctx is sent with the request, see trace.Start.
+func (c *Client) CallContext(ctx context.Context, mode uint32, req interface{}, rsp interface{}) (uint32, error) {
+	var span *trace.Span
+	ctx, span = trace.Start(ctx, "call", log.Mode(mode))
+	var code, err = c.wait(ctx, c.goCtx(ctx, mode, req, rsp, make(chan *Call, 1)))
+	span.SetAttrs(log.F("code", code))
+	span.End(err)
+	return code, err
+}
 
-	var t = make([]byte, 1)
-	n, err = io.ReadFull(c.conn, t)
+func (c *Client) wait(ctx context.Context, call *Call) (uint32, error) {
+	select {
+	case <-call.Done:
+		return call.Code, call.Error
+	case <-ctx.Done():
+		c.l.Lock()
+		if c.pending[call.seq] == call {
+			delete(c.pending, call.seq)
+		}
+		c.l.Unlock()
+		return 0, fmt.Errorf("client call mode %d %w", call.Mode, ctx.Err())
+	}
+}
+
+// Notify sends a one-way message, no response will be returned.
+func (c *Client) Notify(mode uint32, req interface{}) error {
+	var data, err = msg.MarshalWith(c.codec, req)
 	if err != nil {
-		return 0, fmt.Errorf("Client read packet type err %v  %v", n, err)
+		return fmt.Errorf("client marshal mode %d err %w", mode, err)
 	}
 
-	n, err = io.ReadFull(c.conn, slice4byte)
+	c.l.Lock()
+	if c.shutdown || c.closing {
+		err = ErrShutdown
+		if c.err != nil {
+			err = c.err
+		}
+	}
+	c.l.Unlock()
 	if err != nil {
-		return 0, fmt.Errorf("Client read packet code err %v  %v", n, err)
+		return err
+	}
+	_ = c.waitResume(context.Background())
+
+	var baseNotify = new(msg.NotifyBase)
+	baseNotify.FillIn(mode, data)
+	baseNotify.SetCodec(c.codec)
+
+	c.wl.Lock()
+	defer c.wl.Unlock()
+	if err = c.tf.Pack(baseNotify); err != nil {
+		return fmt.Errorf("client pack mode %d err %w", mode, err)
 	}
-	var code = binary.BigEndian.Uint32(slice4byte)
+	if err = c.writeFrame(baseNotify); err != nil {
+		return fmt.Errorf("client write mode %d err %w", mode, err)
+	}
+	return nil
+}
+
+// RegPush registers handle for server push mode, handle should not block.
+func (c *Client) RegPush(mode uint32, handle PushHandle) {
+	c.pl.Lock()
+	defer c.pl.Unlock()
+	c.pushes[mode] = handle
+}
 
-	var payload = make([]byte, l)
-	n, err = io.ReadFull(c.conn, payload)
+// RegPushDefault registers handle for server push modes without RegPush.
+func (c *Client) RegPushDefault(handle func(mode uint32, data []byte)) {
+	c.pl.Lock()
+	defer c.pl.Unlock()
+	c.pushDef = handle
+}
+
+// Login sends the login handshake, it must be the first call when server requires authentication.
+// token is passed to server Authenticator as is.
+func (c *Client) Login(ctx context.Context, token []byte) (uint32, error) {
+	var resumeToken []byte
+	var call = &Call{
+		Mode: msg.ModeLogin,
+		Rsp:  &resumeToken,
+		Done: make(chan *Call, 1),
+	}
+	c.send(ctx, call, token)
+	var code, err = c.wait(ctx, call)
+	if err == nil && code == 0 {
+		c.l.Lock()
+		c.token = resumeToken
+		c.l.Unlock()
+		var tf = c.wanted().Negotiate(call.flag)
+		c.wl.Lock()
+		c.tf = tf
+		c.wl.Unlock()
+	}
+	return code, err
+}
+
+func (c *Client) send(ctx context.Context, call *Call, data []byte) {
+	if err := c.waitResume(ctx); err != nil {
+		call.Error = fmt.Errorf("client call mode %d %w", call.Mode, err)
+		call.done()
+		return
+	}
+	c.l.Lock()
+	if c.shutdown || c.closing {
+		call.Error = ErrShutdown
+		if c.err != nil {
+			call.Error = c.err
+		}
+		c.l.Unlock()
+		call.done()
+		return
+	}
+	c.seq++
+	var seq = c.seq
+	call.seq = seq
+	c.pending[seq] = call
+	var want = c.want
+	c.l.Unlock()
+
+	var baseReq = new(msg.RequestBase)
+	baseReq.FillIn(call.Mode, data)
+	baseReq.SetSeq(seq)
+	baseReq.SetCodec(c.codec)
+
+	c.wl.Lock()
+	var err error
+	if call.Mode == msg.ModeLogin {
+		// handshake is not transformed, flag asks for the negotiation
+		baseReq.SetFlag(want.Flag())
+	} else {
+		baseReq.SetTrace(call.span.TraceID, call.span.SpanID)
+		err = c.tf.Pack(baseReq)
+	}
+	if err == nil {
+		err = c.writeFrame(baseReq)
+	}
+	c.wl.Unlock()
 	if err != nil {
-		return 0, fmt.Errorf("Client read packet payload err %v  %v", n, err)
+		c.l.Lock()
+		call = c.pending[seq]
+		delete(c.pending, seq)
+		c.l.Unlock()
+		if call != nil {
+			call.Error = fmt.Errorf("client write mode %d err %w", call.Mode, err)
+			call.done()
+		}
+	}
+}
+
+func (c *Client) receive() {
+	var err error
+	for {
+		c.l.Lock()
+		var conn = c.conn
+		c.l.Unlock()
+
+		err = c.read(conn)
+		if !c.reconnect(err) {
+			break
+		}
+	}
+	close(c.done)
+
+	// terminate pending calls
+	c.l.Lock()
+	c.shutdown = true
+	var closing = c.closing
+	switch {
+	case closing || transport.IsClosed(err):
+		err = ErrShutdown
+	case errors.Is(err, ErrKicked):
+		log.Info("client kicked by another login")
+	default:
+		log.Error("client receive err %v", err)
+	}
+	c.err = err
+	for seq, call := range c.pending {
+		delete(c.pending, seq)
+		call.Error = err
+		call.done()
+	}
+	c.l.Unlock()
+}
+
+// writeFrame encodes m and flushes it in one write, called with wl held.
+func (c *Client) writeFrame(m encoder) error {
+	if err := m.Encode(c.w); err != nil {
+		return err
+	}
+	return c.w.Flush()
+}
+
+func (c *Client) read(conn net.Conn) error {
+	var r = msg.NewReader(conn)
+	for {
+		c.l.Lock()
+		var readIdle = c.readIdle
+		c.l.Unlock()
+		if readIdle > 0 {
+			_ = conn.SetReadDeadline(time.Now().Add(readIdle))
+		}
+		// push and response share the frame layout, code is the mode for push
+		var baseRsp = new(msg.ResponseBase)
+		if err := baseRsp.Decode(r); err != nil {
+			return err
+		}
+
+		switch baseRsp.MsgType() {
+		case msg.MTypeRpc:
+			c.handleResponse(baseRsp)
+		case msg.MTypePush:
+			if baseRsp.GetCode() == msg.ModeKick {
+				// the session is closed by server, not resumed
+				baseRsp.Release()
+				_ = conn.Close()
+				return ErrKicked
+			}
+			if err := c.wanted().Unpack(baseRsp); err != nil {
+				log.Error("client push mode %d unpack err %v", baseRsp.GetCode(), err)
+				continue
+			}
+			c.handlePush(baseRsp.GetCode(), baseRsp.GetData())
+		case msg.MTypePong:
+			baseRsp.Release()
+		default:
+			log.Warn("client receive illegal msg type %v", baseRsp.MsgType())
+		}
+	}
+}
+
+// keepalive sends ping every heartbeat interval until the client shutdown,
+// the interval is read again when SetHeartbeat changes it.
+func (c *Client) keepalive() {
+	var ticker *time.Ticker
+	var tick <-chan time.Time
+	defer func() {
+		if ticker != nil {
+			ticker.Stop()
+		}
+	}()
+	var reset = func() {
+		c.l.Lock()
+		var interval = c.heartbeat
+		c.l.Unlock()
+		if ticker != nil {
+			ticker.Stop()
+			ticker, tick = nil, nil
+		}
+		if interval > 0 {
+			ticker = time.NewTicker(interval)
+			tick = ticker.C
+		}
+	}
+	reset()
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-c.hbChange:
+			reset()
+			continue
+		case <-tick:
+		}
+		var ping = new(msg.PingBase)
+		ping.FillIn(0, nil)
+		c.wl.Lock()
+		var err = c.tf.Pack(ping)
+		if err == nil {
+			err = c.writeFrame(ping)
+		}
+		c.wl.Unlock()
+		if err != nil {
+			log.Debug("client ping err %v", err)
+		}
+	}
+}
+
+// reconnect dials again and resumes the session when resume enabled, calls wait for it
+// in waitResume until their ctx done. wl is held only for the handshake and the conn swap.
+func (c *Client) reconnect(cause error) bool {
+	c.l.Lock()
+	var window, token, closing = c.resume, c.token, c.closing
+	if !closing && window > 0 && len(token) > 0 && !errors.Is(cause, ErrKicked) {
+		c.ready = make(chan struct{})
 	}
+	var ready = c.ready
+	c.l.Unlock()
+	if ready == nil {
+		return false
+	}
+	defer func() {
+		c.l.Lock()
+		c.ready = nil
+		c.l.Unlock()
+		close(ready)
+	}()
+	log.Info("client connection lost %v, resume in %v", cause, window)
+
+	var deadline = time.Now().Add(window)
+	var backoff = 100 * time.Millisecond
+	for time.Now().Before(deadline) {
+		var conn, err = transport.Dial(c.network, c.address, DialTimeout)
+		if err == nil {
+			c.wl.Lock()
+			err = c.resumeConn(conn, token)
+			if err == nil {
+				c.l.Lock()
+				closing = c.closing
+				if !closing {
+					c.conn = conn
+					c.w = msg.NewWriter(conn)
+				}
+				c.l.Unlock()
+			}
+			c.wl.Unlock()
+			if err == nil {
+				if closing {
+					conn.Close()
+					return false
+				}
+				log.Info("client session resumed")
+				return true
+			}
+			conn.Close()
+			if errors.Is(err, errResumeReject) {
+				log.Error("client resume err %v", err)
+				return false
+			}
+		}
+		log.Debug("client resume err %v, retry in %v", err, backoff)
 
-	msg.Unmarshal(payload, rsp)
-	return code, nil
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > 2*time.Second {
+			backoff = 2 * time.Second
+		}
+		c.l.Lock()
+		closing = c.closing
+		c.l.Unlock()
+		if closing {
+			return false
+		}
+	}
+	return false
+}
+
+// waitResume waits until the resume in progress ends or ctx done.
+func (c *Client) waitResume(ctx context.Context) error {
+	c.l.Lock()
+	var ready = c.ready
+	c.l.Unlock()
+	if ready == nil {
+		return nil
+	}
+	select {
+	case <-ready:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// resumeConn sends the resume handshake on conn and waits for the response, called with wl held.
+func (c *Client) resumeConn(conn net.Conn, token []byte) error {
+	_ = conn.SetDeadline(time.Now().Add(DialTimeout))
+	defer conn.SetDeadline(time.Time{})
+
+	var baseReq = new(msg.RequestBase)
+	baseReq.FillIn(msg.ModeResume, token)
+	baseReq.SetCodec(msg.SerializerRaw)
+	baseReq.SetFlag(c.tf.Flag())
+	if err := baseReq.Encode(conn); err != nil {
+		return err
+	}
+	var baseRsp = new(msg.ResponseBase)
+	if err := baseRsp.Decode(conn); err != nil {
+		return err
+	}
+	if baseRsp.MsgType() != msg.MTypeRpc || baseRsp.GetCode() != 0 {
+		return fmt.Errorf("%w type %v code %d", errResumeReject, baseRsp.MsgType(), baseRsp.GetCode())
+	}
+	c.tf = c.wanted().Negotiate(baseRsp.GetFlag())
+	return nil
+}
+
+func (c *Client) handleResponse(baseRsp *msg.ResponseBase) {
+	defer baseRsp.Release()
+	var seq = baseRsp.GetSeq()
+	c.l.Lock()
+	var call = c.pending[seq]
+	delete(c.pending, seq)
+	c.l.Unlock()
+
+	if call == nil {
+		// call canceled or timeout
+		log.Debug("client receive seq %d without pending call", seq)
+		return
+	}
+	call.Code = baseRsp.GetCode()
+	if call.Code != codes.OK {
+		call.Error = fmt.Errorf("client call mode %d %w", call.Mode, codes.Err(call.Code))
+	}
+	call.flag = baseRsp.GetFlag()
+	call.Trace.TraceID, call.Trace.SpanID = baseRsp.GetTrace()
+	if call.Mode != msg.ModeLogin {
+		if err := c.wanted().Unpack(baseRsp); err != nil {
+			call.Error = fmt.Errorf("client unpack mode %d err %w", call.Mode, err)
+			call.done()
+			return
+		}
+	}
+	// data of a failed call is optional
+	if call.Rsp == nil || call.Error != nil && len(baseRsp.GetData()) == 0 {
+		call.done()
+		return
+	}
+	if err := msg.UnmarshalWith(baseRsp.GetCodec(), baseRsp.GetData(), call.Rsp); err != nil && call.Error == nil {
+		call.Error = fmt.Errorf("client unmarshal mode %d err %w", call.Mode, err)
+	}
+	call.done()
+}
+
+func (c *Client) handlePush(mode uint32, data []byte) {
+	c.pl.RLock()
+	var handle, def = c.pushes[mode], c.pushDef
+	c.pl.RUnlock()
+
+	defer util.InfoPanic("client push mode %d", mode)
+	switch {
+	case handle != nil:
+		handle(data)
+	case def != nil:
+		def(mode, data)
+	default:
+		log.Warn("client push mode %d handle not find", mode)
+	}
 }
 
 func (c *Client) Close() {
-	c.conn.Close()
+	c.l.Lock()
+	if c.closing || c.conn == nil {
+		c.l.Unlock()
+		return
+	}
+	c.closing = true
+	var conn = c.conn
+	c.l.Unlock()
+	conn.Close()
 }
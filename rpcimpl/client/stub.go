@@ -0,0 +1,15 @@
+// Code generated by protogen. DO NOT EDIT.
+
+package client
+
+import (
+	"context"
+
+	"tiny_rpc/proto"
+)
+
+func (c *Client) Hello(ctx context.Context, req *proto.HelloReq) (*proto.HelloRsp, uint32, error) {
+	var rsp = new(proto.HelloRsp)
+	code, err := c.CallContext(ctx, proto.Hello, req, rsp)
+	return rsp, code, err
+}
@@ -0,0 +1,98 @@
+// Package codes is the response code space shared by server and client.
+// Codes from Reserved up are used by the framework, handlers use codes below it and may register
+// them so clients get named errors.
+package codes
+
+import (
+	"fmt"
+	"sync"
+)
+
+const OK uint32 = 0
+
+// framework reserved codes
+const (
+	Reserved uint32 = 0xFFFF0000
+
+	Panic       uint32 = Reserved + iota // handle panic, 0xFFFF0001
+	RateLimit                            // request rejected by rate limit
+	Unauth                               // request rejected by auth check
+	UnknownMode                          // no handle for the mode
+	DecodeFail                           // request data unmarshal fail
+	Shutdown                             // server shutting down, request not served
+	Internal                             // response marshal fail or other server error
+	AuthFail                             // login or resume handshake rejected
+)
+
+// Error ----------------------------------------------------------------------------------------------------
+
+// Error is the error of a non-zero code, errors of the same code match by errors.Is.
+type Error struct {
+	Code uint32
+	Msg  string
+}
+
+func (e *Error) Error() string {
+	if e.Msg == "" {
+		return fmt.Sprintf("code %d", e.Code)
+	}
+	return fmt.Sprintf("code %d %s", e.Code, e.Msg)
+}
+
+func (e *Error) Is(target error) bool {
+	var t, ok = target.(*Error)
+	return ok && t.Code == e.Code
+}
+
+// registry ----------------------------------------------------------------------------------------------------
+
+var registry = struct {
+	l sync.RWMutex
+	m map[uint32]*Error
+}{m: make(map[uint32]*Error)}
+
+// Register names code and returns its error, it panics when code is OK or already registered.
+// Register at init so server and client share the errors.
+func Register(code uint32, msg string) *Error {
+	if code == OK {
+		panic("codes register OK")
+	}
+	registry.l.Lock()
+	defer registry.l.Unlock()
+	if e, ok := registry.m[code]; ok {
+		panic(fmt.Sprintf("codes %d already registered as %q", code, e.Msg))
+	}
+	var e = &Error{Code: code, Msg: msg}
+	registry.m[code] = e
+	return e
+}
+
+// Err returns the error of code, nil for OK. Codes not registered get an Error without message.
+func Err(code uint32) error {
+	if code == OK {
+		return nil
+	}
+	registry.l.RLock()
+	var e, ok = registry.m[code]
+	registry.l.RUnlock()
+	if ok {
+		return e
+	}
+	return &Error{Code: code}
+}
+
+// IsReserved reports whether code is a framework code.
+func IsReserved(code uint32) bool {
+	return code >= Reserved
+}
+
+var (
+	ErrPanic       = Register(Panic, "handle panic")
+	ErrRateLimit   = Register(RateLimit, "rate limited")
+	ErrUnauth      = Register(Unauth, "unauthenticated")
+	ErrUnknownMode = Register(UnknownMode, "unknown mode")
+	ErrDecodeFail  = Register(DecodeFail, "request decode fail")
+	ErrShutdown    = Register(Shutdown, "server shutting down")
+	ErrInternal    = Register(Internal, "server internal error")
+	ErrAuthFail    = Register(AuthFail, "auth fail")
+)
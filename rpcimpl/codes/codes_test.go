@@ -0,0 +1,36 @@
+package codes
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestErr(t *testing.T) {
+	if Err(OK) != nil {
+		t.Fatal("OK err not nil")
+	}
+	if Panic != 0xFFFF0001 || !IsReserved(AuthFail) || IsReserved(1) {
+		t.Fatalf("reserved codes %x %x", Panic, AuthFail)
+	}
+
+	var err = fmt.Errorf("call mode 1 %w", Err(UnknownMode))
+	if !errors.Is(err, ErrUnknownMode) || errors.Is(err, ErrDecodeFail) {
+		t.Fatalf("errors is %v", err)
+	}
+
+	var app = Register(100, "no gold")
+	if !errors.Is(Err(100), app) || Err(100).Error() != "code 100 no gold" {
+		t.Fatalf("app code err %v", Err(100))
+	}
+	if !errors.Is(Err(101), &Error{Code: 101}) {
+		t.Fatal("unregistered code err")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("duplicate register not panic")
+		}
+	}()
+	Register(100, "dup")
+}
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"time"
 
 	"tiny_rpc/client"
+	"tiny_rpc/codes"
 	"tiny_rpc/log"
 	"tiny_rpc/msg"
 	"tiny_rpc/proto"
@@ -21,6 +23,15 @@ func main() {
 	msg.SetSerializer(msg.SerializerPB)
 	var cli = client.NewClient(network, address)
 	defer cli.Close()
+	cli.SetResume(msg.ResumeWindowDef)
+	if err := cli.SetTransform(msg.FlagCRC|msg.FlagZstd, nil); err != nil {
+		log.Error("client set transform err %v", err)
+		return
+	}
+	if code, err := cli.Login(context.Background(), []byte("zhang")); err != nil || code != codes.OK {
+		log.Error("client login code %v err %v", code, err)
+		return
+	}
 	var req = &proto.HelloReq{
 		HelloMsg: "hello",
 	}
@@ -30,7 +41,7 @@ func main() {
 	for {
 		select {
 		case <-ticker.C:
-			code, err := cli.Call(proto.Hello, req, rsp)
+			code, err := cli.CallTimeout(time.Second, proto.Hello, req, rsp)
 			if err != nil {
 				return
 			}
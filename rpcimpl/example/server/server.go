@@ -1,13 +1,25 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
 	"tiny_rpc/log"
+	"tiny_rpc/msg"
+	"tiny_rpc/net"
 	"tiny_rpc/server"
 )
 
 const (
 	network = "tcp"
 	address = "localhost:8972"
+	admin   = "localhost:8973"
+
+	shutdownTimeout = 10 * time.Second
 )
 
 func main() {
@@ -16,6 +28,30 @@ func main() {
 	defer log.Info("Stop..")
 
 	var ser = server.NewServer(network, address)
-	defer ser.Close()
-	ser.Serve()
+	// token is account id for example
+	ser.SessionMgr().SetAuthenticator(net.AuthFunc(func(data []byte) (string, error) {
+		if len(data) == 0 {
+			return "", errors.New("empty token")
+		}
+		return string(data), nil
+	}), 0)
+	if err := ser.SessionMgr().SetTransform(msg.FlagCRC|msg.FlagSnappy|msg.FlagZstd, nil); err != nil {
+		log.Error("server set transform err %v", err)
+		return
+	}
+	if err := ser.ListenAdmin(admin); err != nil {
+		log.Error("server listen admin err %v", err)
+		return
+	}
+	go ser.Serve()
+
+	var sig = make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGINT, syscall.SIGTERM)
+	<-sig
+
+	var ctx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := ser.Shutdown(ctx); err != nil {
+		log.Error("server shutdown err %v", err)
+	}
 }
@@ -1,6 +1,7 @@
 package hello
 
 import (
+	"tiny_rpc/codes"
 	"tiny_rpc/log"
 	"tiny_rpc/model"
 	"tiny_rpc/msg"
@@ -13,16 +14,25 @@ type HelloProto struct {
 }
 
 func (HelloProto) Serve(ctx router.ContextInterface, baseReq msg.ModeMsg, baseRsp msg.CodeMsg) {
-	var account, ok = (ctx).(*model.PlayerAccount)
-	if ok {
-		var req = new(proto.HelloReq)
-		var rsp = new(proto.HelloRsp)
-		_ = msg.Unmarshal(baseReq.GetData(), req)
-		var r = &HelloProto{HelloReq: req}
-		var code = r.HelloHandle(account, rsp)
-		var data, _ = msg.Marshal(rsp)
-		baseRsp.FillIn(code, data)
+	var account, ok = router.AccountOf(ctx).(*model.PlayerAccount)
+	if !ok {
+		baseRsp.FillIn(codes.Unauth, nil)
+		return
 	}
+	var req = new(proto.HelloReq)
+	var rsp = new(proto.HelloRsp)
+	if err := msg.UnmarshalWith(baseReq.GetCodec(), baseReq.GetData(), req); err != nil {
+		baseRsp.FillIn(codes.DecodeFail, nil)
+		return
+	}
+	var r = &HelloProto{HelloReq: req}
+	var code = r.HelloHandle(account, rsp)
+	var data, err = msg.MarshalWith(baseRsp.GetCodec(), rsp)
+	if err != nil {
+		baseRsp.FillIn(codes.Internal, nil)
+		return
+	}
+	baseRsp.FillIn(code, data)
 }
 
 func (r *HelloProto) HelloHandle(a *model.PlayerAccount, rsp *proto.HelloRsp) (code uint32) {
@@ -1,19 +1,31 @@
 package hello
 
 import (
+	"context"
+
+	"tiny_rpc/codes"
 	"tiny_rpc/log"
 	"tiny_rpc/model"
 	"tiny_rpc/module"
 	"tiny_rpc/proto"
+	"tiny_rpc/router"
 )
 
-func HelloHandle(a *model.PlayerAccount, req *proto.HelloReq, rsp *proto.HelloRsp) (code uint32) {
+func HelloHandle(ctx *router.Context, req *proto.HelloReq, rsp *proto.HelloRsp) (code uint32) {
+	var a, ok = router.AccountOf(ctx).(*model.PlayerAccount)
+	if !ok {
+		return codes.Unauth
+	}
 	log.Info("account %v receive %v", a.AccountId, req.HelloMsg)
 
+	// module work joins the request trace by ctx
+	var wctx, cancel = context.WithTimeout(ctx, module.SyncTimeoutDef)
+	defer cancel()
 	replay := &proto.HelloReplay{}
-	err := module.SyncWork(module.MA, module.MA_Hello, &proto.HelloArg{Msg: "ma"}, replay)
+	err := module.SyncWorkCtx(wctx, module.MA, module.MA_Hello, &proto.HelloArg{Msg: "ma"}, replay)
 	if err != nil {
 		log.Error("%v", err)
+		return module.Code(err)
 	}
 	rsp.ReplyMsg = replay.Msg
 	return
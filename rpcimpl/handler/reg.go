@@ -7,6 +7,9 @@ import (
 )
 
 func Init(t router.Type) {
+	router.ResetInterceptors()
+	router.Use(router.RecoverInterceptor(), router.LogInterceptor())
+
 	switch t {
 	case router.MappingRouterType:
 		{
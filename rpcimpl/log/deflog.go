@@ -1,69 +1,52 @@
 package log
 
 import (
-	"fmt"
 	"log"
 	"os"
 
 	"github.com/fatih/color"
 )
 
-const calldepth = 3
+var levelColors = [...]string{
+	DebugLevel: "DEBUG",
+	InfoLevel:  color.GreenString("INFO "),
+	WarnLevel:  color.YellowString("WARN "),
+	ErrorLevel: color.RedString("ERROR"),
+}
 
+// DefaultLogger writes to a std log with colored levels.
 type DefaultLogger struct {
 	*log.Logger
-}
-
-func (l *DefaultLogger) Debug(v ...interface{}) {
-	_ = l.Output(calldepth, header("DEBUG", fmt.Sprint(v...)))
-}
-
-func (l *DefaultLogger) Debugf(format string, v ...interface{}) {
-	_ = l.Output(calldepth, header("DEBUG", fmt.Sprintf(format, v...)))
-}
-
-func (l *DefaultLogger) Info(v ...interface{}) {
-	_ = l.Output(calldepth, header(color.GreenString("INFO "), fmt.Sprint(v...)))
-}
-
-func (l *DefaultLogger) Infof(format string, v ...interface{}) {
-	_ = l.Output(calldepth, header(color.GreenString("INFO "), fmt.Sprintf(format, v...)))
-}
-
-func (l *DefaultLogger) Warn(v ...interface{}) {
-	_ = l.Output(calldepth, header(color.YellowString("WARN "), fmt.Sprint(v...)))
-}
-
-func (l *DefaultLogger) Warnf(format string, v ...interface{}) {
-	_ = l.Output(calldepth, header(color.YellowString("WARN "), fmt.Sprintf(format, v...)))
-}
-
-func (l *DefaultLogger) Error(v ...interface{}) {
-	_ = l.Output(calldepth, header(color.RedString("ERROR"), fmt.Sprint(v...)))
-}
-
-func (l *DefaultLogger) Errorf(format string, v ...interface{}) {
-	_ = l.Output(calldepth, header(color.RedString("ERROR"), fmt.Sprintf(format, v...)))
-}
-
-func (l *DefaultLogger) Fatal(v ...interface{}) {
-	_ = l.Output(calldepth, header(color.MagentaString("FATAL"), fmt.Sprint(v...)))
-	os.Exit(1)
-}
-
-func (l *DefaultLogger) Fatalf(format string, v ...interface{}) {
-	_ = l.Output(calldepth, header(color.MagentaString("FATAL"), fmt.Sprintf(format, v...)))
-	os.Exit(1)
-}
-
-func (l *DefaultLogger) Panic(v ...interface{}) {
-	l.Logger.Panic(v...)
-}
-
-func (l *DefaultLogger) Panicf(format string, v ...interface{}) {
-	l.Logger.Panicf(format, v...)
-}
-
-func header(lvl, msg string) string {
-	return fmt.Sprintf("%s: %s", lvl, msg)
+	json bool
+}
+
+func newDefLog(o options) *DefaultLogger {
+	var out = o.out
+	if out == nil {
+		out = os.Stderr
+	}
+	var flag = log.LstdFlags
+	if o.json {
+		flag = 0
+	}
+	return &DefaultLogger{Logger: log.New(out, "", flag), json: o.json}
+}
+
+func (l *DefaultLogger) Write(e *Entry) {
+	var b []byte
+	if l.json {
+		b = appendJSON(b, e)
+	} else {
+		b = append(b, header(e.Level)...)
+		b = append(b, ": "...)
+		b = appendText(b, e)
+	}
+	_ = l.Output(0, string(b))
+}
+
+func header(lvl Level) string {
+	if lvl >= 0 && int(lvl) < len(levelColors) {
+		return levelColors[lvl]
+	}
+	return lvl.String()
 }
@@ -0,0 +1,108 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const timeFormat = "2006-01-02 15:04:05"
+
+// appendText appends "msg caller k=v", time and level are written by the backend.
+func appendText(b []byte, e *Entry) []byte {
+	b = append(b, e.Msg...)
+	b = append(b, ' ')
+	b = append(b, e.Caller...)
+	for _, f := range e.Fields {
+		b = append(b, ' ')
+		b = append(b, f.Key...)
+		b = append(b, '=')
+		var s = fmt.Sprint(f.Value)
+		if s == "" || strings.ContainsAny(s, " \t\n\"=") {
+			b = strconv.AppendQuote(b, s)
+		} else {
+			b = append(b, s...)
+		}
+	}
+	return b
+}
+
+// appendJSON appends one JSON object line.
+func appendJSON(b []byte, e *Entry) []byte {
+	b = append(b, `{"time":`...)
+	b = AppendJSONString(b, e.Time.Format(timeFormat))
+	b = append(b, `,"level":`...)
+	b = AppendJSONString(b, e.Level.String())
+	b = append(b, `,"caller":`...)
+	b = AppendJSONString(b, e.Caller)
+	b = append(b, `,"msg":`...)
+	b = AppendJSONString(b, e.Msg)
+	for _, f := range e.Fields {
+		b = append(b, ',')
+		b = AppendJSONString(b, f.Key)
+		b = append(b, ':')
+		b = AppendJSONValue(b, f.Value)
+	}
+	return append(b, '}', '\n')
+}
+
+// AppendJSONValue appends v as a JSON value, errors and Stringers as quoted strings,
+// values json can not marshal as quoted fmt.Sprint. It is shared by the encoders of fields.
+func AppendJSONValue(b []byte, v interface{}) []byte {
+	switch v := v.(type) {
+	case error:
+		return AppendJSONString(b, v.Error())
+	case fmt.Stringer:
+		return AppendJSONString(b, v.String())
+	}
+	var data, err = json.Marshal(v)
+	if err != nil {
+		return AppendJSONString(b, fmt.Sprint(v))
+	}
+	return append(b, data...)
+}
+
+// AppendJSONString appends s as a quoted JSON string, control bytes are escaped as \u00XX
+// and invalid UTF-8 is replaced by U+FFFD, as encoding/json does.
+func AppendJSONString(b []byte, s string) []byte {
+	const hex = "0123456789abcdef"
+	b = append(b, '"')
+	var start = 0
+	for i := 0; i < len(s); {
+		if c := s[i]; c < utf8.RuneSelf {
+			if c >= 0x20 && c != '"' && c != '\\' {
+				i++
+				continue
+			}
+			b = append(b, s[start:i]...)
+			switch c {
+			case '"', '\\':
+				b = append(b, '\\', c)
+			case '\n':
+				b = append(b, '\\', 'n')
+			case '\r':
+				b = append(b, '\\', 'r')
+			case '\t':
+				b = append(b, '\\', 't')
+			default:
+				b = append(b, '\\', 'u', '0', '0', hex[c>>4], hex[c&0xf])
+			}
+			i++
+			start = i
+			continue
+		}
+		var r, size = utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			b = append(b, s[start:i]...)
+			b = append(b, `\ufffd`...)
+			i += size
+			start = i
+			continue
+		}
+		i += size
+	}
+	b = append(b, s[start:]...)
+	return append(b, '"')
+}
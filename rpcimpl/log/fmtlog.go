@@ -1,57 +1,42 @@
 package log
 
 import (
-	"fmt"
+	"io"
 	"os"
+	"strings"
+	"sync"
 )
 
-type FmtLog struct{}
-
-func (l FmtLog) Debug(v ...interface{}) {
-	fmt.Println(v...)
-}
-
-func (l FmtLog) Debugf(format string, v ...interface{}) {
-	fmt.Println("DebugLog:", fmt.Sprintf(format, v...))
-}
-
-func (l FmtLog) Info(v ...interface{}) {
-	fmt.Println(v...)
-}
-
-func (l FmtLog) Infof(format string, v ...interface{}) {
-	fmt.Println("InfoLog:", fmt.Sprintf(format, v...))
-}
-
-func (l FmtLog) Warn(v ...interface{}) {
-	fmt.Println(v...)
-}
-
-func (l FmtLog) Warnf(format string, v ...interface{}) {
-	fmt.Println("WarnLog:", fmt.Sprintf(format, v...))
-}
-
-func (l FmtLog) Error(v ...interface{}) {
-	fmt.Println(v...)
-}
-
-func (l FmtLog) Errorf(format string, v ...interface{}) {
-	fmt.Println("ErrorLog:", fmt.Sprintf(format, v...))
-}
-
-func (l FmtLog) Fatal(v ...interface{}) {
-	fmt.Println(v...)
-}
-
-func (l FmtLog) Fatalf(format string, v ...interface{}) {
-	defer os.Exit(1)
-	fmt.Println("FatalLog:", fmt.Sprintf(format, v...))
-}
-
-func (l FmtLog) Panic(v ...interface{}) {
-	panic(fmt.Sprint(v...))
-}
-
-func (l FmtLog) Panicf(format string, v ...interface{}) {
-	panic(fmt.Sprintf(format, v...))
+// FmtLog writes plain text lines without color.
+type FmtLog struct {
+	l    sync.Mutex
+	w    io.Writer
+	json bool
+	buf  []byte
+}
+
+func newFmtLog(o options) *FmtLog {
+	var w = o.out
+	if w == nil {
+		w = os.Stdout
+	}
+	return &FmtLog{w: w, json: o.json}
+}
+
+func (l *FmtLog) Write(e *Entry) {
+	l.l.Lock()
+	defer l.l.Unlock()
+	var b = l.buf[:0]
+	if l.json {
+		b = appendJSON(b, e)
+	} else {
+		b = e.Time.AppendFormat(b, timeFormat)
+		b = append(b, ' ')
+		b = append(b, strings.ToUpper(e.Level.String())...)
+		b = append(b, ' ')
+		b = appendText(b, e)
+		b = append(b, '\n')
+	}
+	_, _ = l.w.Write(b)
+	l.buf = b
 }
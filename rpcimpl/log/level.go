@@ -0,0 +1,175 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+type Level int8
+
+const (
+	DebugLevel Level = iota
+	InfoLevel
+	WarnLevel
+	ErrorLevel
+	OffLevel
+)
+
+var levelNames = [...]string{"debug", "info", "warn", "error", "off"}
+
+func (l Level) String() string {
+	if l < DebugLevel || l > OffLevel {
+		return fmt.Sprintf("level(%d)", l)
+	}
+	return levelNames[l]
+}
+
+func ParseLevel(s string) (Level, error) {
+	for i, name := range levelNames {
+		if strings.EqualFold(s, name) {
+			return Level(i), nil
+		}
+	}
+	return 0, fmt.Errorf("unknown log level %q", s)
+}
+
+// levels ----------------------------------------------------------------------------------------------------
+
+// Levels are set by package import path, such as tiny_rpc/net, a package without its own level
+// uses the level of its nearest parent, then the default level.
+// The package of an entry is the package of its caller.
+
+type levelTable struct {
+	def Level
+	pkg map[string]Level
+	min Level // lowest level of def and pkg, entries below it are dropped without a caller lookup
+}
+
+func newLevelTable(def Level, pkg map[string]Level) *levelTable {
+	var t = &levelTable{def: def, pkg: pkg, min: def}
+	for _, lvl := range pkg {
+		if lvl < t.min {
+			t.min = lvl
+		}
+	}
+	return t
+}
+
+var (
+	levelMu sync.Mutex // guard levels writes
+	levels  atomic.Value
+)
+
+func init() {
+	levels.Store(newLevelTable(DebugLevel, nil))
+}
+
+// SetLevel sets the default level.
+func SetLevel(lvl Level) {
+	update(func(def *Level, _ map[string]Level) {
+		*def = lvl
+	})
+}
+
+// SetPkgLevel sets the level of pkg and its sub packages.
+func SetPkgLevel(pkg string, lvl Level) {
+	updatePkg(func(m map[string]Level) {
+		m[pkg] = lvl
+	})
+}
+
+// ResetPkgLevel makes pkg use the level of its parent again.
+func ResetPkgLevel(pkg string) {
+	updatePkg(func(m map[string]Level) {
+		delete(m, pkg)
+	})
+}
+
+func updatePkg(f func(m map[string]Level)) {
+	update(func(def *Level, m map[string]Level) {
+		f(m)
+	})
+}
+
+// update stores the levels changed by f as a whole.
+func update(f func(def *Level, m map[string]Level)) {
+	levelMu.Lock()
+	defer levelMu.Unlock()
+	var t = levels.Load().(*levelTable)
+	var def = t.def
+	var m = make(map[string]Level, len(t.pkg)+1)
+	for k, v := range t.pkg {
+		m[k] = v
+	}
+	f(&def, m)
+	levels.Store(newLevelTable(def, m))
+}
+
+// MinLevel returns the lowest level in effect for any package.
+func MinLevel() Level {
+	return levels.Load().(*levelTable).min
+}
+
+// GetLevel returns the level in effect for pkg.
+func GetLevel(pkg string) Level {
+	var t = levels.Load().(*levelTable)
+	for p := pkg; len(t.pkg) > 0; {
+		if lvl, ok := t.pkg[p]; ok {
+			return lvl
+		}
+		var i = strings.LastIndexByte(p, '/')
+		if i < 0 {
+			break
+		}
+		p = p[:i]
+	}
+	return t.def
+}
+
+// SetLevelSpec sets levels from a spec like "info,tiny_rpc/net=debug", the entry without
+// package is the default level. The whole spec is parsed first, nothing is set on error.
+func SetLevelSpec(spec string) error {
+	var def *Level
+	var pkgs = make(map[string]Level)
+	for _, item := range strings.Split(spec, ",") {
+		if item = strings.TrimSpace(item); item == "" {
+			continue
+		}
+		var pkg, name = "", item
+		if i := strings.IndexByte(item, '='); i >= 0 {
+			pkg, name = item[:i], item[i+1:]
+		}
+		var lvl, err = ParseLevel(name)
+		if err != nil {
+			return err
+		}
+		if pkg == "" {
+			def = &lvl
+		} else {
+			pkgs[pkg] = lvl
+		}
+	}
+	update(func(d *Level, m map[string]Level) {
+		if def != nil {
+			*d = *def
+		}
+		for pkg, lvl := range pkgs {
+			m[pkg] = lvl
+		}
+	})
+	return nil
+}
+
+// LevelSpec returns the current levels in SetLevelSpec format.
+func LevelSpec() string {
+	var t = levels.Load().(*levelTable)
+	var items = make([]string, 0, len(t.pkg))
+	for pkg, lvl := range t.pkg {
+		items = append(items, pkg+"="+lvl.String())
+	}
+	sort.Strings(items)
+	return strings.Join(append([]string{t.def.String()}, items...), ",")
+}
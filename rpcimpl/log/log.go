@@ -1,60 +1,130 @@
 package log
 
-// Interface ----------------------------------------------------------------------------------------------------
-type Interface interface {
-	Debug(v ...interface{})
-	Debugf(format string, v ...interface{})
+import (
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// Backend ----------------------------------------------------------------------------------------------------
+
+// Backend writes entries passed the level check, zap, logrus, fmt and std log backends are provided.
+type Backend interface {
+	Write(e *Entry)
+}
+
+type Support byte
+
+const (
+	DefLog Support = iota
+	Zap
+	Logrus
+	Fmt
+)
+
+type options struct {
+	json bool
+	out  io.Writer
+}
 
-	Info(v ...interface{})
-	Infof(format string, v ...interface{})
+type Option func(o *options)
 
-	Warn(v ...interface{})
-	Warnf(format string, v ...interface{})
+// WithJSON writes entries as JSON lines.
+func WithJSON() Option {
+	return func(o *options) {
+		o.json = true
+	}
+}
 
-	Error(v ...interface{})
-	Errorf(format string, v ...interface{})
+// WithOutput sets the writer of entries, default is stdout, zap also writes log files by default.
+func WithOutput(w io.Writer) Option {
+	return func(o *options) {
+		o.out = w
+	}
+}
 
-	Fatal(v ...interface{})
-	Fatalf(format string, v ...interface{})
+var backend atomic.Value // *holder
 
-	Panic(v ...interface{})
-	Panicf(format string, v ...interface{})
+type holder struct {
+	Backend
 }
 
-var _defLog Interface
+func init() {
+	backend.Store(&holder{newDefLog(options{out: os.Stderr})})
+}
+
+// Init replaces the backend, logging before Init goes to the std log backend on stderr.
+func Init(log Support, opts ...Option) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+	var b Backend
+	switch log {
+	case Zap:
+		b = retZap(o)
+	case Logrus:
+		b = retLogrus(o)
+	case Fmt:
+		b = newFmtLog(o)
+	default:
+		b = newDefLog(o)
+	}
+	SetBackend(b)
+}
+
+// SetBackend replaces the backend with a custom one.
+func SetBackend(b Backend) {
+	backend.Store(&holder{b})
+}
+
+// Sync flushes the backend if it buffers.
+func Sync() error {
+	if s, ok := backend.Load().(*holder).Backend.(interface{ Sync() error }); ok {
+		return s.Sync()
+	}
+	return nil
+}
+
+// printf ----------------------------------------------------------------------------------------------------
+
+var std = new(Logger)
 
 func Info(format string, a ...interface{}) {
-	_defLog.Infof(format, a...)
+	std.logf(InfoLevel, format, a)
 }
 
 func Debug(format string, a ...interface{}) {
-	_defLog.Debugf(format, a...)
+	std.logf(DebugLevel, format, a)
 }
 
 func Warn(format string, a ...interface{}) {
-	_defLog.Warnf(format, a...)
+	std.logf(WarnLevel, format, a)
 }
 
 func Error(format string, a ...interface{}) {
-	_defLog.Errorf(format, a...)
+	std.logf(ErrorLevel, format, a)
 }
 
-// Support ----------------------------------------------------------------------------------------------------
-type Support byte
+// structured ------------------------------------------------------------------------------------------------
 
-const (
-	DefLog Support = iota
-	Zap
-	Logrus
-)
+func Infow(msg string, fields ...Field) {
+	std.logw(InfoLevel, msg, fields)
+}
 
-func Init(log Support) {
-	switch log {
-	case Zap:
-		_defLog = retZap()
-	case Logrus:
-		_defLog = retLogrus()
-	default:
+func Debugw(msg string, fields ...Field) {
+	std.logw(DebugLevel, msg, fields)
+}
 
-	}
+func Warnw(msg string, fields ...Field) {
+	std.logw(WarnLevel, msg, fields)
+}
+
+func Errorw(msg string, fields ...Field) {
+	std.logw(ErrorLevel, msg, fields)
+}
+
+// With returns a contextual logger adding fields to every entry.
+func With(fields ...Field) *Logger {
+	return std.With(fields...)
 }
@@ -0,0 +1,105 @@
+package log
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+)
+
+const pkg = "tiny_rpc/log"
+
+func TestLevel(t *testing.T) {
+	defer SetLevel(DebugLevel)
+	defer ResetPkgLevel("tiny_rpc")
+	defer ResetPkgLevel(pkg)
+
+	if err := SetLevelSpec("warn,tiny_rpc=error,tiny_rpc/log=debug"); err != nil {
+		t.Fatal(err)
+	}
+	for p, want := range map[string]Level{pkg: DebugLevel, "tiny_rpc/net": ErrorLevel, "main": WarnLevel} {
+		if lvl := GetLevel(p); lvl != want {
+			t.Fatalf("pkg %s level %v want %v", p, lvl, want)
+		}
+	}
+	if spec := LevelSpec(); spec != "warn,tiny_rpc/log=debug,tiny_rpc=error" {
+		t.Fatalf("level spec %q", spec)
+	}
+	if lvl := MinLevel(); lvl != DebugLevel {
+		t.Fatalf("min level %v want %v", lvl, DebugLevel)
+	}
+	if err := SetLevelSpec("error,tiny_rpc=info,tiny_rpc/log=loud"); err == nil {
+		t.Fatal("parse unknown level")
+	}
+	if spec := LevelSpec(); spec != "warn,tiny_rpc/log=debug,tiny_rpc=error" {
+		t.Fatalf("level spec %q changed by a bad spec", spec)
+	}
+
+	ResetPkgLevel(pkg)
+	if lvl := MinLevel(); lvl != WarnLevel {
+		t.Fatalf("min level %v want %v", lvl, WarnLevel)
+	}
+}
+
+func TestBackends(t *testing.T) {
+	for _, s := range []Support{DefLog, Zap, Logrus, Fmt} {
+		var buf bytes.Buffer
+		Init(s, WithJSON(), WithOutput(&buf))
+
+		var l = With(Session(7), Account("zhang"))
+		l.Infow("login", Mode(3), Err(errors.New("bad")))
+		l.Debug("hidden %d", 1)
+
+		SetPkgLevel(pkg, InfoLevel)
+		l.Debug("hidden %d", 2)
+		ResetPkgLevel(pkg)
+
+		var lines = strings.Split(strings.TrimSpace(buf.String()), "\n")
+		if len(lines) != 2 {
+			t.Fatalf("backend %d lines %q", s, lines)
+		}
+		var m map[string]interface{}
+		if err := json.Unmarshal([]byte(lines[0]), &m); err != nil {
+			t.Fatalf("backend %d json %q err %v", s, lines[0], err)
+		}
+		if m["msg"] != "login" || m[KeySession] != float64(7) || m[KeyAccount] != "zhang" ||
+			m[KeyMode] != float64(3) || m[KeyErr] != "bad" || !strings.HasPrefix(m["caller"].(string), "log_test.go:") {
+			t.Fatalf("backend %d entry %v", s, m)
+		}
+	}
+	Init(DefLog)
+}
+
+func TestJSONEscape(t *testing.T) {
+	var buf bytes.Buffer
+	Init(DefLog, WithJSON(), WithOutput(&buf))
+	defer Init(DefLog)
+
+	var msg = "bell\a esc\x1b \"quote\" \\ tab\t bad\xff 世界"
+	Infow(msg, F("key\x00", errors.New("err\x1b\xfe")))
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("json %q err %v", buf.String(), err)
+	}
+	if want := strings.ToValidUTF8(msg, "\ufffd"); m["msg"] != want {
+		t.Fatalf("msg %q want %q", m["msg"], want)
+	}
+	if m["key\x00"] != "err\x1b\ufffd" {
+		t.Fatalf("field %q", m["key\x00"])
+	}
+}
+
+func TestText(t *testing.T) {
+	var buf bytes.Buffer
+	Init(Fmt, WithOutput(&buf))
+	defer Init(DefLog)
+
+	Info("hello %s", "world")
+	With(Module("MA")).Warnw("queue full", F("work", "Hello World"))
+	var out = buf.String()
+	if !strings.Contains(out, "INFO hello world log_test.go:") ||
+		!strings.Contains(out, `WARN queue full log_test.go:`) || !strings.Contains(out, `module=MA work="Hello World"`) {
+		t.Fatalf("text %q", out)
+	}
+}
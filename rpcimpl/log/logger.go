@@ -0,0 +1,186 @@
+package log
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Field ----------------------------------------------------------------------------------------------------
+
+type Field struct {
+	Key   string
+	Value interface{}
+}
+
+func F(key string, v interface{}) Field {
+	return Field{Key: key, Value: v}
+}
+
+// field keys of contextual loggers
+const (
+	KeySession = "session"
+	KeyAccount = "account"
+	KeyMode    = "mode"
+	KeyModule  = "module"
+	KeyErr     = "err"
+	KeyTrace   = "trace"
+	KeySpan    = "span"
+)
+
+func Session(id uint32) Field {
+	return Field{Key: KeySession, Value: id}
+}
+
+func Account(id string) Field {
+	return Field{Key: KeyAccount, Value: id}
+}
+
+func Mode(mode uint32) Field {
+	return Field{Key: KeyMode, Value: mode}
+}
+
+func Module(name string) Field {
+	return Field{Key: KeyModule, Value: name}
+}
+
+func Err(err error) Field {
+	return Field{Key: KeyErr, Value: err}
+}
+
+// Entry ----------------------------------------------------------------------------------------------------
+
+type Entry struct {
+	Time   time.Time
+	Level  Level
+	Pkg    string // import path of the caller package
+	Caller string // file:line
+	Msg    string
+	Fields []Field
+}
+
+// Logger ----------------------------------------------------------------------------------------------------
+
+// Logger adds its fields to every entry, the level is checked by the caller package.
+type Logger struct {
+	fields []Field
+}
+
+// With returns a logger with fields added after l fields.
+func (l *Logger) With(fields ...Field) *Logger {
+	var all = make([]Field, 0, len(l.fields)+len(fields))
+	all = append(all, l.fields...)
+	return &Logger{fields: append(all, fields...)}
+}
+
+func (l *Logger) Info(format string, a ...interface{}) {
+	l.logf(InfoLevel, format, a)
+}
+
+func (l *Logger) Debug(format string, a ...interface{}) {
+	l.logf(DebugLevel, format, a)
+}
+
+func (l *Logger) Warn(format string, a ...interface{}) {
+	l.logf(WarnLevel, format, a)
+}
+
+func (l *Logger) Error(format string, a ...interface{}) {
+	l.logf(ErrorLevel, format, a)
+}
+
+func (l *Logger) Infow(msg string, fields ...Field) {
+	l.logw(InfoLevel, msg, fields)
+}
+
+func (l *Logger) Debugw(msg string, fields ...Field) {
+	l.logw(DebugLevel, msg, fields)
+}
+
+func (l *Logger) Warnw(msg string, fields ...Field) {
+	l.logw(WarnLevel, msg, fields)
+}
+
+func (l *Logger) Errorw(msg string, fields ...Field) {
+	l.logw(ErrorLevel, msg, fields)
+}
+
+// callerDepth skips logf or logw and the exported method calling it
+const callerDepth = 2
+
+func (l *Logger) logf(lvl Level, format string, a []interface{}) {
+	var e, ok = l.entry(lvl)
+	if !ok {
+		return
+	}
+	e.Msg = fmt.Sprintf(format, a...)
+	e.Fields = l.fields
+	l.write(e)
+}
+
+func (l *Logger) logw(lvl Level, msg string, fields []Field) {
+	var e, ok = l.entry(lvl)
+	if !ok {
+		return
+	}
+	e.Msg = msg
+	e.Fields = l.fields
+	if len(fields) > 0 {
+		e.Fields = append(append(make([]Field, 0, len(l.fields)+len(fields)), l.fields...), fields...)
+	}
+	l.write(e)
+}
+
+func (l *Logger) entry(lvl Level) (*Entry, bool) {
+	if lvl < MinLevel() {
+		return nil, false
+	}
+	var pc, file, line, ok = runtime.Caller(callerDepth + 1)
+	var pkg string
+	if ok {
+		pkg = pcPkg(pc)
+	}
+	if lvl < GetLevel(pkg) {
+		return nil, false
+	}
+	return &Entry{
+		Time:   time.Now(),
+		Level:  lvl,
+		Pkg:    pkg,
+		Caller: path.Base(file) + ":" + strconv.Itoa(line),
+	}, true
+}
+
+func (l *Logger) write(e *Entry) {
+	backend.Load().(*holder).Write(e)
+}
+
+// package of a function entry pc
+var pkgs sync.Map // uintptr: string
+
+func pcPkg(pc uintptr) string {
+	var f = runtime.FuncForPC(pc)
+	if f == nil {
+		return ""
+	}
+	var entry = f.Entry()
+	if pkg, ok := pkgs.Load(entry); ok {
+		return pkg.(string)
+	}
+	var pkg = funcPkg(f.Name())
+	pkgs.Store(entry, pkg)
+	return pkg
+}
+
+// funcPkg cuts tiny_rpc/net.(*Session).start to tiny_rpc/net
+func funcPkg(name string) string {
+	var slash = strings.LastIndexByte(name, '/')
+	if dot := strings.IndexByte(name[slash+1:], '.'); dot >= 0 {
+		return name[:slash+1+dot]
+	}
+	return name
+}
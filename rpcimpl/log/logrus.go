@@ -1,22 +1,46 @@
 package log
 
 import (
-	"path"
-	"runtime"
-
-	log "github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus"
 )
 
-func retLogrus() Interface {
-	log.SetFormatter(&log.TextFormatter{
-		FullTimestamp:   true,
-		TimestampFormat: "2006-01-02 15:04:05",
-		CallerPrettyfier: func(frame *runtime.Frame) (function string, file string) {
-			fileName := path.Base(frame.File)
-			return frame.Function, fileName
-		},
-	})
-	log.SetLevel(log.TraceLevel)
+var logrusLevels = [...]logrus.Level{
+	DebugLevel: logrus.DebugLevel,
+	InfoLevel:  logrus.InfoLevel,
+	WarnLevel:  logrus.WarnLevel,
+	ErrorLevel: logrus.ErrorLevel,
+}
+
+type logrusLog struct {
+	l *logrus.Logger
+}
+
+func retLogrus(o options) Backend {
+	var l = logrus.New()
+	if o.json {
+		l.SetFormatter(&logrus.JSONFormatter{TimestampFormat: timeFormat})
+	} else {
+		l.SetFormatter(&logrus.TextFormatter{
+			FullTimestamp:   true,
+			TimestampFormat: timeFormat,
+		})
+	}
+	if o.out != nil {
+		l.SetOutput(o.out)
+	}
+	l.SetLevel(logrus.TraceLevel)
+	return logrusLog{l: l}
+}
 
-	return log.StandardLogger()
+func (l logrusLog) Write(e *Entry) {
+	var fields = make(logrus.Fields, len(e.Fields)+1)
+	fields["caller"] = e.Caller
+	for _, f := range e.Fields {
+		fields[f.Key] = f.Value
+	}
+	var lvl = logrus.ErrorLevel
+	if int(e.Level) < len(logrusLevels) {
+		lvl = logrusLevels[e.Level]
+	}
+	l.l.WithFields(fields).WithTime(e.Time).Log(lvl, e.Msg)
 }
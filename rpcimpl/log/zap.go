@@ -7,25 +7,70 @@ import (
 	"go.uber.org/zap/zapcore"
 )
 
-const logSkip = 1
-
 var (
 	outDir    = "./"
 	outPath   = []string{"stdout", outDir + "log.log"}
 	errorPath = []string{"stderr", outDir + "err.log"}
 )
 
-func retZap() Interface {
+var zapLevels = [...]zapcore.Level{
+	DebugLevel: zapcore.DebugLevel,
+	InfoLevel:  zapcore.InfoLevel,
+	WarnLevel:  zapcore.WarnLevel,
+	ErrorLevel: zapcore.ErrorLevel,
+}
+
+type zapLog struct {
+	l *zap.Logger
+}
+
+func retZap(o options) Backend {
 	config := zap.NewProductionConfig()
 	config.Level = zap.NewAtomicLevelAt(zap.DebugLevel)
 	config.EncoderConfig.EncodeTime = zapcore.RFC3339TimeEncoder
-	config.Encoding = "json"
+	config.Encoding = "console"
+	if o.json {
+		config.Encoding = "json"
+	}
+	// caller is a field of the entry
+	config.DisableCaller = true
+	config.DisableStacktrace = true
 	config.OutputPaths = outPath
 	config.ErrorOutputPaths = errorPath
-	ZapLog, err := config.Build(zap.AddCallerSkip(logSkip))
+
+	if o.out != nil {
+		var enc = zapcore.NewConsoleEncoder(config.EncoderConfig)
+		if o.json {
+			enc = zapcore.NewJSONEncoder(config.EncoderConfig)
+		}
+		return zapLog{l: zap.New(zapcore.NewCore(enc, zapcore.AddSync(o.out), config.Level))}
+	}
+	ZapLog, err := config.Build()
 	if err != nil {
 		panic(fmt.Sprintf("zap log: %v", err))
 	}
 
-	return ZapLog.Sugar()
+	return zapLog{l: ZapLog}
+}
+
+func (l zapLog) Write(e *Entry) {
+	var lvl = zapcore.ErrorLevel
+	if int(e.Level) < len(zapLevels) {
+		lvl = zapLevels[e.Level]
+	}
+	var ce = l.l.Check(lvl, e.Msg)
+	if ce == nil {
+		return
+	}
+	ce.Time = e.Time
+	var fields = make([]zap.Field, 0, len(e.Fields)+1)
+	fields = append(fields, zap.String("caller", e.Caller))
+	for _, f := range e.Fields {
+		fields = append(fields, zap.Any(f.Key, f.Value))
+	}
+	ce.Write(fields...)
+}
+
+func (l zapLog) Sync() error {
+	return l.l.Sync()
 }
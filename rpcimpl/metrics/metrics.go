@@ -0,0 +1,345 @@
+// Package metrics keeps counters, gauges and histograms and writes them in Prometheus text format.
+package metrics
+
+import (
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Registry ----------------------------------------------------------------------------------------------------
+
+// Collector writes its metric families to w.
+type Collector interface {
+	Collect(w *Writer)
+}
+
+type CollectorFunc func(w *Writer)
+
+func (f CollectorFunc) Collect(w *Writer) {
+	f(w)
+}
+
+type Registry struct {
+	l  sync.RWMutex
+	cs []Collector
+}
+
+func NewRegistry() *Registry {
+	return new(Registry)
+}
+
+// Default holds the metrics of tiny_rpc packages.
+var Default = NewRegistry()
+
+func Register(cs ...Collector) {
+	Default.Register(cs...)
+}
+
+func (r *Registry) Register(cs ...Collector) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.cs = append(r.cs, cs...)
+}
+
+// WriteText writes all collectors in Prometheus text exposition format.
+func (r *Registry) WriteText(out io.Writer) error {
+	r.l.RLock()
+	var cs = r.cs
+	r.l.RUnlock()
+
+	var w Writer
+	for _, c := range cs {
+		c.Collect(&w)
+	}
+	_, err := out.Write(w.b)
+	return err
+}
+
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	_ = r.WriteText(w)
+}
+
+// Writer ----------------------------------------------------------------------------------------------------
+
+type Writer struct {
+	b []byte
+}
+
+// Family starts a metric family, typ is counter, gauge or histogram.
+func (w *Writer) Family(name, help, typ string) {
+	w.b = append(w.b, "# HELP "...)
+	w.b = append(w.b, name...)
+	w.b = append(w.b, ' ')
+	w.b = append(w.b, helpEscaper.Replace(help)...)
+	w.b = append(w.b, "\n# TYPE "...)
+	w.b = append(w.b, name...)
+	w.b = append(w.b, ' ')
+	w.b = append(w.b, typ...)
+	w.b = append(w.b, '\n')
+}
+
+// Sample writes one sample, names and values are label pairs.
+func (w *Writer) Sample(name string, names, values []string, v float64) {
+	w.b = append(w.b, name...)
+	if len(names) > 0 {
+		w.b = append(w.b, '{')
+		for i, n := range names {
+			if i > 0 {
+				w.b = append(w.b, ',')
+			}
+			w.b = append(w.b, n...)
+			w.b = append(w.b, `="`...)
+			w.b = append(w.b, labelEscaper.Replace(values[i])...)
+			w.b = append(w.b, '"')
+		}
+		w.b = append(w.b, '}')
+	}
+	w.b = append(w.b, ' ')
+	w.b = appendFloat(w.b, v)
+	w.b = append(w.b, '\n')
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+)
+
+func appendFloat(b []byte, v float64) []byte {
+	switch {
+	case math.IsInf(v, 1):
+		return append(b, "+Inf"...)
+	case math.IsInf(v, -1):
+		return append(b, "-Inf"...)
+	case math.IsNaN(v):
+		return append(b, "NaN"...)
+	}
+	return strconv.AppendFloat(b, v, 'g', -1, 64)
+}
+
+// vec ----------------------------------------------------------------------------------------------------
+
+// vec keeps children by label values.
+type vec struct {
+	name   string
+	help   string
+	labels []string
+	l      sync.RWMutex
+	m      map[string]interface{}
+	create func(values []string) interface{}
+}
+
+func (v *vec) with(values []string) interface{} {
+	if len(values) != len(v.labels) {
+		panic("metrics " + v.name + " label values mismatch")
+	}
+	var key = strings.Join(values, "\xff")
+	v.l.RLock()
+	var c, ok = v.m[key]
+	v.l.RUnlock()
+	if ok {
+		return c
+	}
+
+	v.l.Lock()
+	defer v.l.Unlock()
+	if c, ok = v.m[key]; !ok {
+		c = v.create(append([]string(nil), values...))
+		v.m[key] = c
+	}
+	return c
+}
+
+// sorted returns children ordered by label values.
+func (v *vec) sorted() []interface{} {
+	v.l.RLock()
+	defer v.l.RUnlock()
+	var keys = make([]string, 0, len(v.m))
+	for k := range v.m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var cs = make([]interface{}, len(keys))
+	for i, k := range keys {
+		cs[i] = v.m[k]
+	}
+	return cs
+}
+
+func newVec(name, help string, labels []string, create func(values []string) interface{}) vec {
+	return vec{name: name, help: help, labels: labels, m: make(map[string]interface{}), create: create}
+}
+
+// Counter ----------------------------------------------------------------------------------------------------
+
+type Counter struct {
+	v      uint64
+	values []string
+}
+
+func (c *Counter) Inc() {
+	atomic.AddUint64(&c.v, 1)
+}
+
+func (c *Counter) Add(n uint64) {
+	atomic.AddUint64(&c.v, n)
+}
+
+func (c *Counter) Value() uint64 {
+	return atomic.LoadUint64(&c.v)
+}
+
+type CounterVec struct {
+	vec
+}
+
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return &CounterVec{newVec(name, help, labels, func(values []string) interface{} {
+		return &Counter{values: values}
+	})}
+}
+
+func (c *CounterVec) With(values ...string) *Counter {
+	return c.with(values).(*Counter)
+}
+
+func (c *CounterVec) Collect(w *Writer) {
+	w.Family(c.name, c.help, "counter")
+	for _, v := range c.sorted() {
+		var counter = v.(*Counter)
+		w.Sample(c.name, c.labels, counter.values, float64(counter.Value()))
+	}
+}
+
+// Gauge ----------------------------------------------------------------------------------------------------
+
+type Gauge struct {
+	bits   uint64
+	values []string
+}
+
+func (g *Gauge) Set(v float64) {
+	atomic.StoreUint64(&g.bits, math.Float64bits(v))
+}
+
+func (g *Gauge) Add(v float64) {
+	for {
+		var old = atomic.LoadUint64(&g.bits)
+		if atomic.CompareAndSwapUint64(&g.bits, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			return
+		}
+	}
+}
+
+func (g *Gauge) Inc() {
+	g.Add(1)
+}
+
+func (g *Gauge) Dec() {
+	g.Add(-1)
+}
+
+func (g *Gauge) Value() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&g.bits))
+}
+
+type GaugeVec struct {
+	vec
+}
+
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	return &GaugeVec{newVec(name, help, labels, func(values []string) interface{} {
+		return &Gauge{values: values}
+	})}
+}
+
+func (g *GaugeVec) With(values ...string) *Gauge {
+	return g.with(values).(*Gauge)
+}
+
+func (g *GaugeVec) Collect(w *Writer) {
+	w.Family(g.name, g.help, "gauge")
+	for _, v := range g.sorted() {
+		var gauge = v.(*Gauge)
+		w.Sample(g.name, g.labels, gauge.values, gauge.Value())
+	}
+}
+
+// Histogram ----------------------------------------------------------------------------------------------------
+
+// LatencyBuckets in seconds, from 100us to 10s.
+var LatencyBuckets = []float64{.0001, .0005, .001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type Histogram struct {
+	buckets []float64
+	counts  []uint64 // not cumulative, the last one is +Inf
+	count   uint64
+	sumBits uint64
+	values  []string
+}
+
+func (h *Histogram) Observe(v float64) {
+	var i = sort.SearchFloat64s(h.buckets, v)
+	atomic.AddUint64(&h.counts[i], 1)
+	for {
+		var old = atomic.LoadUint64(&h.sumBits)
+		if atomic.CompareAndSwapUint64(&h.sumBits, old, math.Float64bits(math.Float64frombits(old)+v)) {
+			break
+		}
+	}
+	atomic.AddUint64(&h.count, 1)
+}
+
+func (h *Histogram) ObserveDuration(d time.Duration) {
+	h.Observe(d.Seconds())
+}
+
+func (h *Histogram) Count() uint64 {
+	return atomic.LoadUint64(&h.count)
+}
+
+func (h *Histogram) Sum() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&h.sumBits))
+}
+
+type HistogramVec struct {
+	vec
+}
+
+// NewHistogramVec buckets are sorted upper bounds, +Inf is added.
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return &HistogramVec{newVec(name, help, labels, func(values []string) interface{} {
+		return &Histogram{buckets: buckets, counts: make([]uint64, len(buckets)+1), values: values}
+	})}
+}
+
+func (h *HistogramVec) With(values ...string) *Histogram {
+	return h.with(values).(*Histogram)
+}
+
+func (h *HistogramVec) Collect(w *Writer) {
+	w.Family(h.name, h.help, "histogram")
+	var names = append(append([]string(nil), h.labels...), "le")
+	for _, v := range h.sorted() {
+		var hist = v.(*Histogram)
+		var values = append(append([]string(nil), hist.values...), "")
+		var cum uint64
+		for i, le := range hist.buckets {
+			cum += atomic.LoadUint64(&hist.counts[i])
+			values[len(values)-1] = strconv.FormatFloat(le, 'g', -1, 64)
+			w.Sample(h.name+"_bucket", names, values, float64(cum))
+		}
+		cum += atomic.LoadUint64(&hist.counts[len(hist.buckets)])
+		values[len(values)-1] = "+Inf"
+		w.Sample(h.name+"_bucket", names, values, float64(cum))
+		w.Sample(h.name+"_sum", h.labels, hist.values, math.Float64frombits(atomic.LoadUint64(&hist.sumBits)))
+		w.Sample(h.name+"_count", h.labels, hist.values, float64(cum))
+	}
+}
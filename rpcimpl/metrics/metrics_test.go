@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestWriteText(t *testing.T) {
+	var r = NewRegistry()
+	var c = NewCounterVec("rpc_total", "Requests.", "mode")
+	var g = NewGaugeVec("sessions", "Active \"sessions\".")
+	var h = NewHistogramVec("latency_seconds", "Latency.", []float64{.01, .1}, "mode")
+	r.Register(c, g, h, CollectorFunc(func(w *Writer) {
+		w.Family("queue_length", "Queue.", "gauge")
+		w.Sample("queue_length", []string{"module"}, []string{`a"b`}, 3)
+	}))
+
+	c.With("2").Add(2)
+	c.With("1").Inc()
+	g.With().Inc()
+	g.With().Inc()
+	g.With().Dec()
+	h.With("1").ObserveDuration(5 * time.Millisecond)
+	h.With("1").Observe(.1)
+	h.With("1").Observe(3)
+
+	var buf bytes.Buffer
+	if err := r.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	var want = `# HELP rpc_total Requests.
+# TYPE rpc_total counter
+rpc_total{mode="1"} 1
+rpc_total{mode="2"} 2
+# HELP sessions Active "sessions".
+# TYPE sessions gauge
+sessions 1
+# HELP latency_seconds Latency.
+# TYPE latency_seconds histogram
+latency_seconds_bucket{mode="1",le="0.01"} 1
+latency_seconds_bucket{mode="1",le="0.1"} 2
+latency_seconds_bucket{mode="1",le="+Inf"} 3
+latency_seconds_sum{mode="1"} 3.105
+latency_seconds_count{mode="1"} 3
+# HELP queue_length Queue.
+# TYPE queue_length gauge
+queue_length{module="a\"b"} 3
+`
+	if buf.String() != want {
+		t.Fatalf("text\n%s\nwant\n%s", buf.String(), want)
+	}
+}
@@ -1,5 +1,10 @@
 package model
 
+import "errors"
+
+// ErrAccountOffline the account has no session, see net.SessionMgr.
+var ErrAccountOffline = errors.New("account offline")
+
 // AccountI ----------------------------------------------------------------------------------------------------
 type AccountI interface {
 	ID() string
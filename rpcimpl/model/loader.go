@@ -0,0 +1,45 @@
+package model
+
+import (
+	"sync"
+)
+
+// AccountLoader ----------------------------------------------------------------------------------------------------
+type AccountLoader interface {
+	LoadAccount(accountId string) (AccountI, error)
+}
+
+type LoaderFunc func(accountId string) (AccountI, error)
+
+func (f LoaderFunc) LoadAccount(accountId string) (AccountI, error) {
+	return f(accountId)
+}
+
+// MemLoader keep accounts in memory, a new PlayerAccount is created on first load.
+type MemLoader struct {
+	l        sync.RWMutex
+	accounts map[string]AccountI
+}
+
+func NewMemLoader() *MemLoader {
+	return &MemLoader{
+		accounts: make(map[string]AccountI),
+	}
+}
+
+func (r *MemLoader) Add(a AccountI) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.accounts[a.ID()] = a
+}
+
+func (r *MemLoader) LoadAccount(accountId string) (AccountI, error) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	if a, ok := r.accounts[accountId]; ok {
+		return a, nil
+	}
+	var a = &PlayerAccount{AccountId: accountId}
+	r.accounts[accountId] = a
+	return a, nil
+}
@@ -0,0 +1,73 @@
+package module
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+
+	"tiny_rpc/model"
+)
+
+// AccountSender delivers to accounts connected to a server, implemented by net.SessionMgr.
+type AccountSender interface {
+	PushAccount(accountId string, mode uint32, v interface{}) error
+	ExecAccount(accountId string, f func(a model.AccountI)) error
+}
+
+var senders struct {
+	l  sync.RWMutex
+	id int
+	s  []sender
+}
+
+type sender struct {
+	id int
+	AccountSender
+}
+
+// RegSender registers the sessions of a server for PushAccount and ExecAccount,
+// the returned cancel removes it.
+func RegSender(s AccountSender) (cancel func()) {
+	senders.l.Lock()
+	defer senders.l.Unlock()
+	senders.id++
+	var id = senders.id
+	senders.s = append(senders.s, sender{id: id, AccountSender: s})
+	return func() {
+		senders.l.Lock()
+		defer senders.l.Unlock()
+		for i, s := range senders.s {
+			if s.id == id {
+				senders.s = append(senders.s[:i:i], senders.s[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// PushAccount sends a push message to account wherever it is connected,
+// model.ErrAccountOffline is returned when no server has it.
+func PushAccount(accountId string, mode uint32, v interface{}) error {
+	return eachSender(accountId, func(s AccountSender) error {
+		return s.PushAccount(accountId, mode, v)
+	})
+}
+
+// ExecAccount runs f on the executor of account, after the handlers of the account already queued.
+// f must not wait for handlers or SyncWork of the calling module.
+func ExecAccount(accountId string, f func(a model.AccountI)) error {
+	return eachSender(accountId, func(s AccountSender) error {
+		return s.ExecAccount(accountId, f)
+	})
+}
+
+func eachSender(accountId string, f func(s AccountSender) error) error {
+	senders.l.RLock()
+	defer senders.l.RUnlock()
+	for _, s := range senders.s {
+		if err := f(s); !errors.Is(err, model.ErrAccountOffline) {
+			return err
+		}
+	}
+	return fmt.Errorf("account %s %w", accountId, model.ErrAccountOffline)
+}
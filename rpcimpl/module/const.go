@@ -1,5 +1,7 @@
 package module
 
+import "time"
+
 /*
 	module chan size
 */
@@ -7,6 +9,20 @@ const (
 	ChanSizeDef = 1024
 )
 
+/*
+	module sync work timeout
+*/
+const (
+	SyncTimeoutDef = 5 * time.Second
+)
+
+/*
+	module notify work queue wait timeout
+*/
+const (
+	NotifyTimeoutDef = 5 * time.Second
+)
+
 /*
 	module name
 */
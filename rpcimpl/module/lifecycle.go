@@ -0,0 +1,91 @@
+package module
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LoadErrHandle decide whether a module load error fails the start, return nil to ignore it.
+type LoadErrHandle func(name string, err error) error
+
+func (r *Mgr) SetLoadErrHandle(h LoadErrHandle) {
+	r.loadErr = h
+}
+
+// sort modules by deps, modules without deps between them keep the reg order.
+func (r *Mgr) sort() ([]string, error) {
+	var in = make(map[string]int, len(r.moduleList))
+	var out = make(map[string][]string, len(r.moduleList))
+	for _, name := range r.moduleList {
+		var base = r.moduleMap[name]
+		if base == nil {
+			return nil, fmt.Errorf("module %s nil", name)
+		}
+		for _, dep := range base.deps {
+			if r.moduleMap[dep] == nil {
+				return nil, fmt.Errorf("module %s dep %s not reg", name, dep)
+			}
+			if dep == name {
+				return nil, fmt.Errorf("module %s dep on itself", name)
+			}
+			in[name]++
+			out[dep] = append(out[dep], name)
+		}
+	}
+
+	var order = make([]string, 0, len(r.moduleList))
+	var done = make(map[string]bool, len(r.moduleList))
+	for len(order) < len(r.moduleList) {
+		var picked bool
+		for _, name := range r.moduleList {
+			if done[name] || in[name] > 0 {
+				continue
+			}
+			done[name] = true
+			picked = true
+			order = append(order, name)
+			for _, next := range out[name] {
+				in[next]--
+			}
+			break
+		}
+		if !picked {
+			var cycle []string
+			for _, name := range r.moduleList {
+				if !done[name] {
+					cycle = append(cycle, name)
+				}
+			}
+			return nil, fmt.Errorf("module deps cycle in %s", strings.Join(cycle, ","))
+		}
+	}
+	return order, nil
+}
+
+func (r *Mgr) stopOrder() []string {
+	if r.order != nil {
+		return r.order
+	}
+	return r.moduleList
+}
+
+func (r *Base) load() (err error) {
+	defer func() {
+		if e := recover(); e != nil {
+			err = fmt.Errorf("module %s load panic %v", r.name, e)
+		}
+	}()
+	r.logger.Info("load")
+	return r.rel.Load()
+}
+
+func (r *Base) save() {
+	defer func() {
+		if e := recover(); e != nil {
+			r.logger.Error("save panic %v", e)
+		}
+	}()
+	if err := r.rel.Save(); err != nil {
+		r.logger.Error("save err %v", err)
+	}
+}
@@ -0,0 +1,63 @@
+package module
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// mgr returns a mgr with modules of deps registered in order, deps maps a module to its deps.
+func mgr(t *testing.T, names []string, deps map[string][]string) *Mgr {
+	t.Helper()
+	var r = newMgr()
+	var q = make(Que, 0, len(names))
+	for _, name := range names {
+		q = append(q, Node{M: &testM{}, Size: 1, MName: name, Deps: deps[name]})
+	}
+	if err := r.Reg(q); err != nil {
+		t.Fatalf("reg err %v", err)
+	}
+	return r
+}
+
+func TestSort(t *testing.T) {
+	var cases = []struct {
+		name  string
+		names []string
+		deps  map[string][]string
+		want  []string
+	}{
+		{"no deps keep reg order", []string{"A", "B", "C"}, nil, []string{"A", "B", "C"}},
+		{"dep before", []string{"A", "B", "C"}, map[string][]string{"A": {"C"}}, []string{"B", "C", "A"}},
+		{"chain", []string{"A", "B", "C"}, map[string][]string{"A": {"B"}, "B": {"C"}}, []string{"C", "B", "A"}},
+		{"diamond", []string{"D", "B", "C", "A"}, map[string][]string{"D": {"B", "C"}, "B": {"A"}, "C": {"A"}}, []string{"A", "B", "C", "D"}},
+	}
+	for _, c := range cases {
+		var order, err = mgr(t, c.names, c.deps).sort()
+		if err != nil {
+			t.Fatalf("%s sort err %v", c.name, err)
+		}
+		if !reflect.DeepEqual(order, c.want) {
+			t.Fatalf("%s order %v want %v", c.name, order, c.want)
+		}
+	}
+}
+
+func TestSortErr(t *testing.T) {
+	var cases = []struct {
+		name  string
+		names []string
+		deps  map[string][]string
+		want  string
+	}{
+		{"missing dep", []string{"A", "B"}, map[string][]string{"A": {"X"}}, "module A dep X not reg"},
+		{"self dep", []string{"A", "B"}, map[string][]string{"B": {"B"}}, "module B dep on itself"},
+		{"cycle", []string{"A", "B", "C", "D"}, map[string][]string{"B": {"C"}, "C": {"D"}, "D": {"B"}}, "module deps cycle in B,C,D"},
+	}
+	for _, c := range cases {
+		var _, err = mgr(t, c.names, c.deps).sort()
+		if err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("%s sort err %v want %q", c.name, err, c.want)
+		}
+	}
+}
@@ -0,0 +1,41 @@
+package module
+
+import (
+	"sort"
+
+	"tiny_rpc/metrics"
+)
+
+var workDurationVec = metrics.NewHistogramVec("tiny_rpc_module_work_duration_seconds", "Module work deal latency.", metrics.LatencyBuckets, "module")
+
+func init() {
+	metrics.Register(workDurationVec, metrics.CollectorFunc(collect))
+}
+
+// collect writes queue depth and work counters from module Stats.
+func collect(w *metrics.Writer) {
+	var all = MgrIns().Stats()
+	var names = make([]string, 0, len(all))
+	for name := range all {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var labels = []string{"module"}
+	var families = []struct {
+		name, help, typ string
+		value           func(s Stats) float64
+	}{
+		{"tiny_rpc_module_queue_length", "Works waiting in the module queue.", "gauge", func(s Stats) float64 { return float64(s.QueueLen) }},
+		{"tiny_rpc_module_queue_capacity", "Module queue size.", "gauge", func(s Stats) float64 { return float64(s.QueueCap) }},
+		{"tiny_rpc_module_works_expired_total", "Works skipped because the caller gave up.", "counter", func(s Stats) float64 { return float64(s.Expired) }},
+		{"tiny_rpc_module_works_dropped_total", "Works dropped by OverflowDropOldest.", "counter", func(s Stats) float64 { return float64(s.Dropped) }},
+		{"tiny_rpc_module_works_rejected_total", "Works rejected when the queue is full.", "counter", func(s Stats) float64 { return float64(s.Rejected) }},
+	}
+	for _, f := range families {
+		w.Family(f.name, f.help, f.typ)
+		for _, name := range names {
+			w.Sample(f.name, labels, []string{name}, f.value(all[name]))
+		}
+	}
+}
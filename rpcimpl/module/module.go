@@ -1,36 +1,83 @@
 package module
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"reflect"
 	"runtime"
 	"strings"
+	"sync"
+	"time"
 
+	"tiny_rpc/codes"
 	"tiny_rpc/log"
+	"tiny_rpc/trace"
 	"tiny_rpc/util"
 )
 
 var m = newMgr()
 
+var (
+	ErrShutdown = errors.New("module is shutting down")
+	ErrInternal = errors.New("module internal error")
+)
+
+// Code returns the response code of a work error for handlers, codes.Shutdown for ErrShutdown.
+func Code(err error) uint32 {
+	switch {
+	case err == nil:
+		return codes.OK
+	case errors.Is(err, ErrShutdown):
+		return codes.Shutdown
+	}
+	return codes.Internal
+}
+
 func MgrIns() *Mgr {
 	return m
 }
 
+// SyncWork calls module method and waits for the reply at most SyncTimeoutDef.
 func SyncWork(mo, me string, arg, reply interface{}) error {
-	return MgrIns().work(mo, me, arg, reply)
+	var ctx, cancel = context.WithTimeout(context.Background(), SyncTimeoutDef)
+	defer cancel()
+	return MgrIns().work(ctx, ctx, mo, me, arg, reply)
 }
 
+// NotifyWork queues the work, under OverflowBlock it waits for room at most NotifyTimeoutDef.
 func NotifyWork(mo, me string, arg interface{}) error {
-	return MgrIns().work(mo, me, arg, nil)
+	var wait, cancel = context.WithTimeout(context.Background(), NotifyTimeoutDef)
+	defer cancel()
+	return MgrIns().work(context.Background(), wait, mo, me, arg, nil)
+}
+
+// SyncWorkCtx calls module method and waits for the reply until ctx done.
+// The work is skipped if ctx is done before it is dealt, reply must not be reused after a ctx error.
+func SyncWorkCtx(ctx context.Context, mo, me string, arg, reply interface{}) error {
+	return MgrIns().work(ctx, ctx, mo, me, arg, reply)
+}
+
+// NotifyWorkCtx waits until the work is queued or ctx done.
+func NotifyWorkCtx(ctx context.Context, mo, me string, arg interface{}) error {
+	return MgrIns().work(ctx, ctx, mo, me, arg, nil)
+}
+
+// TryNotify queues the work without blocking, ErrQueueFull is returned when the queue is full.
+func TryNotify(mo, me string, arg interface{}) error {
+	return MgrIns().work(context.Background(), nil, mo, me, arg, nil)
 }
 
 // Que ----------------------------------------------------------------------------------------------------
 type (
 	Que  []Node
 	Node struct {
-		M     M
-		Size  int
-		MName string
+		M      M
+		Size   int
+		MName  string
+		Policy OverflowPolicy
+		Deps   []string      // modules loaded before and saved after this one
+		SaveIv time.Duration // auto save interval, 0 means no auto save
 	}
 )
 
@@ -39,6 +86,8 @@ type Mgr struct {
 	wg         *util.WGWrapper
 	moduleMap  map[string]*Base
 	moduleList []string
+	order      []string // start order, sorted by deps
+	loadErr    LoadErrHandle
 }
 
 func newMgr() *Mgr {
@@ -69,6 +118,9 @@ func (r *Mgr) Reg(q Que) error {
 		}
 
 		module := NewModule(n.M, name, n.Size, r.wg)
+		module.policy = n.Policy
+		module.deps = n.Deps
+		module.saveIv = n.SaveIv
 		r.moduleMap[name] = module
 		r.moduleList = append(r.moduleList, name)
 		if err := module.register(); err != nil {
@@ -79,11 +131,26 @@ func (r *Mgr) Reg(q Que) error {
 	return nil
 }
 
+// Start loads and starts modules in deps order.
+// A load error stops the started modules and fails the start, unless LoadErrHandle ignores it.
 func (r *Mgr) Start() error {
-	for i := 0; i < len(r.moduleList); i++ {
-		name := r.moduleList[i]
-		if r.moduleMap[name] == nil {
-			return fmt.Errorf("module mgr start %s err", name)
+	order, err := r.sort()
+	if err != nil {
+		return fmt.Errorf("module mgr start %v", err)
+	}
+	r.order = order
+
+	for i, name := range order {
+		if err := r.moduleMap[name].load(); err != nil {
+			if r.loadErr != nil {
+				err = r.loadErr(name, err)
+			}
+			if err != nil {
+				r.order = order[:i]
+				_ = r.Stop()
+				return fmt.Errorf("module mgr start %s load err %v", name, err)
+			}
+			log.Warn("module %s load err ignored", name)
 		}
 		r.moduleMap[name].Start()
 	}
@@ -91,9 +158,11 @@ func (r *Mgr) Start() error {
 	return nil
 }
 
+// Stop stops modules in reverse start order, each module saves after stop.
 func (r *Mgr) Stop() error {
-	for i := len(r.moduleList) - 1; i >= 0; i-- {
-		name := r.moduleList[i]
+	var order = r.stopOrder()
+	for i := len(order) - 1; i >= 0; i-- {
+		name := order[i]
 		if r.moduleMap[name] == nil {
 			log.Error("module mgr stop %s err", name)
 			continue
@@ -107,31 +176,69 @@ func (r *Mgr) Stop() error {
 	return nil
 }
 
-func (r *Mgr) work(mo, me string, arg, reply interface{}) error {
+// Shutdown stops modules in reverse start order, each module drains its queue until ctx done and then saves.
+// Works left in queue fail with ErrShutdown.
+func (r *Mgr) Shutdown(ctx context.Context) error {
+	var errs []string
+	var order = r.stopOrder()
+	for i := len(order) - 1; i >= 0; i-- {
+		name := order[i]
+		if r.moduleMap[name] == nil {
+			log.Error("module mgr shutdown %s err", name)
+			continue
+		}
+		if err := r.moduleMap[name].Shutdown(ctx); err != nil {
+			log.Error("module %s shutdown err %v", name, err)
+			errs = append(errs, err.Error())
+		}
+	}
+	log.Info("modules shutdown, count %d", len(r.moduleMap))
+	if len(errs) > 0 {
+		return fmt.Errorf("modules shutdown err: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// Stats returns stats of all modules.
+func (r *Mgr) Stats() map[string]Stats {
+	var ret = make(map[string]Stats, len(r.moduleMap))
+	for name, m := range r.moduleMap {
+		ret[name] = m.Stats()
+	}
+	return ret
+}
+
+// work queues a work of caller ctx, wait bounds waiting for room in a full queue, nil wait never waits.
+func (r *Mgr) work(ctx, wait context.Context, mo, me string, arg, reply interface{}) error {
 	if r.moduleMap[mo] == nil {
 		return fmt.Errorf("module %s nil", mo)
 	}
 
 	if reply == nil {
-		r.moduleMap[mo].receive(&Work{
+		return r.moduleMap[mo].receive(&Work{
 			Method: me,
 			Arg:    arg,
-		})
-		return nil
+			ctx:    ctx,
+		}, wait)
 	}
 
 	w := &Work{
 		Method:  me,
 		Arg:     arg,
 		Reply:   reply,
-		RetChan: make(chan struct{}),
+		RetChan: make(chan struct{}, 1),
+		ctx:     ctx,
+	}
+	if err := r.moduleMap[mo].receive(w, wait); err != nil {
+		return err
 	}
-	r.moduleMap[mo].receive(w)
 	select {
 	case <-w.RetChan:
 		if w.Err != nil {
 			return w.Err
 		}
+	case <-ctx.Done():
+		return fmt.Errorf("module %s method %s %w", mo, me, ctx.Err())
 	}
 	return nil
 }
@@ -145,8 +252,19 @@ type M interface {
 // Base ----------------------------------------------------------------------------------------------------
 type Base struct {
 	name      string
+	logger    *log.Logger
 	workChan  chan *Work
 	closeChan chan interface{}
+	doneChan  chan struct{}
+	drainCtx  context.Context
+	senders   sync.WaitGroup // senders blocked on a full queue
+	l         sync.RWMutex   // guard follows
+	started   bool
+	closed    bool
+	policy    OverflowPolicy
+	deps      []string
+	saveIv    time.Duration
+	stats     stats
 	wg        *util.WGWrapper
 	rel       M
 	typ       reflect.Type
@@ -154,12 +272,27 @@ type Base struct {
 	method    map[string]*methodType
 }
 
+// Work ctx is the caller ctx, the work span joins the trace carried by it.
 type Work struct {
 	Method  string
 	Arg     interface{}
 	Reply   interface{}
 	Err     error
 	RetChan chan struct{}
+	ctx     context.Context
+}
+
+// Trace returns the span of the work caller.
+func (w *Work) Trace() trace.SpanContext {
+	return trace.FromContext(w.ctx)
+}
+
+func (w *Work) finish(err error) {
+	if w.RetChan == nil {
+		return
+	}
+	w.Err = err
+	w.RetChan <- struct{}{}
 }
 
 type methodType struct {
@@ -171,8 +304,11 @@ type methodType struct {
 func NewModule(m M, name string, chanSize int, wg *util.WGWrapper) *Base {
 	return &Base{
 		name:      name,
+		logger:    log.With(log.Module(name)),
+		stats:     stats{duration: workDurationVec.With(name)},
 		workChan:  make(chan *Work, chanSize),
 		closeChan: make(chan interface{}),
+		doneChan:  make(chan struct{}),
 		wg:        wg,
 		rel:       m,
 		typ:       reflect.TypeOf(m),
@@ -182,30 +318,110 @@ func NewModule(m M, name string, chanSize int, wg *util.WGWrapper) *Base {
 
 func (r *Base) Start() {
 	defer util.InfoPanic("module %v panic", r.name)
-	log.Info("module %v start", r.name)
+	r.logger.Info("start")
 
+	r.l.Lock()
+	r.started = true
+	r.l.Unlock()
 	r.wg.Wrap(func() {
+		defer close(r.doneChan)
+		var saveC <-chan time.Time
+		if r.saveIv > 0 {
+			var ticker = time.NewTicker(r.saveIv)
+			defer ticker.Stop()
+			saveC = ticker.C
+		}
 		for {
 			select {
 			case w := <-r.workChan:
-				func(w *Work) {
-					defer util.InfoPanic("module %v panic, work %s param %+v", r.name, w.Method, w.Arg)
-					r.dealWork(w)
-				}(w)
+				r.safeDealWork(w)
+			case <-saveC:
+				r.save()
 			case <-r.closeChan:
+				r.drain(r.drainCtx)
 				return
 			}
 		}
 	})
 }
 
+// Stop stops the module at once and saves, works left in queue fail with ErrShutdown.
 func (r *Base) Stop() error {
+	return r.stop(nil)
+}
+
+// Shutdown stops receiving works, drains queue until ctx done and then saves the module.
+func (r *Base) Shutdown(ctx context.Context) error {
+	return r.stop(ctx)
+}
+
+func (r *Base) stop(ctx context.Context) error {
+	r.l.Lock()
+	if r.closed {
+		r.l.Unlock()
+		return fmt.Errorf("module %s already stopped", r.name)
+	}
+	r.closed = true
+	var started = r.started
+	r.drainCtx = ctx
+	r.l.Unlock()
+
 	close(r.closeChan)
+	if !started {
+		r.drain(ctx)
+		return nil
+	}
+	<-r.doneChan
 	return nil
 }
 
-func (r *Base) receive(w *Work) {
-	r.workChan <- w
+func (r *Base) drain(ctx context.Context) {
+	var count int
+	if ctx != nil {
+	loop:
+		for {
+			select {
+			case w := <-r.workChan:
+				r.safeDealWork(w)
+				count++
+			case <-ctx.Done():
+				break loop
+			default:
+				break loop
+			}
+		}
+	}
+
+	// senders blocked on a full queue return once closeChan closed, works they queued fail below
+	r.senders.Wait()
+	var fail int
+	for {
+		select {
+		case w := <-r.workChan:
+			w.finish(ErrShutdown)
+			fail++
+			continue
+		default:
+		}
+		break
+	}
+	r.logger.Info("stop, drain %d work, fail %d work", count, fail)
+	r.save()
+}
+
+func (r *Base) safeDealWork(w *Work) {
+	defer util.InfoPanic("module %v panic, work %s param %+v", r.name, w.Method, w.Arg)
+	if w.ctx != nil && w.ctx.Err() != nil {
+		// caller gave up
+		r.stats.expire()
+		w.finish(w.ctx.Err())
+		return
+	}
+	var start = time.Now()
+	var _, span = trace.Start(w.ctx, "module", log.Module(r.name), log.F("method", w.Method))
+	var err = r.dealWork(w)
+	span.End(err)
+	r.stats.record(time.Since(start))
 }
 
 func (r *Base) register() error {
@@ -227,7 +443,7 @@ func (r *Base) register() error {
 				return fmt.Errorf("arg not ptr")
 			}
 			r.method[mname] = &methodType{method: method, ArgType: argType}
-			log.Info("module %s reg notify method %s", r.name, mname)
+			r.logger.Info("reg notify method %s", mname)
 		}
 
 		// sync method needs three ins: receiver, *args, *reply.
@@ -240,57 +456,52 @@ func (r *Base) register() error {
 			}
 			// Method needs one out.
 			if mtype.NumOut() != 1 {
-				log.Info("method %s has wrong number of outs: %d", mname, mtype.NumOut())
+				r.logger.Info("method %s has wrong number of outs: %d", mname, mtype.NumOut())
 				continue
 			}
 			r.method[mname] = &methodType{method: method, ArgType: argType, ReplyType: replyType}
-			log.Info("module %s reg sync method %s", r.name, mname)
+			r.logger.Info("reg sync method %s", mname)
 		}
 	}
 	return nil
 }
 
-func (r *Base) dealWork(w *Work) {
+// dealWork returns the error finishing a sync work, nil for notify works.
+func (r *Base) dealWork(w *Work) error {
+	var sc = w.Trace()
 	mtype := r.method[w.Method]
 	if mtype == nil {
 		var err = fmt.Errorf("module %s method %s not find", r.name, w.Method)
-		if w.RetChan != nil {
-			w.Err = err
-			w.RetChan <- struct{}{}
-		}
-		return
+		observe(Record{Module: r.name, Method: w.Method, Arg: w.Arg, Reply: w.Reply, Err: err, Trace: sc})
+		w.finish(err)
+		return err
 	}
 
 	if w.Reply == nil || w.RetChan == nil {
-		log.Debug("module %s receive notify %+v", r.name, w.Arg)
+		r.logger.Debugw("receive notify", append(sc.Fields(), log.F("method", w.Method), log.F("arg", w.Arg))...)
 		r.callNotify(mtype, reflect.ValueOf(w.Arg))
-		return
+		observe(Record{Module: r.name, Method: w.Method, Arg: w.Arg, Trace: sc})
+		return nil
 	}
 
-	var builder strings.Builder
-	builder.WriteString(fmt.Sprintf("module %s receive sync call arg %+v ", r.name, w.Arg))
 	err := r.callSync(mtype, reflect.ValueOf(w.Arg), reflect.ValueOf(w.Reply))
-	builder.WriteString(fmt.Sprintf("reply %+v err %v", w.Reply, err))
-	log.Debug(builder.String())
-	if w.RetChan != nil {
-		if err != nil {
-			w.Err = err
-		}
-		w.RetChan <- struct{}{}
-	}
-	return
+	r.logger.Debugw("receive sync call", append(sc.Fields(), log.F("method", w.Method), log.F("arg", w.Arg), log.F("reply", w.Reply), log.Err(err))...)
+	observe(Record{Module: r.name, Method: w.Method, Arg: w.Arg, Reply: w.Reply, Err: err, Trace: sc})
+	w.finish(err)
+	return err
 }
 
+// callSync returns an error wrapping ErrInternal when the method panics.
 func (r *Base) callSync(mtype *methodType, argv, replyv reflect.Value) (err error) {
 	defer func() {
-		if err := recover(); err != nil {
+		if p := recover(); p != nil {
 			buf := make([]byte, 4096)
 			n := runtime.Stack(buf, false)
 			buf = buf[:n]
 
-			err = fmt.Errorf("[module internal error]: %v, method: %s, argv: %+v, stack: %s",
-				err, mtype.method.Name, argv.Interface(), buf)
-			log.Error("%v", err)
+			err = fmt.Errorf("[%w]: %v, method: %s, argv: %+v, stack: %s",
+				ErrInternal, p, mtype.method.Name, argv.Interface(), buf)
+			r.logger.Error("%v", err)
 		}
 	}()
 
@@ -305,14 +516,13 @@ func (r *Base) callSync(mtype *methodType, argv, replyv reflect.Value) (err erro
 
 func (r *Base) callNotify(mtype *methodType, argv reflect.Value) {
 	defer func() {
-		if err := recover(); err != nil {
+		if p := recover(); p != nil {
 			buf := make([]byte, 4096)
 			n := runtime.Stack(buf, false)
 			buf = buf[:n]
 
-			err = fmt.Errorf("[module internal error]: %v, method: %s, argv: %+v, stack: %s",
-				err, mtype.method.Name, argv.Interface(), buf)
-			log.Error("%v", err)
+			r.logger.Error("[%v]: %v, method: %s, argv: %+v, stack: %s",
+				ErrInternal, p, mtype.method.Name, argv.Interface(), buf)
 		}
 	}()
 
@@ -0,0 +1,53 @@
+package module
+
+import (
+	"sync"
+
+	"tiny_rpc/trace"
+)
+
+// Record is a work dealt by a module, Reply is nil for notify works.
+type Record struct {
+	Module string
+	Method string
+	Arg    interface{}
+	Reply  interface{}
+	Err    error
+	Trace  trace.SpanContext // span of the work caller
+}
+
+// Observer is called in the module goroutine after a work dealt and before the caller returns,
+// it must not block.
+type Observer func(rec Record)
+
+var observers struct {
+	l  sync.RWMutex
+	id int
+	m  map[int]Observer
+}
+
+// Observe registers f for works of all modules, such as test assertions and tracing.
+// The returned cancel removes f.
+func Observe(f Observer) (cancel func()) {
+	observers.l.Lock()
+	defer observers.l.Unlock()
+	if observers.m == nil {
+		observers.m = make(map[int]Observer)
+	}
+	observers.id++
+	var id = observers.id
+	observers.m[id] = f
+	return func() {
+		observers.l.Lock()
+		defer observers.l.Unlock()
+		delete(observers.m, id)
+	}
+}
+
+func observe(rec Record) {
+	observers.l.RLock()
+	defer observers.l.RUnlock()
+	for _, f := range observers.m {
+		f(rec)
+	}
+}
@@ -0,0 +1,151 @@
+package module
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"tiny_rpc/metrics"
+)
+
+var (
+	ErrQueueFull = errors.New("module queue is full")
+	ErrDropped   = errors.New("module work dropped by newer work")
+)
+
+// OverflowPolicy decide what to do when module queue is full
+type OverflowPolicy byte
+
+const (
+	OverflowBlock      OverflowPolicy = iota // wait until queue has room or ctx done
+	OverflowDropOldest                       // drop the oldest queued work
+	OverflowReject                           // return ErrQueueFull
+)
+
+// receive queues w, a full queue is handled by the policy, a nil wait rejects like OverflowReject.
+// OverflowBlock waits for room until wait done or the module stops, without holding r.l.
+func (r *Base) receive(w *Work, wait context.Context) error {
+	var block, err = r.tryReceive(w, wait)
+	if !block {
+		return err
+	}
+	defer r.senders.Done()
+	select {
+	case r.workChan <- w:
+		return nil
+	case <-wait.Done():
+		r.stats.reject()
+		return wait.Err()
+	case <-r.closeChan:
+		return ErrShutdown
+	}
+}
+
+// tryReceive queues w unless the policy blocks, the blocking sender is counted in r.senders
+// before r.l released, so drain waits for it after close.
+func (r *Base) tryReceive(w *Work, wait context.Context) (bool, error) {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	if r.closed {
+		return false, ErrShutdown
+	}
+
+	select {
+	case r.workChan <- w:
+		return false, nil
+	default:
+	}
+
+	if wait == nil {
+		r.stats.reject()
+		return false, ErrQueueFull
+	}
+	switch r.policy {
+	case OverflowReject:
+		r.stats.reject()
+		return false, ErrQueueFull
+	case OverflowDropOldest:
+		for {
+			select {
+			case r.workChan <- w:
+				return false, nil
+			default:
+			}
+			select {
+			case old := <-r.workChan:
+				r.stats.drop()
+				r.logger.Warn("queue full, drop work %s", old.Method)
+				old.finish(ErrDropped)
+			default:
+			}
+		}
+	default:
+		r.senders.Add(1)
+		return true, nil
+	}
+}
+
+// Stats ----------------------------------------------------------------------------------------------------
+type Stats struct {
+	QueueLen int
+	QueueCap int
+	Count    uint64        // dealt works
+	Expired  uint64        // skipped works whose caller gave up
+	Dropped  uint64        // dropped by OverflowDropOldest
+	Rejected uint64        // rejected when queue full
+	Total    time.Duration // total deal time
+	Max      time.Duration // max deal time
+}
+
+func (s Stats) Avg() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+type stats struct {
+	l sync.Mutex
+	Stats
+	duration *metrics.Histogram
+}
+
+func (s *stats) record(cost time.Duration) {
+	s.duration.ObserveDuration(cost)
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.Count++
+	s.Total += cost
+	if cost > s.Max {
+		s.Max = cost
+	}
+}
+
+func (s *stats) expire() {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.Expired++
+}
+
+func (s *stats) drop() {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.Dropped++
+}
+
+func (s *stats) reject() {
+	s.l.Lock()
+	defer s.l.Unlock()
+	s.Rejected++
+}
+
+// Stats returns queue depth and deal latency of the module.
+func (r *Base) Stats() Stats {
+	r.stats.l.Lock()
+	var ret = r.stats.Stats
+	r.stats.l.Unlock()
+	ret.QueueLen = len(r.workChan)
+	ret.QueueCap = cap(r.workChan)
+	return ret
+}
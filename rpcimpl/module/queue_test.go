@@ -0,0 +1,124 @@
+package module
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"tiny_rpc/util"
+)
+
+type testM struct{}
+
+func (r *testM) Load() error { return nil }
+func (r *testM) Save() error { return nil }
+
+// full returns a module not started with a queue of one work already queued.
+func full(t *testing.T, policy OverflowPolicy) (*Base, *Work) {
+	t.Helper()
+	var r = NewModule(&testM{}, "test", 1, new(util.WGWrapper))
+	r.policy = policy
+	var w = &Work{Method: "First", RetChan: make(chan struct{}, 1)}
+	if err := r.receive(w, context.Background()); err != nil {
+		t.Fatalf("receive err %v", err)
+	}
+	return r, w
+}
+
+func TestOverflowReject(t *testing.T) {
+	var r, _ = full(t, OverflowReject)
+	if err := r.receive(&Work{Method: "Second"}, context.Background()); !errors.Is(err, ErrQueueFull) {
+		t.Fatalf("receive err %v want %v", err, ErrQueueFull)
+	}
+	if s := r.Stats(); s.Rejected != 1 || s.QueueLen != 1 {
+		t.Fatalf("stats %+v", s)
+	}
+}
+
+func TestOverflowTry(t *testing.T) {
+	for _, policy := range []OverflowPolicy{OverflowBlock, OverflowDropOldest, OverflowReject} {
+		var r, _ = full(t, policy)
+		if err := r.receive(&Work{Method: "Second"}, nil); !errors.Is(err, ErrQueueFull) {
+			t.Fatalf("policy %d try receive err %v want %v", policy, err, ErrQueueFull)
+		}
+	}
+}
+
+func TestOverflowDropOldest(t *testing.T) {
+	var r, first = full(t, OverflowDropOldest)
+	var second = &Work{Method: "Second"}
+	if err := r.receive(second, context.Background()); err != nil {
+		t.Fatalf("receive err %v", err)
+	}
+	<-first.RetChan
+	if !errors.Is(first.Err, ErrDropped) {
+		t.Fatalf("dropped work err %v want %v", first.Err, ErrDropped)
+	}
+	if w := <-r.workChan; w != second {
+		t.Fatalf("queued work %s want Second", w.Method)
+	}
+	if s := r.Stats(); s.Dropped != 1 {
+		t.Fatalf("stats %+v", s)
+	}
+}
+
+func TestOverflowBlock(t *testing.T) {
+	var r, _ = full(t, OverflowBlock)
+	var wait, cancel = context.WithCancel(context.Background())
+	defer cancel()
+	var done = make(chan error, 1)
+	go func() {
+		done <- r.receive(&Work{Method: "Second"}, wait)
+	}()
+
+	// the blocked sender does not hold the lock, stop goes on without room in the queue
+	time.Sleep(10 * time.Millisecond)
+	var locked = make(chan struct{})
+	go func() {
+		r.l.Lock()
+		r.l.Unlock()
+		close(locked)
+	}()
+	select {
+	case <-locked:
+	case <-time.After(time.Second):
+		t.Fatalf("lock held by the blocked sender")
+	}
+
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("blocked receive err %v want %v", err, context.Canceled)
+	}
+	if s := r.Stats(); s.Rejected != 1 {
+		t.Fatalf("stats %+v", s)
+	}
+}
+
+func TestOverflowBlockStop(t *testing.T) {
+	var r, first = full(t, OverflowBlock)
+	var second = &Work{Method: "Second", RetChan: make(chan struct{}, 1)}
+	var done = make(chan error, 1)
+	go func() {
+		done <- r.receive(second, context.Background())
+	}()
+	time.Sleep(10 * time.Millisecond)
+
+	if err := r.Stop(); err != nil {
+		t.Fatalf("stop err %v", err)
+	}
+	<-first.RetChan
+	if !errors.Is(first.Err, ErrShutdown) {
+		t.Fatalf("queued work err %v want %v", first.Err, ErrShutdown)
+	}
+	// the woken sender returns ErrShutdown, or the work it queued fails in drain
+	if err := <-done; err == nil {
+		<-second.RetChan
+		err = second.Err
+		if !errors.Is(err, ErrShutdown) {
+			t.Fatalf("blocked work err %v want %v", err, ErrShutdown)
+		}
+	} else if !errors.Is(err, ErrShutdown) {
+		t.Fatalf("blocked receive err %v want %v", err, ErrShutdown)
+	}
+}
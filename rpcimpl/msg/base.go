@@ -1,15 +1,74 @@
 package msg
 
 import (
-	"encoding/binary"
 	"io"
 
 	"tiny_rpc/log"
 )
 
+// HeadLen len(4) + type(1) + codec(1) + flag(1) + seq(4) + mode or code(4)
+const HeadLen = 4 + 1 + 1 + 1 + 4 + 4
+
+// TraceLen trace id(8) + span id(8), follows the head when FlagTrace is set.
+const TraceLen = 8 + 8
+
 type Head struct {
-	Len   uint32
-	MType MType
+	Len     uint32
+	MType   MType
+	Codec   SerializerType
+	Flag    Flag
+	Seq     uint32
+	TraceID uint64
+	SpanID  uint64
+	buf     *[]byte // pooled data of Reader
+}
+
+// Release gives data decoded from a Reader back to the pool, data must not be used after.
+func (r *Head) Release() {
+	if r.buf != nil {
+		putBuf(r.buf)
+		r.buf = nil
+	}
+}
+
+func (r *Head) GetFlag() Flag {
+	return r.Flag
+}
+
+func (r *Head) SetFlag(flag Flag) {
+	r.Flag = flag
+}
+
+func (r *Head) GetCodec() SerializerType {
+	return r.Codec
+}
+
+func (r *Head) SetCodec(codec SerializerType) {
+	r.Codec = codec
+}
+
+// GetTrace returns the span of the sender, zero ids when the frame carries none.
+func (r *Head) GetTrace() (traceID, spanID uint64) {
+	return r.TraceID, r.SpanID
+}
+
+// SetTrace sets FlagTrace with the span of the sender, a zero trace id clears it.
+func (r *Head) SetTrace(traceID, spanID uint64) {
+	r.TraceID, r.SpanID = traceID, spanID
+	if traceID == 0 {
+		r.SpanID = 0
+		r.Flag &^= FlagTrace
+	} else {
+		r.Flag |= FlagTrace
+	}
+}
+
+func (r *Head) GetSeq() uint32 {
+	return r.Seq
+}
+
+func (r *Head) SetSeq(seq uint32) {
+	r.Seq = seq
 }
 
 type ModeBase struct {
@@ -34,44 +93,20 @@ func (r *ModeBase) GetData() []byte {
 	return r.Data
 }
 
+func (r *ModeBase) SetData(data []byte) {
+	r.Len = uint32(len(data))
+	r.Data = data
+}
+
 func (r *ModeBase) Encode(writer io.Writer) error {
-	var streamSlice = make([]byte, r.Len+4+1+4)
-	binary.BigEndian.PutUint32(streamSlice[0:4], r.Len)
-	streamSlice[4] = byte(r.MType)
-	binary.BigEndian.PutUint32(streamSlice[5:9], r.Mode)
-	copy(streamSlice[9:], r.Data)
-	_, err := writer.Write(streamSlice)
-	return err
+	return encodeFrame(writer, &r.Head, r.Mode, r.Data)
 }
 
 func (r *ModeBase) Decode(reader io.Reader) error {
-	var slice4byte = make([]byte, 4)
-	_, err := io.ReadFull(reader, slice4byte)
-	if err != nil {
-		return err
-	}
-	var l = binary.BigEndian.Uint32(slice4byte)
-
-	var t = make([]byte, 1)
-	_, err = io.ReadFull(reader, t)
-	if err != nil {
-		return err
-	}
-
-	_, err = io.ReadFull(reader, slice4byte)
-	if err != nil {
-		return err
-	}
-	var m = binary.BigEndian.Uint32(slice4byte)
-
-	var payload = make([]byte, l)
-	_, err = io.ReadFull(reader, payload)
+	var m, payload, err = decodeFrame(reader, &r.Head)
 	if err != nil {
 		return err
 	}
-
-	r.Len = l
-	r.MType = MType(t[0])
 	r.Mode = m
 	r.Data = payload
 	return nil
@@ -99,44 +134,20 @@ func (r *CodeBase) GetData() []byte {
 	return r.Data
 }
 
+func (r *CodeBase) SetData(data []byte) {
+	r.Len = uint32(len(data))
+	r.Data = data
+}
+
 func (r *CodeBase) Encode(writer io.Writer) error {
-	var streamSlice = make([]byte, r.Len+4+1+4)
-	binary.BigEndian.PutUint32(streamSlice[0:4], r.Len)
-	streamSlice[4] = byte(r.MType)
-	binary.BigEndian.PutUint32(streamSlice[5:9], r.Code)
-	copy(streamSlice[9:], r.Data)
-	_, err := writer.Write(streamSlice)
-	return err
+	return encodeFrame(writer, &r.Head, r.Code, r.Data)
 }
 
 func (r *CodeBase) Decode(reader io.Reader) error {
-	var slice4byte = make([]byte, 4)
-	_, err := io.ReadFull(reader, slice4byte)
-	if err != nil {
-		return err
-	}
-	var l = binary.BigEndian.Uint32(slice4byte)
-
-	var t = make([]byte, 1)
-	_, err = io.ReadFull(reader, t)
-	if err != nil {
-		return err
-	}
-
-	_, err = io.ReadFull(reader, slice4byte)
-	if err != nil {
-		return err
-	}
-	var c = binary.BigEndian.Uint32(slice4byte)
-
-	var payload = make([]byte, l)
-	_, err = io.ReadFull(reader, payload)
+	var c, payload, err = decodeFrame(reader, &r.Head)
 	if err != nil {
 		return err
 	}
-
-	r.Len = l
-	r.MType = MType(t[0])
 	r.Code = c
 	r.Data = payload
 	return nil
@@ -165,6 +176,29 @@ func (r *PushBase) FillIn(mode uint32, data []byte) {
 	r.Data = data
 }
 
+// PingBase PongBase heartbeat frames carry no data, pong echoes the ping seq.
+type PingBase struct {
+	ModeBase
+}
+
+func (r *PingBase) FillIn(mode uint32, data []byte) {
+	r.Len = uint32(len(data))
+	r.MType = MTypePing
+	r.Mode = mode
+	r.Data = data
+}
+
+type PongBase struct {
+	ModeBase
+}
+
+func (r *PongBase) FillIn(mode uint32, data []byte) {
+	r.Len = uint32(len(data))
+	r.MType = MTypePong
+	r.Mode = mode
+	r.Data = data
+}
+
 // RequestBase ResponseBase ----------------------------------------------------------------------------------------------------
 type RequestBase struct {
 	ModeBase
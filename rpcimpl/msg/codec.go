@@ -0,0 +1,150 @@
+package msg
+
+import (
+	"bufio"
+	"encoding/binary"
+	"hash/crc32"
+	"io"
+	"net"
+	"syscall"
+)
+
+const (
+	ReadBufSize  = 4096
+	WriteBufSize = 4096
+
+	// data longer than it is referenced by vectored writes instead of copied
+	copyMax = 1024
+	// writer buffer grown over it is dropped after flush
+	keepMax = 64 << 10
+)
+
+// Reader ----------------------------------------------------------------------------------------------------
+
+// Reader buffers a connection for Decode, decoded data is from the buffer pool and given back by Release.
+type Reader struct {
+	r    *bufio.Reader
+	head [HeadLen]byte
+}
+
+func NewReader(r io.Reader) *Reader {
+	return &Reader{r: bufio.NewReaderSize(r, ReadBufSize)}
+}
+
+func (r *Reader) Read(p []byte) (int, error) {
+	return r.r.Read(p)
+}
+
+// Buffered returns bytes read from the connection and not decoded yet.
+func (r *Reader) Buffered() int {
+	return r.r.Buffered()
+}
+
+// Writer ----------------------------------------------------------------------------------------------------
+
+// Writer batches frames encoded to it, Flush writes them at once. Data of large frames is
+// referenced until Flush and written by a vectored write when the connection supports it.
+type Writer struct {
+	w     io.Writer
+	vec   bool
+	buf   []byte
+	mark  int // start of buf not in segs
+	segs  []segment
+	bufs  net.Buffers
+	count int
+}
+
+// segment is a range of buf or referenced data
+type segment struct {
+	off, end int
+	data     []byte
+}
+
+func NewWriter(w io.Writer) *Writer {
+	var _, vec = w.(syscall.Conn)
+	return &Writer{
+		w:   w,
+		vec: vec,
+		buf: make([]byte, 0, WriteBufSize),
+	}
+}
+
+func (w *Writer) Write(p []byte) (int, error) {
+	w.buf = append(w.buf, p...)
+	w.count += len(p)
+	return len(p), nil
+}
+
+// Buffered returns bytes waiting for Flush.
+func (w *Writer) Buffered() int {
+	return w.count
+}
+
+func (w *Writer) frame(h *Head, word uint32, data []byte) {
+	var start = len(w.buf)
+	var ext = extLen(h.Flag)
+	w.buf = append(w.buf, make([]byte, HeadLen+ext)...)
+	putHead(w.buf[start:], h, word, len(data))
+	putTrace(w.buf[start+HeadLen:], h)
+	w.count += HeadLen + ext + len(data)
+
+	if !w.vec || len(data) <= copyMax {
+		w.buf = append(w.buf, data...)
+	} else {
+		w.segs = append(w.segs, segment{off: w.mark, end: len(w.buf)}, segment{data: data})
+		w.mark = len(w.buf)
+	}
+	if h.Flag&FlagCRC != 0 {
+		var sum = crc32.Update(crc32.ChecksumIEEE(w.buf[start:start+HeadLen+ext]), crc32.IEEETable, data)
+		w.buf = append(w.buf, byte(sum>>24), byte(sum>>16), byte(sum>>8), byte(sum))
+		w.count += crcLen
+	}
+}
+
+// Flush writes all batched frames.
+func (w *Writer) Flush() error {
+	if w.count == 0 {
+		return nil
+	}
+	var err error
+	if len(w.segs) == 0 {
+		_, err = w.w.Write(w.buf)
+	} else {
+		w.segs = append(w.segs, segment{off: w.mark, end: len(w.buf)})
+		for _, s := range w.segs {
+			if s.data != nil {
+				w.bufs = append(w.bufs, s.data)
+			} else if s.end > s.off {
+				w.bufs = append(w.bufs, w.buf[s.off:s.end])
+			}
+		}
+		var bufs = w.bufs
+		_, err = bufs.WriteTo(w.w)
+	}
+	w.reset()
+	return err
+}
+
+func (w *Writer) reset() {
+	for i := range w.segs {
+		w.segs[i].data = nil
+	}
+	w.segs = w.segs[:0]
+	w.bufs = w.bufs[:0]
+	w.mark = 0
+	w.count = 0
+	if cap(w.buf) > keepMax {
+		w.buf = make([]byte, 0, WriteBufSize)
+	} else {
+		w.buf = w.buf[:0]
+	}
+}
+
+func putHead(b []byte, h *Head, word uint32, l int) {
+	binary.BigEndian.PutUint32(b[0:4], uint32(l))
+	b[4] = byte(h.MType)
+	b[5] = byte(h.Codec)
+	b[6] = byte(h.Flag)
+	binary.BigEndian.PutUint32(b[7:11], h.Seq)
+	binary.BigEndian.PutUint32(b[11:15], word)
+}
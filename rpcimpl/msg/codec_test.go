@@ -0,0 +1,358 @@
+package msg
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/golang/snappy"
+)
+
+// legacy framing before pooled Reader and Writer, kept as the benchmark baseline
+func legacyEncode(writer io.Writer, r *ResponseBase) error {
+	var streamSlice = make([]byte, r.Len+HeadLen)
+	binary.BigEndian.PutUint32(streamSlice[0:4], r.Len)
+	streamSlice[4] = byte(r.MType)
+	streamSlice[5] = byte(r.Codec)
+	streamSlice[6] = byte(r.Flag)
+	binary.BigEndian.PutUint32(streamSlice[7:11], r.Seq)
+	binary.BigEndian.PutUint32(streamSlice[11:15], r.Code)
+	copy(streamSlice[HeadLen:], r.Data)
+	_, err := writer.Write(streamSlice)
+	return err
+}
+
+func legacyDecode(reader io.Reader, r *ResponseBase) error {
+	var slice4byte = make([]byte, 4)
+	if _, err := io.ReadFull(reader, slice4byte); err != nil {
+		return err
+	}
+	var l = binary.BigEndian.Uint32(slice4byte)
+	var t = make([]byte, 3)
+	if _, err := io.ReadFull(reader, t); err != nil {
+		return err
+	}
+	if _, err := io.ReadFull(reader, slice4byte); err != nil {
+		return err
+	}
+	var seq = binary.BigEndian.Uint32(slice4byte)
+	if _, err := io.ReadFull(reader, slice4byte); err != nil {
+		return err
+	}
+	var c = binary.BigEndian.Uint32(slice4byte)
+	var payload = make([]byte, l)
+	if _, err := io.ReadFull(reader, payload); err != nil {
+		return err
+	}
+	r.Len, r.MType, r.Codec, r.Flag, r.Seq, r.Code, r.Data = l, MType(t[0]), SerializerType(t[1]), Flag(t[2]), seq, c, payload
+	return nil
+}
+
+var benchSizes = []int{64, 1024, 16 << 10}
+
+func benchFrame(size int) *ResponseBase {
+	var r = new(ResponseBase)
+	r.FillIn(1, bytes.Repeat([]byte{'x'}, size))
+	r.SetSeq(7)
+	return r
+}
+
+// stream repeats a frame forever
+type stream struct {
+	frame []byte
+	off   int
+}
+
+func (s *stream) Read(p []byte) (int, error) {
+	var n int
+	for n < len(p) {
+		var c = copy(p[n:], s.frame[s.off:])
+		n += c
+		s.off = (s.off + c) % len(s.frame)
+	}
+	return n, nil
+}
+
+func newStream(size int) *stream {
+	var buf bytes.Buffer
+	_ = legacyEncode(&buf, benchFrame(size))
+	return &stream{frame: buf.Bytes()}
+}
+
+func TestCodecRoundTrip(t *testing.T) {
+	for _, flag := range []Flag{0, FlagCRC, FlagTrace, FlagCRC | FlagTrace} {
+		for _, size := range append(benchSizes, 0) {
+			var conn, peer = net.Pipe()
+			var w = NewWriter(conn)
+			var frames = 8
+			go func() {
+				for i := 0; i < frames; i++ {
+					var f = benchFrame(size)
+					f.SetSeq(uint32(i))
+					f.SetFlag(flag)
+					if flag&FlagTrace != 0 {
+						f.SetTrace(uint64(i+1), uint64(i+2))
+					}
+					_ = f.Encode(w)
+				}
+				_ = w.Flush()
+			}()
+
+			var r = NewReader(peer)
+			for i := 0; i < frames; i++ {
+				var f = new(ResponseBase)
+				if err := f.Decode(r); err != nil {
+					t.Fatalf("flag %d size %d decode err %v", flag, size, err)
+				}
+				if f.GetSeq() != uint32(i) || len(f.GetData()) != size || f.GetCode() != 1 {
+					t.Fatalf("flag %d size %d frame %d mismatch seq %d len %d", flag, size, i, f.GetSeq(), len(f.GetData()))
+				}
+				if traceID, spanID := f.GetTrace(); flag&FlagTrace != 0 && (traceID != uint64(i+1) || spanID != uint64(i+2)) {
+					t.Fatalf("flag %d size %d frame %d trace mismatch %d %d", flag, size, i, traceID, spanID)
+				}
+				f.Release()
+			}
+			_ = conn.Close()
+			_ = peer.Close()
+		}
+	}
+}
+
+var testKey = bytes.Repeat([]byte{'k'}, 16)
+
+func TestTransformRoundTrip(t *testing.T) {
+	var cases = []struct {
+		name string
+		flag Flag
+		key  []byte
+		size int
+		want Flag // flag on the wire
+	}{
+		{"none", 0, nil, 1024, 0},
+		{"crc", FlagCRC, nil, 1024, FlagCRC},
+		{"snappy", FlagSnappy, nil, 1024, FlagSnappy},
+		{"snappy short", FlagSnappy, nil, CompressMinSize - 1, 0},
+		{"zstd", FlagZstd, nil, 1024, FlagZstd},
+		{"encrypt", FlagEncrypt, testKey, 1024, FlagEncrypt},
+		{"encrypt no key", FlagEncrypt, nil, 1024, 0},
+		{"all", FlagCRC | FlagZstd | FlagEncrypt, testKey, 16 << 10, FlagCRC | FlagZstd | FlagEncrypt},
+	}
+	for _, c := range cases {
+		var tf, err = NewTransform(c.flag, c.key)
+		if err != nil {
+			t.Fatalf("%s transform err %v", c.name, err)
+		}
+		var f = benchFrame(c.size)
+		if err := tf.Pack(f); err != nil {
+			t.Fatalf("%s pack err %v", c.name, err)
+		}
+		if f.GetFlag() != c.want {
+			t.Fatalf("%s packed flag %d want %d", c.name, f.GetFlag(), c.want)
+		}
+		if err := tf.Pack(f); err != nil || f.GetFlag() != c.want {
+			t.Fatalf("%s packed twice flag %d err %v", c.name, f.GetFlag(), err)
+		}
+
+		var buf bytes.Buffer
+		if err := f.Encode(&buf); err != nil {
+			t.Fatalf("%s encode err %v", c.name, err)
+		}
+		var out = new(ResponseBase)
+		if err := out.Decode(&buf); err != nil {
+			t.Fatalf("%s decode err %v", c.name, err)
+		}
+		if err := tf.Unpack(out); err != nil {
+			t.Fatalf("%s unpack err %v", c.name, err)
+		}
+		if !bytes.Equal(out.GetData(), benchFrame(c.size).GetData()) || out.GetFlag()&transformFlags != 0 {
+			t.Fatalf("%s unpacked len %d flag %d", c.name, len(out.GetData()), out.GetFlag())
+		}
+	}
+}
+
+func TestTransformErrors(t *testing.T) {
+	// crc mismatch
+	var f = benchFrame(64)
+	f.SetFlag(FlagCRC)
+	var buf bytes.Buffer
+	_ = f.Encode(&buf)
+	buf.Bytes()[HeadLen] ^= 1
+	if err := new(ResponseBase).Decode(&buf); err != ErrChecksum {
+		t.Fatalf("crc err %v", err)
+	}
+
+	// encrypted frame without the key
+	var tf, _ = NewTransform(FlagEncrypt, testKey)
+	f = benchFrame(64)
+	_ = tf.Pack(f)
+	if err := (*Transform)(nil).Unpack(f); err != ErrNoCipher {
+		t.Fatalf("no cipher err %v", err)
+	}
+	var other, _ = NewTransform(FlagEncrypt, bytes.Repeat([]byte{'o'}, 16))
+	if err := other.Unpack(f); err == nil {
+		t.Fatal("wrong key unpacked")
+	}
+}
+
+func TestFrameTooLarge(t *testing.T) {
+	const max = 4 << 10
+	SetMaxFrameSize(max)
+	defer SetMaxFrameSize(MaxFrameSizeDef)
+
+	var buf bytes.Buffer
+	_ = benchFrame(max + 1).Encode(&buf)
+	if err := new(ResponseBase).Decode(&buf); !errors.Is(err, ErrFrameTooLarge) {
+		t.Fatalf("plain err %v", err)
+	}
+
+	var zstdOne, _ = zstdEncoder()
+	var half = bytes.Repeat([]byte{'x'}, max/2+1)
+	var cases = []struct {
+		name string
+		flag Flag
+		data []byte
+	}{
+		{"snappy", FlagSnappy, snappy.Encode(nil, bytes.Repeat([]byte{'x'}, max+1))},
+		{"zstd", FlagZstd, zstdOne.EncodeAll(bytes.Repeat([]byte{'x'}, max+1), nil)},
+		// each frame is under max, together they are over it
+		{"zstd concatenated", FlagZstd, zstdOne.EncodeAll(half, zstdOne.EncodeAll(half, nil))},
+	}
+	for _, c := range cases {
+		var f = new(ResponseBase)
+		f.FillIn(1, c.data)
+		f.SetFlag(c.flag)
+		if err := (*Transform)(nil).Unpack(f); !errors.Is(err, ErrFrameTooLarge) {
+			t.Fatalf("%s err %v", c.name, err)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	var tf, _ = NewTransform(FlagCRC|FlagSnappy|FlagZstd|FlagEncrypt, testKey)
+	var cases = []struct {
+		want, got Flag
+	}{
+		{0, 0},
+		{FlagSnappy, FlagSnappy},
+		{FlagSnappy | FlagZstd, FlagZstd},
+		{FlagCRC | FlagEncrypt, FlagCRC | FlagEncrypt},
+		{FlagTrace, 0},
+	}
+	for _, c := range cases {
+		if got := tf.Negotiate(c.want).Flag(); got != c.got {
+			t.Fatalf("negotiate %d got %d want %d", c.want, got, c.got)
+		}
+	}
+	var plain, _ = NewTransform(FlagSnappy, nil)
+	if got := plain.Negotiate(FlagSnappy | FlagEncrypt).Flag(); got != FlagSnappy {
+		t.Fatalf("negotiate without key got %d", got)
+	}
+	if got := (*Transform)(nil).Negotiate(FlagZstd); got != nil {
+		t.Fatalf("nil negotiate %v", got)
+	}
+}
+
+func BenchmarkEncode(b *testing.B) {
+	for _, size := range benchSizes {
+		var frame = benchFrame(size)
+		b.Run(fmt.Sprintf("legacy/%d", size), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = legacyEncode(io.Discard, frame)
+			}
+		})
+		b.Run(fmt.Sprintf("writer/%d", size), func(b *testing.B) {
+			var w = NewWriter(io.Discard)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = frame.Encode(w)
+				_ = w.Flush()
+			}
+		})
+	}
+}
+
+func BenchmarkDecode(b *testing.B) {
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("legacy/%d", size), func(b *testing.B) {
+			var s = newStream(size)
+			var frame = new(ResponseBase)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = legacyDecode(s, frame)
+			}
+		})
+		b.Run(fmt.Sprintf("reader/%d", size), func(b *testing.B) {
+			var r = NewReader(newStream(size))
+			var frame = new(ResponseBase)
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				_ = frame.Decode(r)
+				frame.Release()
+			}
+		})
+	}
+}
+
+// BenchmarkWriteTCP writes batches of frames to a loopback tcp connection,
+// legacy writes each frame, writer batches them into one vectored write.
+func BenchmarkWriteTCP(b *testing.B) {
+	const batch = 32
+	for _, size := range benchSizes {
+		b.Run(fmt.Sprintf("legacy/%d", size), func(b *testing.B) {
+			var conn = benchConn(b)
+			var frame = benchFrame(size)
+			b.ReportAllocs()
+			b.SetBytes(int64(batch * (HeadLen + size)))
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < batch; j++ {
+					if err := legacyEncode(conn, frame); err != nil {
+						b.Fatal(err)
+					}
+				}
+			}
+		})
+		b.Run(fmt.Sprintf("writer/%d", size), func(b *testing.B) {
+			var conn = benchConn(b)
+			var w = NewWriter(conn)
+			var frame = benchFrame(size)
+			b.ReportAllocs()
+			b.SetBytes(int64(batch * (HeadLen + size)))
+			for i := 0; i < b.N; i++ {
+				for j := 0; j < batch; j++ {
+					_ = frame.Encode(w)
+				}
+				if err := w.Flush(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func benchConn(b *testing.B) net.Conn {
+	var ln, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		b.Fatal(err)
+	}
+	go func() {
+		var c, err = ln.Accept()
+		if err != nil {
+			return
+		}
+		_, _ = io.Copy(io.Discard, c)
+	}()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() {
+		_ = conn.Close()
+		_ = ln.Close()
+	})
+	return conn
+}
@@ -0,0 +1,156 @@
+package msg
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"sync/atomic"
+)
+
+// Flag bits of Head, see Transform for compression and encryption.
+type Flag byte
+
+const (
+	FlagCRC Flag = 1 << iota // crc32 trailer of head and data
+	FlagSnappy
+	FlagZstd
+	FlagEncrypt
+	FlagTrace // trace and span ids after head, see Head.SetTrace
+)
+
+const (
+	MaxFrameSizeDef = 4 << 20
+	crcLen          = 4
+)
+
+var (
+	ErrFrameTooLarge = errors.New("frame too large")
+	ErrChecksum      = errors.New("frame checksum mismatch")
+)
+
+var maxFrameSize uint32 = MaxFrameSizeDef
+
+// SetMaxFrameSize limits data len of decoded frames, larger frames fail with ErrFrameTooLarge
+// before reading the data.
+func SetMaxFrameSize(size uint32) {
+	atomic.StoreUint32(&maxFrameSize, size)
+}
+
+func MaxFrameSize() uint32 {
+	return atomic.LoadUint32(&maxFrameSize)
+}
+
+// encodeFrame writes head, word (mode or code) and data in one write,
+// frames to a Writer are batched until its Flush.
+func encodeFrame(writer io.Writer, h *Head, word uint32, data []byte) error {
+	if fw, ok := writer.(*Writer); ok {
+		fw.frame(h, word, data)
+		return nil
+	}
+
+	var ext = extLen(h.Flag)
+	var n = HeadLen + ext + len(data)
+	if h.Flag&FlagCRC != 0 {
+		n += crcLen
+	}
+	var b = getBuf(n)
+	defer putBuf(b)
+	var streamSlice = *b
+	putHead(streamSlice, h, word, len(data))
+	putTrace(streamSlice[HeadLen:HeadLen+ext], h)
+	copy(streamSlice[HeadLen+ext:], data)
+	if h.Flag&FlagCRC != 0 {
+		binary.BigEndian.PutUint32(streamSlice[n-crcLen:], crc32.ChecksumIEEE(streamSlice[:n-crcLen]))
+	}
+	_, err := writer.Write(streamSlice)
+	return err
+}
+
+// decodeFrame reads a frame into h, returns word (mode or code) and data.
+// Data read from a Reader is pooled, see Head.Release.
+func decodeFrame(reader io.Reader, h *Head) (uint32, []byte, error) {
+	var head []byte
+	var fr, pooled = reader.(*Reader)
+	if pooled {
+		head = fr.head[:]
+		reader = fr.r
+	} else {
+		head = make([]byte, HeadLen)
+	}
+	_, err := io.ReadFull(reader, head)
+	if err != nil {
+		return 0, nil, err
+	}
+	var l = binary.BigEndian.Uint32(head[0:4])
+	if max := MaxFrameSize(); max > 0 && l > max {
+		return 0, nil, fmt.Errorf("%w len %d max %d", ErrFrameTooLarge, l, max)
+	}
+	var flag = Flag(head[6])
+	var ext [TraceLen]byte
+	if flag&FlagTrace != 0 {
+		if _, err = io.ReadFull(reader, ext[:]); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	var n = l
+	if flag&FlagCRC != 0 {
+		n += crcLen
+	}
+	var buf *[]byte
+	var payload []byte
+	if pooled && n > 0 {
+		buf = getBuf(int(n))
+		payload = *buf
+	} else {
+		payload = make([]byte, n)
+	}
+	_, err = io.ReadFull(reader, payload)
+	if err == nil && flag&FlagCRC != 0 {
+		var sum = crc32.ChecksumIEEE(head)
+		sum = crc32.Update(sum, crc32.IEEETable, ext[:extLen(flag)])
+		sum = crc32.Update(sum, crc32.IEEETable, payload[:l])
+		if sum != binary.BigEndian.Uint32(payload[l:]) {
+			err = ErrChecksum
+		}
+		payload = payload[:l]
+	}
+	if err != nil {
+		if buf != nil {
+			putBuf(buf)
+		}
+		return 0, nil, err
+	}
+
+	h.Release()
+	h.buf = buf
+	h.Len = l
+	h.MType = MType(head[4])
+	h.Codec = SerializerType(head[5])
+	h.Flag = flag
+	h.Seq = binary.BigEndian.Uint32(head[7:11])
+	h.TraceID, h.SpanID = 0, 0
+	if flag&FlagTrace != 0 {
+		h.TraceID = binary.BigEndian.Uint64(ext[0:8])
+		h.SpanID = binary.BigEndian.Uint64(ext[8:16])
+	}
+	return binary.BigEndian.Uint32(head[11:15]), payload, nil
+}
+
+func extLen(flag Flag) int {
+	if flag&FlagTrace != 0 {
+		return TraceLen
+	}
+	return 0
+}
+
+// putTrace writes trace ids of h to b of extLen.
+func putTrace(b []byte, h *Head) {
+	if len(b) == 0 {
+		return
+	}
+	binary.BigEndian.PutUint64(b[0:8], h.TraceID)
+	binary.BigEndian.PutUint64(b[8:16], h.SpanID)
+}
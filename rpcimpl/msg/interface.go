@@ -1,6 +1,9 @@
 package msg
 
-import "io"
+import (
+	"io"
+	"time"
+)
 
 type MType byte
 
@@ -9,25 +12,60 @@ const (
 	MTypeRpc
 	MTypeNotice
 	MTypePush
+	MTypePing
+	MTypePong
 )
 
+// reserved modes, login or resume handshake is the first rpc frame of a session,
+// kick is pushed to a session replaced by another login of the account.
+const (
+	ModeLogin  uint32 = 0
+	ModeResume uint32 = 0xFFFFFFFF
+	ModeKick   uint32 = 0xFFFFFFFE
+)
+
+// ResumeWindowDef is the default window to resume a lost session in, for the server and clients.
+const ResumeWindowDef = 30 * time.Second
+
 // ModeMsg CodeMsg ----------------------------------------------------------------------------------------------------
 type ModeMsg interface {
+	Frame
 	MsgType() MType
+	GetSeq() uint32
+	SetSeq(seq uint32)
+	GetTrace() (traceID, spanID uint64)
+	SetTrace(traceID, spanID uint64)
+	GetCodec() SerializerType
+	SetCodec(codec SerializerType)
 	FillIn(mode uint32, data []byte)
 	GetMode() uint32
-	GetData() []byte
 	Encode(r io.Writer) error
 	Decode(r io.Reader) error
+	Release()
 }
 
 type CodeMsg interface {
+	Frame
 	MsgType() MType
+	GetSeq() uint32
+	SetSeq(seq uint32)
+	GetTrace() (traceID, spanID uint64)
+	SetTrace(traceID, spanID uint64)
+	GetCodec() SerializerType
+	SetCodec(codec SerializerType)
 	FillIn(code uint32, data []byte)
 	GetCode() uint32
-	GetData() []byte
 	Encode(r io.Writer) error
 	Decode(r io.Reader) error
+	Release()
+}
+
+// Frame data and flag of ModeMsg and CodeMsg, transformed by Transform.
+type Frame interface {
+	GetFlag() Flag
+	SetFlag(flag Flag)
+	GetData() []byte
+	SetData(data []byte)
 }
 
 // Serializer ----------------------------------------------------------------------------------------------------
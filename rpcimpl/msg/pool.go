@@ -0,0 +1,45 @@
+package msg
+
+import (
+	"math/bits"
+	"sync"
+)
+
+// buffer pools by power of two size class, from 512B to 1MB
+const (
+	minClassBits = 9
+	maxClassBits = 20
+)
+
+var bufPools [maxClassBits - minClassBits + 1]sync.Pool
+
+func bufClass(size int) int {
+	if size <= 1<<minClassBits {
+		return 0
+	}
+	return bits.Len(uint(size-1)) - minClassBits
+}
+
+// getBuf returns a buffer of len size, buffers larger than the max class are not pooled.
+func getBuf(size int) *[]byte {
+	var c = bufClass(size)
+	if c >= len(bufPools) {
+		var b = make([]byte, size)
+		return &b
+	}
+	if v := bufPools[c].Get(); v != nil {
+		var b = v.(*[]byte)
+		*b = (*b)[:size]
+		return b
+	}
+	var b = make([]byte, size, 1<<(c+minClassBits))
+	return &b
+}
+
+func putBuf(b *[]byte) {
+	var n = cap(*b)
+	if n < 1<<minClassBits || n > 1<<maxClassBits || n&(n-1) != 0 {
+		return
+	}
+	bufPools[bufClass(n)].Put(b)
+}
@@ -4,43 +4,74 @@ import (
 	"encoding/json"
 	"fmt"
 
-	"tiny_rpc/log"
 	"github.com/golang/protobuf/proto"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"tiny_rpc/log"
 )
 
+// SerializerType is also the codec id carried in Head
 type SerializerType byte
 
 const (
 	SerializerJson SerializerType = iota
 	SerializerPB
+	SerializerMsgpack
+	SerializerRaw
+	serializerCount
 )
 
-var defSerializer Serializer
+var serializers = [serializerCount]Serializer{
+	SerializerJson:    JsonSerializer{},
+	SerializerPB:      PBSerializer{},
+	SerializerMsgpack: MsgpackSerializer{},
+	SerializerRaw:     RawSerializer{},
+}
+
+var defType = SerializerJson
 
+// SetSerializer set default serializer, used when codec is not declared.
 func SetSerializer(t SerializerType) {
-	switch t {
-	case SerializerJson:
-		defSerializer = JsonSerializer{}
-	case SerializerPB:
-		defSerializer = JsonSerializer{}
-	default:
+	if GetSerializer(t) == nil {
 		log.Error("Serializer not find,type %v", t)
+		return
 	}
+	defType = t
+}
 
+func DefSerializer() SerializerType {
+	return defType
 }
 
-func Marshal(v interface{}) ([]byte, error) {
-	if defSerializer == nil {
-		return nil, fmt.Errorf("defSerializer nil")
+func GetSerializer(t SerializerType) Serializer {
+	if t >= serializerCount {
+		return nil
 	}
-	return defSerializer.Marshal(v)
+	return serializers[t]
+}
+
+func Marshal(v interface{}) ([]byte, error) {
+	return MarshalWith(defType, v)
 }
 
 func Unmarshal(data []byte, v interface{}) error {
-	if defSerializer == nil {
-		return fmt.Errorf("defSerializer nil")
+	return UnmarshalWith(defType, data, v)
+}
+
+func MarshalWith(t SerializerType, v interface{}) ([]byte, error) {
+	var s = GetSerializer(t)
+	if s == nil {
+		return nil, fmt.Errorf("serializer %d not find", t)
+	}
+	return s.Marshal(v)
+}
+
+func UnmarshalWith(t SerializerType, data []byte, v interface{}) error {
+	var s = GetSerializer(t)
+	if s == nil {
+		return fmt.Errorf("serializer %d not find", t)
 	}
-	return defSerializer.Unmarshal(data, v)
+	return s.Unmarshal(data, v)
 }
 
 type JsonSerializer struct {
@@ -59,16 +90,50 @@ type PBSerializer struct {
 
 func (r PBSerializer) Marshal(v interface{}) ([]byte, error) {
 	m, ok := v.(proto.Message)
-	if ok {
-		return nil, fmt.Errorf("not proto msg")
+	if !ok {
+		return nil, fmt.Errorf("not proto msg %T", v)
 	}
 	return proto.Marshal(m)
 }
 
 func (r PBSerializer) Unmarshal(data []byte, v interface{}) error {
 	m, ok := v.(proto.Message)
-	if ok {
-		return fmt.Errorf("not proto msg")
+	if !ok {
+		return fmt.Errorf("not proto msg %T", v)
 	}
 	return proto.Unmarshal(data, m)
 }
+
+type MsgpackSerializer struct {
+}
+
+func (r MsgpackSerializer) Marshal(v interface{}) ([]byte, error) {
+	return msgpack.Marshal(v)
+}
+
+func (r MsgpackSerializer) Unmarshal(data []byte, v interface{}) error {
+	return msgpack.Unmarshal(data, v)
+}
+
+// RawSerializer pass bytes through, v must be []byte or *[]byte.
+type RawSerializer struct {
+}
+
+func (r RawSerializer) Marshal(v interface{}) ([]byte, error) {
+	switch b := v.(type) {
+	case []byte:
+		return b, nil
+	case *[]byte:
+		return *b, nil
+	}
+	return nil, fmt.Errorf("not raw bytes %T", v)
+}
+
+func (r RawSerializer) Unmarshal(data []byte, v interface{}) error {
+	b, ok := v.(*[]byte)
+	if !ok {
+		return fmt.Errorf("not raw bytes ptr %T", v)
+	}
+	*b = append((*b)[:0], data...)
+	return nil
+}
@@ -0,0 +1,215 @@
+package msg
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// CompressMinSize data shorter than it is not compressed.
+const CompressMinSize = 256
+
+const transformFlags = FlagSnappy | FlagZstd | FlagEncrypt
+
+var ErrNoCipher = errors.New("encrypted frame without cipher key")
+
+// Transform compresses and encrypts data of outgoing frames by its flag, incoming frames are
+// restored by their own flags.
+// Flags are negotiated in the login or resume handshake: the request flag is what the client wants,
+// the response flag is what the server accepts. Handshake frames are never transformed.
+// A nil Transform sends frames as is.
+type Transform struct {
+	flag Flag
+	aead cipher.AEAD
+}
+
+// NewTransform key is an AES-128/192/256 key shared by client and server,
+// FlagEncrypt is dropped when key is empty.
+func NewTransform(flag Flag, key []byte) (*Transform, error) {
+	var t = &Transform{flag: flag}
+	if len(key) == 0 {
+		t.flag &^= FlagEncrypt
+		return t, nil
+	}
+	var block, err = aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("transform cipher err %v", err)
+	}
+	if t.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, fmt.Errorf("transform cipher err %v", err)
+	}
+	return t, nil
+}
+
+func (t *Transform) Flag() Flag {
+	if t == nil {
+		return 0
+	}
+	return t.flag
+}
+
+// Negotiate returns a transform using flags both want and t support, zstd is preferred over snappy.
+func (t *Transform) Negotiate(want Flag) *Transform {
+	var flag = want & t.Flag()
+	if flag&FlagZstd != 0 {
+		flag &^= FlagSnappy
+	}
+	if flag == 0 {
+		return nil
+	}
+	return &Transform{flag: flag, aead: t.aead}
+}
+
+// Pack transforms f data, f already carrying any flag of t is left as is,
+// so frames kept for resume are not packed twice.
+func (t *Transform) Pack(f Frame) error {
+	var flag = f.GetFlag()
+	if t == nil || flag&t.flag != 0 {
+		return nil
+	}
+
+	var data = f.GetData()
+	switch {
+	case len(data) < CompressMinSize:
+	case t.flag&FlagZstd != 0:
+		var enc, err = zstdEncoder()
+		if err != nil {
+			return err
+		}
+		data = enc.EncodeAll(data, nil)
+		flag |= FlagZstd
+	case t.flag&FlagSnappy != 0:
+		data = snappy.Encode(nil, data)
+		flag |= FlagSnappy
+	}
+	if t.flag&FlagEncrypt != 0 {
+		var nonce = make([]byte, t.aead.NonceSize(), t.aead.NonceSize()+len(data)+t.aead.Overhead())
+		if _, err := rand.Read(nonce); err != nil {
+			return fmt.Errorf("transform nonce err %v", err)
+		}
+		data = t.aead.Seal(nonce, nonce, data, nil)
+		flag |= FlagEncrypt
+	}
+	flag |= t.flag & FlagCRC
+
+	f.SetData(data)
+	f.SetFlag(flag)
+	return nil
+}
+
+// Unpack restores f data by f flags.
+func (t *Transform) Unpack(f Frame) error {
+	var flag = f.GetFlag()
+	if flag&transformFlags == 0 {
+		return nil
+	}
+
+	var data = f.GetData()
+	var err error
+	if flag&FlagEncrypt != 0 {
+		if t == nil || t.aead == nil {
+			return ErrNoCipher
+		}
+		var n = t.aead.NonceSize()
+		if len(data) < n {
+			return fmt.Errorf("transform decrypt short data %d", len(data))
+		}
+		if data, err = t.aead.Open(nil, data[:n], data[n:], nil); err != nil {
+			return fmt.Errorf("transform decrypt err %v", err)
+		}
+	}
+	switch {
+	case flag&FlagZstd != 0:
+		// the header check rejects a large first frame early, the decoder limits the sum of all
+		// concatenated frames
+		var max = MaxFrameSize()
+		var h zstd.Header
+		if err = h.Decode(data); err != nil {
+			return fmt.Errorf("transform zstd header err %v", err)
+		}
+		if !h.HasFCS || (max > 0 && h.FrameContentSize > uint64(max)) {
+			return fmt.Errorf("%w zstd content size %d", ErrFrameTooLarge, h.FrameContentSize)
+		}
+		var dec *zstd.Decoder
+		if dec, err = zstdDecoder(max); err != nil {
+			return err
+		}
+		if data, err = dec.DecodeAll(data, nil); errors.Is(err, zstd.ErrDecoderSizeExceeded) {
+			return fmt.Errorf("%w zstd %v", ErrFrameTooLarge, err)
+		} else if err != nil {
+			return fmt.Errorf("transform zstd err %v", err)
+		}
+		if max > 0 && uint64(len(data)) > uint64(max) {
+			return fmt.Errorf("%w zstd len %d", ErrFrameTooLarge, len(data))
+		}
+	case flag&FlagSnappy != 0:
+		var n int
+		if n, err = snappy.DecodedLen(data); err != nil {
+			return fmt.Errorf("transform snappy err %v", err)
+		}
+		if max := MaxFrameSize(); max > 0 && uint32(n) > max {
+			return fmt.Errorf("%w snappy len %d", ErrFrameTooLarge, n)
+		}
+		if data, err = snappy.Decode(nil, data); err != nil {
+			return fmt.Errorf("transform snappy err %v", err)
+		}
+	}
+
+	f.SetData(data)
+	f.SetFlag(flag &^ transformFlags)
+	return nil
+}
+
+// zstd coders are safe for concurrent EncodeAll and DecodeAll,
+// the decoder is rebuilt when MaxFrameSize changes so its memory limit follows it
+var zstdCoder struct {
+	sync.Mutex
+	enc *zstd.Encoder
+	dec *zstd.Decoder
+	max uint32 // MaxFrameSize of dec
+}
+
+func zstdEncoder() (*zstd.Encoder, error) {
+	zstdCoder.Lock()
+	defer zstdCoder.Unlock()
+	if zstdCoder.enc == nil {
+		var enc, err = zstd.NewWriter(nil)
+		if err != nil {
+			return nil, fmt.Errorf("transform zstd encoder err %v", err)
+		}
+		zstdCoder.enc = enc
+	}
+	return zstdCoder.enc, nil
+}
+
+func zstdDecoder(max uint32) (*zstd.Decoder, error) {
+	zstdCoder.Lock()
+	defer zstdCoder.Unlock()
+	if zstdCoder.dec == nil || zstdCoder.max != max {
+		if err := zstdInit(max); err != nil {
+			return nil, err
+		}
+	}
+	return zstdCoder.dec, nil
+}
+
+// zstdInit builds the decoder limiting decoded size to max, 0 for the decoder default.
+// An old decoder may still be in use by DecodeAll, it is left to the gc.
+func zstdInit(max uint32) error {
+	var opts []zstd.DOption
+	if max > 0 {
+		opts = append(opts, zstd.WithDecoderMaxMemory(uint64(max)))
+	}
+	var dec, err = zstd.NewReader(nil, opts...)
+	if err != nil {
+		return fmt.Errorf("transform zstd decoder err %v", err)
+	}
+	zstdCoder.dec, zstdCoder.max = dec, max
+	return nil
+}
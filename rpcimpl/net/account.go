@@ -0,0 +1,201 @@
+package net
+
+import (
+	"fmt"
+	"sync"
+
+	"tiny_rpc/model"
+	"tiny_rpc/msg"
+	"tiny_rpc/util"
+)
+
+// ExecQueueSize limits functions queued by ExecAccount for one account.
+const ExecQueueSize = 1024
+
+// A logged in account has one registered session and one executor.
+// Another login of the account kicks the registered session: it gets a ModeKick push,
+// stops reading and is never resumed.
+// Works of all sessions of an account and ExecAccount functions run on the account executor
+// in order, so handlers for one account never race.
+
+// executor runs functions of one account in order, its goroutine exits when the queue is empty.
+type executor struct {
+	id   string
+	refs int // bound sessions and queued functions, guarded by mgr l
+
+	l       sync.Mutex
+	queue   []func()
+	running bool
+}
+
+// submit queues f, bounded submit fails when ExecQueueSize functions are waiting.
+func (e *executor) submit(f func(), bounded bool) error {
+	e.l.Lock()
+	defer e.l.Unlock()
+	if bounded && len(e.queue) >= ExecQueueSize {
+		return fmt.Errorf("account %s executor queue full", e.id)
+	}
+	e.queue = append(e.queue, f)
+	if !e.running {
+		e.running = true
+		go e.run()
+	}
+	return nil
+}
+
+func (e *executor) run() {
+	for {
+		e.l.Lock()
+		if len(e.queue) == 0 {
+			e.running = false
+			e.l.Unlock()
+			return
+		}
+		var f = e.queue[0]
+		e.queue[0] = nil
+		e.queue = e.queue[1:]
+		e.l.Unlock()
+		f()
+	}
+}
+
+// Session ---------------------------------------------------------------------------------------------------
+
+// bind registers s for its account, the session replaced is kicked.
+func (s *Session) bind() {
+	s.setLogger()
+	var old = s.mgr.bindAccount(s)
+	if old == nil {
+		return
+	}
+	s.logger().Info("login again, kick session %d", old.ID)
+	old.kick()
+}
+
+// run calls f on the account executor and waits for it.
+func (s *Session) run(f func()) {
+	_ = s.exec.submit(func() {
+		defer func() { s.execDone <- struct{}{} }()
+		f()
+	}, false)
+	<-s.execDone
+}
+
+// kick closes s replaced by another login of its account, s is never resumed.
+// Works already queued are still served before the connection closed.
+func (s *Session) kick() {
+	s.rl.Lock()
+	if s.next != nil {
+		s.rl.Unlock()
+		return
+	}
+	var detached = s.timer != nil && !s.expired
+	s.expired = true
+	if detached {
+		s.timer.Stop()
+		s.buf, s.late = nil, nil
+	}
+	s.rl.Unlock()
+
+	if detached {
+		s.mgr.remove(s)
+		return
+	}
+	kicked.Inc()
+	var kick = new(msg.PushBase)
+	kick.FillIn(msg.ModeKick, nil)
+	kick.SetCodec(s.Codec())
+	_ = s.write(kick)
+	s.shutdown()
+}
+
+// SessionMgr ------------------------------------------------------------------------------------------------
+
+// bindAccount registers s for its account and takes the account executor, returns the session replaced.
+func (r *SessionMgr) bindAccount(s *Session) *Session {
+	var id = s.Account.ID()
+	r.l.Lock()
+	defer r.l.Unlock()
+	var old = r.accounts[id]
+	r.accounts[id] = s
+	s.exec = r.acquireExec(id)
+	return old
+}
+
+// acquireExec called with l held.
+func (r *SessionMgr) acquireExec(id string) *executor {
+	var e = r.executors[id]
+	if e == nil {
+		e = &executor{id: id}
+		r.executors[id] = e
+	}
+	e.refs++
+	return e
+}
+
+// releaseExec called with l held, the executor is dropped when nothing refers to it.
+func (r *SessionMgr) releaseExec(e *executor) {
+	if e.refs--; e.refs == 0 && r.executors[e.id] == e {
+		delete(r.executors, e.id)
+	}
+}
+
+// GetAccount returns the session of account, the session may be waiting for resume.
+func (r *SessionMgr) GetAccount(accountId string) *Session {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	return r.accounts[accountId]
+}
+
+// PushAccount sends a push message to account wherever it is connected,
+// it is buffered when the session is waiting for resume.
+func (r *SessionMgr) PushAccount(accountId string, mode uint32, v interface{}) error {
+	var s = r.GetAccount(accountId)
+	if s == nil {
+		return fmt.Errorf("push mode %d account %s %w", mode, accountId, model.ErrAccountOffline)
+	}
+	return s.Push(mode, v)
+}
+
+// PushAccounts sends a push message to a set of accounts, offline accounts are skipped.
+func (r *SessionMgr) PushAccounts(accountIds []string, mode uint32, v interface{}) error {
+	var sessions = make([]*Session, 0, len(accountIds))
+	r.l.RLock()
+	for _, id := range accountIds {
+		if s := r.accounts[id]; s != nil {
+			sessions = append(sessions, s)
+		}
+	}
+	r.l.RUnlock()
+	return r.push(sessions, mode, v)
+}
+
+// ExecAccount runs f with the account on its executor after the handlers already queued,
+// f must not wait for handlers of the account.
+func (r *SessionMgr) ExecAccount(accountId string, f func(a model.AccountI)) error {
+	r.l.Lock()
+	var s = r.accounts[accountId]
+	if s == nil {
+		r.l.Unlock()
+		return fmt.Errorf("exec account %s %w", accountId, model.ErrAccountOffline)
+	}
+	var a = s.Account
+	var e = r.acquireExec(accountId)
+	r.l.Unlock()
+
+	var err = e.submit(func() {
+		defer func() {
+			r.l.Lock()
+			r.releaseExec(e)
+			r.l.Unlock()
+		}()
+		defer util.InfoPanic("exec account %s", accountId)
+		f(a)
+	}, true)
+	if err != nil {
+		r.l.Lock()
+		r.releaseExec(e)
+		r.l.Unlock()
+	}
+	return err
+}
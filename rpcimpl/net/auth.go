@@ -0,0 +1,73 @@
+package net
+
+import (
+	"fmt"
+	"time"
+
+	"tiny_rpc/codes"
+	"tiny_rpc/msg"
+)
+
+const AuthTimeoutDef = 10 * time.Second
+
+// Authenticator verify the login frame data and return the account id, data is only valid during Auth.
+type Authenticator interface {
+	Auth(data []byte) (accountId string, err error)
+}
+
+type AuthFunc func(data []byte) (string, error)
+
+func (f AuthFunc) Auth(data []byte) (string, error) {
+	return f(data)
+}
+
+// login read the first frame as login or resume handshake and load the account.
+func (s *Session) login() error {
+	_ = s.SetReadDeadline(time.Now().Add(s.mgr.authTimeout))
+	var baseReq = new(msg.RequestBase)
+	var err = baseReq.Decode(s.r)
+	if err != nil {
+		return fmt.Errorf("login read err %v", err)
+	}
+	defer baseReq.Release()
+	_ = s.SetReadDeadline(time.Time{})
+
+	// login response data is the resume token
+	var baseRsp = new(msg.ResponseBase)
+	baseRsp.SetSeq(baseReq.GetSeq())
+	baseRsp.SetCodec(msg.SerializerRaw)
+	if baseReq.MsgType() == msg.MTypeRpc && baseReq.GetMode() == msg.ModeResume {
+		return s.resume(baseReq, baseRsp)
+	}
+	s.setCodec(baseReq.GetCodec())
+	if baseReq.MsgType() != msg.MTypeRpc || baseReq.GetMode() != msg.ModeLogin {
+		err = fmt.Errorf("login illegal frame type %v mode %d", baseReq.MsgType(), baseReq.GetMode())
+	}
+
+	var accountId string
+	if err == nil {
+		accountId, err = s.mgr.auth.Auth(baseReq.GetData())
+	}
+	if err == nil {
+		s.Account, err = s.mgr.loader.LoadAccount(accountId)
+	}
+	if err != nil {
+		baseRsp.FillIn(codes.AuthFail, nil)
+		_ = s.write(baseRsp)
+		return err
+	}
+
+	s.bind()
+
+	// handshake frames are not transformed, flags carry the negotiation
+	var tf = s.mgr.tf.Negotiate(baseReq.GetFlag())
+	s.token = newToken()
+	s.mgr.addToken(s)
+	baseRsp.FillIn(codes.OK, []byte(s.token))
+	baseRsp.SetFlag(tf.Flag())
+	if err = s.write(baseRsp); err != nil {
+		return err
+	}
+	s.tf.Store(tf)
+	return nil
+}
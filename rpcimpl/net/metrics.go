@@ -0,0 +1,40 @@
+package net
+
+import (
+	"tiny_rpc/metrics"
+	"tiny_rpc/msg"
+)
+
+var (
+	sessionsVec  = metrics.NewGaugeVec("tiny_rpc_sessions_active", "Sessions of all session mgrs, detached sessions waiting for resume included.")
+	framesInVec  = metrics.NewCounterVec("tiny_rpc_frames_in_total", "Frames read from sessions.")
+	framesOutVec = metrics.NewCounterVec("tiny_rpc_frames_out_total", "Frames written to sessions.")
+	bytesInVec   = metrics.NewCounterVec("tiny_rpc_bytes_in_total", "Frame bytes read from sessions.")
+	bytesOutVec  = metrics.NewCounterVec("tiny_rpc_bytes_out_total", "Frame bytes written to sessions.")
+	resumedVec   = metrics.NewCounterVec("tiny_rpc_sessions_resumed_total", "Sessions resumed after connection lost.")
+	kickedVec    = metrics.NewCounterVec("tiny_rpc_sessions_kicked_total", "Sessions kicked by another login of the account.")
+
+	sessionsActive = sessionsVec.With()
+	framesIn       = framesInVec.With()
+	framesOut      = framesOutVec.With()
+	bytesIn        = bytesInVec.With()
+	bytesOut       = bytesOutVec.With()
+	resumed        = resumedVec.With()
+	kicked         = kickedVec.With()
+)
+
+func init() {
+	metrics.Register(sessionsVec, framesInVec, framesOutVec, bytesInVec, bytesOutVec, resumedVec, kickedVec)
+}
+
+// frameSize of a decoded frame on the wire.
+func frameSize(f msg.Frame) uint64 {
+	var n = uint64(msg.HeadLen + len(f.GetData()))
+	if f.GetFlag()&msg.FlagCRC != 0 {
+		n += 4
+	}
+	if f.GetFlag()&msg.FlagTrace != 0 {
+		n += msg.TraceLen
+	}
+	return n
+}
@@ -0,0 +1,175 @@
+package net
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"tiny_rpc/codes"
+	"tiny_rpc/msg"
+)
+
+const (
+	ResumeBufSize = 256
+)
+
+// A logged in session gets a resume token with the login response.
+// When its connection is lost the session is detached instead of removed: the ID and
+// account are kept for mgr resumeWindow and frames written meanwhile are buffered.
+// A new connection sending ModeResume with the token takes over the detached session,
+// the buffered responses and pushes are flushed to it.
+
+func newToken() string {
+	var b = make([]byte, 16)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// keep buffers m written after the session lost its connection.
+func (s *Session) keep(m encoder) error {
+	s.rl.Lock()
+	if next := s.next; next != nil {
+		s.rl.Unlock()
+		return next.write(m)
+	}
+	defer s.rl.Unlock()
+	if s.expired || s.token == "" {
+		return ErrSessionClosed
+	}
+	if len(s.buf)+len(s.late) >= ResumeBufSize {
+		return fmt.Errorf("session %d resume buffer full", s.ID)
+	}
+	s.late = append(s.late, m)
+	return nil
+}
+
+// detach is called when session goroutines finished, the session waits for resume
+// or is removed when it can not be resumed.
+func (s *Session) detach() {
+	defer close(s.ended)
+	<-s.wdone
+
+	var window = s.mgr.resumeWindow
+	s.rl.Lock()
+	var resumable = s.token != "" && window > 0 && atomic.LoadInt32(&s.draining) == 0 && !s.expired
+	var n = len(s.buf)
+	if resumable {
+		s.timer = time.AfterFunc(window, s.expire)
+	} else {
+		s.expired = true
+		s.buf, s.late = nil, nil
+	}
+	s.rl.Unlock()
+
+	if !resumable {
+		s.mgr.remove(s)
+		return
+	}
+	s.logger().Info("detached, keep %d frames for resume", n)
+}
+
+func (s *Session) info(info *SessionInfo) {
+	info.Codec = s.Codec()
+	if addr := s.RemoteAddr(); addr != nil {
+		info.Remote = addr.String()
+	}
+	s.rl.Lock()
+	info.Detached = s.timer != nil && s.next == nil && !s.expired
+	s.rl.Unlock()
+}
+
+// noResume the session is dropped when connection lost, such as protocol errors.
+func (s *Session) noResume() {
+	s.rl.Lock()
+	defer s.rl.Unlock()
+	s.expired = true
+}
+
+// expire drops a detached session not resumed in time.
+func (s *Session) expire() {
+	s.rl.Lock()
+	if s.next != nil || s.expired {
+		s.rl.Unlock()
+		return
+	}
+	s.expired = true
+	if s.timer != nil {
+		s.timer.Stop()
+	}
+	var n = len(s.buf) + len(s.late)
+	s.buf, s.late = nil, nil
+	s.rl.Unlock()
+
+	s.mgr.remove(s)
+	s.logger().Info("resume expired, drop %d frames", n)
+}
+
+// takeover moves the detached session to s, returns the buffered frames and the transform of old,
+// the transform is stored by the caller after the handshake response is written.
+func (s *Session) takeover(old *Session) ([]encoder, *msg.Transform, error) {
+	old.rl.Lock()
+	defer old.rl.Unlock()
+	if old.next != nil || old.expired {
+		return nil, nil, fmt.Errorf("session %d already resumed or expired", old.ID)
+	}
+	old.timer.Stop()
+	old.next = s
+	var frames = append(old.buf, old.late...)
+	old.buf, old.late = nil, nil
+
+	s.ID = old.ID
+	s.Account = old.Account
+	s.exec, old.exec = old.exec, nil
+	s.token = old.token
+	s.setCodec(old.Codec())
+	return frames, old.transform(), nil
+}
+
+// resume handles ModeResume handshake, a session still alive with the token
+// is treated as half open and closed first.
+func (s *Session) resume(baseReq *msg.RequestBase, baseRsp *msg.ResponseBase) error {
+	var token = string(baseReq.GetData())
+	var old = s.mgr.getToken(token)
+	if old == nil {
+		baseRsp.FillIn(codes.AuthFail, nil)
+		_ = s.write(baseRsp)
+		return fmt.Errorf("resume token not find")
+	}
+
+	old.stop()
+	select {
+	case <-old.ended:
+	case <-time.After(s.mgr.authTimeout):
+		baseRsp.FillIn(codes.AuthFail, nil)
+		_ = s.write(baseRsp)
+		return fmt.Errorf("resume session %d wait end timeout", old.ID)
+	}
+
+	var tmpID = s.ID
+	var frames, tf, err = s.takeover(old)
+	if err != nil {
+		baseRsp.FillIn(codes.AuthFail, nil)
+		_ = s.write(baseRsp)
+		return err
+	}
+	s.mgr.replace(tmpID, s)
+
+	// handshake frames are never transformed, frames after it are
+	baseRsp.FillIn(codes.OK, []byte(s.token))
+	baseRsp.SetFlag(tf.Flag())
+	if err = s.write(baseRsp); err != nil {
+		return err
+	}
+	s.tf.Store(tf)
+	for _, m := range frames {
+		if err = s.write(m); err != nil {
+			return err
+		}
+	}
+	resumed.Inc()
+	s.setLogger()
+	s.logger().Info("resumed from session %d, flush %d frames", tmpID, len(frames))
+	return nil
+}
@@ -1,114 +1,422 @@
 package net
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net"
-	"strings"
-	"unsafe"
+	"sync"
+	"sync/atomic"
+	"time"
 
+	"tiny_rpc/codes"
 	"tiny_rpc/log"
 	"tiny_rpc/model"
 	"tiny_rpc/msg"
 	"tiny_rpc/router"
+	"tiny_rpc/trace"
+	"tiny_rpc/transport"
 	"tiny_rpc/util"
 )
 
+const (
+	SendChanSize = 1024
+	WorkChanSize = 1024
+
+	// frames already queued are written together up to the limits
+	WriteBatchSize  = 64
+	WriteBatchBytes = 64 << 10
+
+	ReadIdleDef     = 30 * time.Second
+	WriteTimeoutDef = 10 * time.Second
+)
+
+var ErrSessionClosed = errors.New("session closed")
+
 type SessionID uint32
 
+type encoder interface {
+	Encode(w io.Writer) error
+}
+
 type Session struct {
 	net.Conn
-	wg      *util.WGWrapper
-	works   chan msg.ModeMsg
-	ID      SessionID
-	Account model.AccountI
+	r        *msg.Reader
+	w        *msg.Writer // used by writeLoop only
+	wg       *util.WGWrapper
+	mgr      *SessionMgr
+	works    chan msg.ModeMsg
+	sends    chan encoder
+	wl       sync.RWMutex // guard sends close
+	wclosed  bool
+	wdone    chan struct{}
+	ended    chan struct{}
+	draining int32
+	once     sync.Once
+	codec    uint32
+	tf       atomic.Value // *msg.Transform negotiated in handshake
+	lg       atomic.Value // *log.Logger with session and account fields
+	ID       SessionID
+	Account  model.AccountI
+	exec     *executor // account executor, see account.go
+	execDone chan struct{}
+
+	// resume, see resume.go
+	token   string
+	rl      sync.Mutex // guard follows
+	buf     []encoder  // frames lost with the connection
+	late    []encoder  // frames written after the connection lost
+	next    *Session
+	expired bool
+	timer   *time.Timer
 }
 
-func newSession(conn net.Conn, id SessionID, wg *util.WGWrapper) *Session {
-	return &Session{
-		Conn:  conn,
-		ID:    id,
-		wg:    wg,
-		works: make(chan msg.ModeMsg, 2^10),
+func newSession(conn net.Conn, id SessionID, mgr *SessionMgr) *Session {
+	var s = &Session{
+		Conn:     conn,
+		r:        msg.NewReader(conn),
+		w:        msg.NewWriter(conn),
+		ID:       id,
+		wg:       mgr.wg,
+		mgr:      mgr,
+		works:    make(chan msg.ModeMsg, WorkChanSize),
+		sends:    make(chan encoder, SendChanSize),
+		wdone:    make(chan struct{}),
+		ended:    make(chan struct{}),
+		execDone: make(chan struct{}, 1),
+		codec:    uint32(msg.DefSerializer()),
 	}
+	s.lg.Store(log.With(log.Session(uint32(id))))
+	return s
+}
+
+// Codec returns the serializer declared by the latest client frame, pushes are encoded with it.
+func (s *Session) Codec() msg.SerializerType {
+	return msg.SerializerType(atomic.LoadUint32(&s.codec))
+}
+
+func (s *Session) setCodec(codec msg.SerializerType) {
+	atomic.StoreUint32(&s.codec, uint32(codec))
+}
+
+func (s *Session) logger() *log.Logger {
+	return s.lg.Load().(*log.Logger)
+}
+
+// setLogger adds the account to the session logger after login or resume.
+func (s *Session) setLogger() {
+	s.lg.Store(log.With(log.Session(uint32(s.ID)), log.Account(s.Account.ID())))
+}
+
+func (s *Session) transform() *msg.Transform {
+	var tf, _ = s.tf.Load().(*msg.Transform)
+	return tf
 }
 
 func (s *Session) start() {
-	//db load
-	s.Account = &model.PlayerAccount{AccountId: "zhang"}
+	//go write
+	s.wg.Wrap(s.writeLoop)
+	defer s.detach()
+	defer s.closeWrite()
+
+	if s.mgr.auth == nil {
+		s.Account = &model.PlayerAccount{AccountId: fmt.Sprintf("guest_%d", s.ID)}
+		s.bind()
+	} else if err := s.login(); err != nil {
+		s.logger().Error("login err %v", err)
+		return
+	}
+	s.logger().Info("login")
 
 	//go receive
-	s.wg.Wrap(func() {
-		for {
-			var modeMsg = new(msg.ModeBase)
-			var err = modeMsg.Decode(s)
-			if err != nil {
-				if err == io.EOF || strings.Contains(err.Error(), "use of closed network connection") {
-					log.Info("Session %v connect close.", s.ID)
-					return
-				}
-				log.Error("Session %d modeMsg Decode err %v", s.ID, err)
+	s.wg.Wrap(s.readLoop)
+
+	//work handle
+	s.handle()
+}
+
+// readLoop reads frames until error, ping is answered here without queueing.
+// The session is closed when nothing received in mgr readIdle.
+func (s *Session) readLoop() {
+	defer close(s.works)
+	for {
+		if s.mgr.readIdle > 0 {
+			_ = s.SetReadDeadline(time.Now().Add(s.mgr.readIdle))
+		}
+		// checked after deadline set, shutdown may reset deadline before
+		if atomic.LoadInt32(&s.draining) == 1 {
+			s.logger().Info("stop read for shutdown")
+			s.rejectBuffered()
+			return
+		}
+
+		var modeMsg = new(msg.ModeBase)
+		var err = modeMsg.Decode(s.r)
+		if err != nil {
+			if atomic.LoadInt32(&s.draining) == 1 {
+				s.logger().Info("stop read for shutdown")
+				s.rejectBuffered()
+				return
+			}
+			if transport.IsClosed(err) {
+				s.logger().Info("connect close")
 				return
 			}
+			if ne, ok := err.(net.Error); ok && ne.Timeout() {
+				s.logger().Info("read idle timeout %v", s.mgr.readIdle)
+				s.stop()
+				return
+			}
+			s.logger().Error("modeMsg Decode err %v", err)
+			s.noResume()
+			return
+		}
+		framesIn.Inc()
+		bytesIn.Add(frameSize(modeMsg))
+		if err = s.transform().Unpack(modeMsg); err != nil {
+			s.logger().Errorw("unpack err", log.Mode(modeMsg.GetMode()), log.Err(err))
+			s.noResume()
+			return
+		}
 
+		switch modeMsg.MsgType() {
+		case msg.MTypePing:
+			var pong = new(msg.PongBase)
+			pong.FillIn(modeMsg.GetMode(), nil)
+			pong.SetSeq(modeMsg.GetSeq())
+			modeMsg.Release()
+			_ = s.write(pong)
+		case msg.MTypePong:
+			modeMsg.Release()
+		default:
 			s.works <- modeMsg
 		}
-	})
+	}
+}
 
-	//work handle
-	s.handle()
+// rejectBuffered answers rpc frames already read into the buffer with codes.Shutdown,
+// they are not served after the session stops reading for shutdown.
+func (s *Session) rejectBuffered() {
+	_ = s.SetReadDeadline(time.Now())
+	var n int
+	for s.r.Buffered() > 0 {
+		var req = new(msg.ModeBase)
+		if err := req.Decode(s.r); err != nil {
+			break
+		}
+		if req.MsgType() == msg.MTypeRpc {
+			var rsp = new(msg.ResponseBase)
+			rsp.FillIn(codes.Shutdown, nil)
+			rsp.SetSeq(req.GetSeq())
+			rsp.SetCodec(req.GetCodec())
+			_ = s.write(rsp)
+			n++
+		}
+		req.Release()
+	}
+	if n > 0 {
+		s.logger().Info("reject %d requests for shutdown", n)
+	}
+}
+
+// shutdown stops reading new frames, queued frames are served and responses are flushed before close.
+func (s *Session) shutdown() {
+	atomic.StoreInt32(&s.draining, 1)
+	_ = s.SetReadDeadline(time.Now())
 }
 
+// stop closes the connection at once.
 func (s *Session) stop() {
-	close(s.works)
+	s.once.Do(func() {
+		err := s.Close()
+		if err != nil {
+			s.logger().Error("close err %v", err)
+			return
+		}
+	})
+}
 
-	err := s.Close()
+// Push sends a server push message to the session.
+func (s *Session) Push(mode uint32, v interface{}) error {
+	var codec = s.Codec()
+	var data, err = msg.MarshalWith(codec, v)
 	if err != nil {
-		log.Error("Session close err %v %v", s.ID, err)
+		return fmt.Errorf("session %d push mode %d marshal err %v", s.ID, mode, err)
+	}
+	return s.push(mode, codec, data)
+}
+
+func (s *Session) push(mode uint32, codec msg.SerializerType, data []byte) error {
+	var basePush = new(msg.PushBase)
+	basePush.FillIn(mode, data)
+	basePush.SetCodec(codec)
+	return s.write(basePush)
+}
+
+// write packs m with the negotiated transform and queues it to the session writer,
+// m is kept for resume when the connection lost.
+func (s *Session) write(m encoder) error {
+	if f, ok := m.(msg.Frame); ok {
+		if err := s.transform().Pack(f); err != nil {
+			return err
+		}
+	}
+	s.wl.RLock()
+	if !s.wclosed {
+		s.sends <- m
+		s.wl.RUnlock()
+		return nil
+	}
+	s.wl.RUnlock()
+	return s.keep(m)
+}
+
+func (s *Session) closeWrite() {
+	s.wl.Lock()
+	defer s.wl.Unlock()
+	if s.wclosed {
 		return
 	}
+	s.wclosed = true
+	close(s.sends)
 }
 
-func (s *Session) handle() {
-	var err error
-	for work := range s.works {
-		switch work.MsgType() {
-		case msg.MTypeRpc:
-			err = s.handleRPC((*msg.RequestBase)(unsafe.Pointer(work.(*msg.ModeBase))))
-		case msg.MTypeNotice:
-			s.handleNotify((*msg.NotifyBase)(unsafe.Pointer(work.(*msg.ModeBase))))
-		case msg.MTypePush:
-			s.handlePush((*msg.PushBase)(unsafe.Pointer(work.(*msg.ModeBase))))
+// writeLoop writes queued frames until sends closed, then closes the connection.
+// Frames already queued are batched into one write, frames of a failed write and after are kept for resume.
+func (s *Session) writeLoop() {
+	defer close(s.wdone)
+	var failed bool
+	var batch = make([]encoder, 0, WriteBatchSize)
+	for m := range s.sends {
+		if failed {
+			s.rl.Lock()
+			s.buf = append(s.buf, m)
+			s.rl.Unlock()
+			continue
 		}
-		if err != nil {
-			log.Error("Session %d err %v", s.ID, err)
+
+		batch = append(batch[:0], m)
+		_ = m.Encode(s.w)
+	more:
+		for len(batch) < WriteBatchSize && s.w.Buffered() < WriteBatchBytes {
+			select {
+			case m, ok := <-s.sends:
+				if !ok {
+					break more
+				}
+				batch = append(batch, m)
+				_ = m.Encode(s.w)
+			default:
+				break more
+			}
+		}
+
+		if s.mgr.writeTimeout > 0 {
+			_ = s.SetWriteDeadline(time.Now().Add(s.mgr.writeTimeout))
+		}
+		var n = s.w.Buffered()
+		if err := s.w.Flush(); err != nil {
+			if !transport.IsClosed(err) {
+				s.logger().Error("write err %v", err)
+			}
+			failed = true
+			s.rl.Lock()
+			s.buf = append(s.buf, batch...)
+			s.rl.Unlock()
 			s.stop()
+			continue
 		}
+		framesOut.Add(uint64(len(batch)))
+		bytesOut.Add(uint64(n))
+	}
+	s.stop()
+}
+
+// handle serves works in order on the account executor.
+func (s *Session) handle() {
+	for work := range s.works {
+		s.run(func() {
+			s.serve(work)
+		})
+	}
+}
+
+func (s *Session) serve(work msg.ModeMsg) {
+	var err error
+	s.setCodec(work.GetCodec())
+	switch work.MsgType() {
+	case msg.MTypeRpc:
+		err = s.handleRPC(work)
+	case msg.MTypeNotice:
+		s.handleNotify(work)
+	case msg.MTypePush:
+		s.handlePush(work)
+	}
+	work.Release()
+	if err != nil {
+		s.logger().Errorw("serve err", log.Mode(work.GetMode()), log.Err(err))
+		s.stop()
 	}
 }
 
-func (s *Session) handleRPC(baseReq *msg.RequestBase) error {
+func (s *Session) handleRPC(baseReq msg.ModeMsg) error {
 	var baseRsp = new(msg.ResponseBase)
+	baseRsp.SetSeq(baseReq.GetSeq())
+	baseRsp.SetCodec(baseReq.GetCodec())
 
 	// serve handle
-	var err = router.HandleServe(s.Account, baseReq, baseRsp)
+	var ctx, span = s.context(baseReq, "rpc")
+	var err = router.HandleServe(ctx, baseReq, baseRsp)
+	span.SetAttrs(log.F("code", baseRsp.GetCode()))
+	span.End(err)
 	if err != nil {
-		return err
+		// the request fails with a code, the session goes on
+		s.logger().Warnw("serve failed", log.Mode(baseReq.GetMode()), log.F("code", baseRsp.GetCode()), log.Err(err))
+		if baseRsp.GetCode() == codes.OK {
+			baseRsp.FillIn(codes.Internal, nil)
+		}
+	}
+	if sc := trace.FromContext(ctx); sc.IsValid() {
+		baseRsp.SetTrace(sc.TraceID, sc.SpanID)
 	}
 
-	err = baseRsp.Encode(s)
+	err = s.write(baseRsp)
 	if err != nil {
-		if err == io.EOF {
-			log.Info("Session %v connect close.", s.ID)
-			return nil
-		}
 		return fmt.Errorf("write err %v", err)
 	}
 	return nil
 }
 
-func (s *Session) handleNotify(baseNotify *msg.NotifyBase) {
+// handleNotify serve one-way client message, the response is discarded.
+func (s *Session) handleNotify(baseNotify msg.ModeMsg) {
+	var baseRsp = new(msg.ResponseBase)
+	baseRsp.SetCodec(baseNotify.GetCodec())
+	var ctx, span = s.context(baseNotify, "notify")
+	var err = router.HandleServe(ctx, baseNotify, baseRsp)
+	span.SetAttrs(log.F("code", baseRsp.GetCode()))
+	span.End(err)
+	if err != nil {
+		s.logger().Errorw("notify err", log.Mode(baseNotify.GetMode()), log.Err(err))
+		return
+	}
+	if baseRsp.GetCode() != 0 {
+		s.logger().Warnw("notify failed", log.Mode(baseNotify.GetMode()), log.F("code", baseRsp.GetCode()))
+	}
+}
+
+// context returns the handler context of req, a span named name is started in the trace carried by req.
+func (s *Session) context(req msg.ModeMsg, name string) (*router.Context, *trace.Span) {
+	var ctx = context.Background()
+	if traceID, spanID := req.GetTrace(); traceID != 0 {
+		ctx = trace.NewContext(ctx, trace.SpanContext{TraceID: traceID, SpanID: spanID})
+	}
+	var span *trace.Span
+	ctx, span = trace.Start(ctx, name, log.Mode(req.GetMode()), log.Account(s.Account.ID()))
+	return &router.Context{Context: ctx, Account: s.Account}, span
 }
 
-func (s *Session) handlePush(basePush *msg.PushBase) {
+// handlePush push is server to client only.
+func (s *Session) handlePush(basePush msg.ModeMsg) {
+	s.logger().Warnw("receive push from client, ignore", log.Mode(basePush.GetMode()))
 }
@@ -1,38 +1,152 @@
 package net
 
 import (
+	"context"
+	"fmt"
 	"net"
+	"sort"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"tiny_rpc/log"
+	"tiny_rpc/model"
+	"tiny_rpc/msg"
+	"tiny_rpc/transport"
 	"tiny_rpc/util"
 )
 
 type SessionMgr struct {
-	net.Listener
+	listeners      []net.Listener
+	acceptWg       sync.WaitGroup
+	started        bool
 	wg             *util.WGWrapper
 	sessionCounter SessionID
 	l              sync.RWMutex
 	sessions       map[SessionID]*Session
+	tokens         map[string]*Session
+	accounts       map[string]*Session
+	executors      map[string]*executor
+	closed         bool
+	auth           Authenticator
+	authTimeout    time.Duration
+	loader         model.AccountLoader
+	readIdle       time.Duration
+	writeTimeout   time.Duration
+	resumeWindow   time.Duration
+	tf             *msg.Transform
 }
 
+// NewSessionMgr listens on network of transport, such as tcp, ws and kcp.
 func NewSessionMgr(network, address string) *SessionMgr {
-	listen, err := net.Listen(network, address)
-	if err != nil {
+	var r = &SessionMgr{
+		wg:           new(util.WGWrapper),
+		sessions:     make(map[SessionID]*Session, 4096),
+		tokens:       make(map[string]*Session, 4096),
+		accounts:     make(map[string]*Session, 4096),
+		executors:    make(map[string]*executor, 4096),
+		authTimeout:  AuthTimeoutDef,
+		loader:       model.NewMemLoader(),
+		readIdle:     ReadIdleDef,
+		writeTimeout: WriteTimeoutDef,
+		resumeWindow: msg.ResumeWindowDef,
+	}
+	if err := r.Listen(network, address); err != nil {
 		log.Error("NewSessionMgr err %v", err)
 		return nil
 	}
-	return &SessionMgr{
-		Listener: listen,
-		wg:       new(util.WGWrapper),
-		sessions: make(map[SessionID]*Session, 2^12),
+	return r
+}
+
+// Listen adds a listener, sessions of all listeners share the mgr.
+func (r *SessionMgr) Listen(network, address string) error {
+	listen, err := transport.Listen(network, address)
+	if err != nil {
+		return fmt.Errorf("listen %s %s err %v", network, address, err)
+	}
+
+	r.l.Lock()
+	defer r.l.Unlock()
+	if r.closed {
+		_ = listen.Close()
+		return fmt.Errorf("listen %s %s err session mgr closed", network, address)
+	}
+	r.listeners = append(r.listeners, listen)
+	if r.started {
+		r.acceptWg.Add(1)
+		go r.accept(listen)
+	}
+	log.Info("session mgr listen %s %s", network, listen.Addr())
+	return nil
+}
+
+// Addrs returns addresses of all listeners.
+func (r *SessionMgr) Addrs() []net.Addr {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	var addrs = make([]net.Addr, 0, len(r.listeners))
+	for _, ln := range r.listeners {
+		addrs = append(addrs, ln.Addr())
 	}
+	return addrs
+}
+
+// SetAuthenticator sessions must login as the first frame when authenticator set,
+// otherwise sessions run as guest accounts.
+func (r *SessionMgr) SetAuthenticator(auth Authenticator, timeout time.Duration) {
+	r.auth = auth
+	if timeout > 0 {
+		r.authTimeout = timeout
+	}
+}
+
+func (r *SessionMgr) SetAccountLoader(loader model.AccountLoader) {
+	r.loader = loader
+}
+
+// SetIdleTimeout sessions receive nothing in read are closed, a write blocks longer than write fails.
+// Zero disables the timeout. Clients keep alive by heartbeat ping.
+func (r *SessionMgr) SetIdleTimeout(read, write time.Duration) {
+	r.readIdle = read
+	r.writeTimeout = write
+}
+
+// SetTransform sets the frame flags sessions may negotiate at login, key is the shared
+// AES key for msg.FlagEncrypt. Frame size limit is msg.SetMaxFrameSize.
+// key is one pre-shared key for the process, not a per-session key. Login and resume handshakes
+// are never transformed, so their tokens travel in plaintext: encryption protects frames after the
+// handshake only, use a transport secured below the frames when tokens must be protected.
+func (r *SessionMgr) SetTransform(flag msg.Flag, key []byte) error {
+	var tf, err = msg.NewTransform(flag, key)
+	if err != nil {
+		return err
+	}
+	r.tf = tf
+	return nil
+}
+
+// SetResumeWindow how long a logged in session waits for resume after its connection lost,
+// zero disables resume.
+func (r *SessionMgr) SetResumeWindow(window time.Duration) {
+	r.resumeWindow = window
 }
 
+// Start accepts on all listeners, blocks until listeners closed.
 func (r *SessionMgr) Start() {
+	r.l.Lock()
+	r.started = true
+	for _, ln := range r.listeners {
+		r.acceptWg.Add(1)
+		go r.accept(ln)
+	}
+	r.l.Unlock()
+	r.acceptWg.Wait()
+}
+
+func (r *SessionMgr) accept(ln net.Listener) {
+	defer r.acceptWg.Done()
 	for {
-		conn, err := r.Accept()
+		conn, err := ln.Accept()
 		if err != nil {
 			if ne, ok := err.(net.Error); ok && ne.Temporary() {
 				log.Error("server accept err %v", err)
@@ -41,35 +155,239 @@ func (r *SessionMgr) Start() {
 			log.Info("server accept err %v", err)
 			return
 		}
-		atomic.AddUint32((*uint32)(&(r.sessionCounter)), 1)
-		var session = newSession(conn, r.sessionCounter, r.wg)
-		r.add(session)
+		var id = SessionID(atomic.AddUint32((*uint32)(&(r.sessionCounter)), 1))
+		var session = newSession(conn, id, r)
+		if !r.add(session) {
+			_ = conn.Close()
+			continue
+		}
 		r.wg.Wrap(session.start)
 	}
 }
 
 func (r *SessionMgr) Stop() {
-	err := r.Close()
-	if err != nil {
-		log.Error("server stop err %v", err)
+	r.closeListener()
+	var counter = r.each((*Session).stop)
+	r.wg.Wait()
+	r.expireDetached()
+	log.Info("server stop,accept count %d,stop session %d.", r.sessionCounter, counter)
+}
+
+// Shutdown stops accepting, sessions stop reading and finish in-flight requests.
+// Sessions still running when ctx done are closed at once.
+func (r *SessionMgr) Shutdown(ctx context.Context) error {
+	r.closeListener()
+	var counter = r.each((*Session).shutdown)
+
+	var done = make(chan struct{})
+	go func() {
+		r.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = fmt.Errorf("session mgr shutdown %v, force stop %d sessions", ctx.Err(), r.each((*Session).stop))
+		<-done
 	}
+	r.expireDetached()
+	log.Info("server shutdown,accept count %d,shutdown session %d.", r.sessionCounter, counter)
+	return err
+}
 
-	var counter = func() int {
-		r.l.RLock()
-		defer r.l.RUnlock()
+func (r *SessionMgr) closeListener() {
+	r.l.Lock()
+	r.closed = true
+	var listeners = r.listeners
+	r.l.Unlock()
 
-		var counter = len(r.sessions)
-		for _, s := range r.sessions {
-			s.stop()
+	for _, ln := range listeners {
+		if err := ln.Close(); err != nil {
+			log.Error("server stop listener %s err %v", ln.Addr(), err)
 		}
-		return counter
-	}()
-	r.wg.Wait()
-	log.Info("server stop,accept count %d,stop session %d.", r.sessionCounter, counter)
+	}
+}
+
+func (r *SessionMgr) each(f func(s *Session)) int {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	for _, s := range r.sessions {
+		f(s)
+	}
+	return len(r.sessions)
+}
+
+func (r *SessionMgr) add(s *Session) bool {
+	r.l.Lock()
+	defer r.l.Unlock()
+	if r.closed {
+		return false
+	}
+	r.sessions[s.ID] = s
+	sessionsActive.Inc()
+	return true
 }
 
-func (r *SessionMgr) add(s *Session) {
+// remove deletes s, a resumed session shares the ID, token and account with the detached one.
+func (r *SessionMgr) remove(s *Session) {
 	r.l.Lock()
 	defer r.l.Unlock()
-	r.sessions[r.sessionCounter] = s
+	if r.sessions[s.ID] == s {
+		delete(r.sessions, s.ID)
+		sessionsActive.Dec()
+	}
+	if s.token != "" && r.tokens[s.token] == s {
+		delete(r.tokens, s.token)
+	}
+	if s.exec != nil {
+		if r.accounts[s.exec.id] == s {
+			delete(r.accounts, s.exec.id)
+		}
+		r.releaseExec(s.exec)
+		s.exec = nil
+	}
+}
+
+// replace moves the resumed session s from the accept id to the detached session id,
+// the account is moved too unless another login took it.
+func (r *SessionMgr) replace(acceptID SessionID, s *Session) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	// the detached session entry is taken over
+	delete(r.sessions, acceptID)
+	sessionsActive.Dec()
+	r.sessions[s.ID] = s
+	r.tokens[s.token] = s
+	var id = s.Account.ID()
+	if a := r.accounts[id]; a == nil || a.ID == s.ID {
+		r.accounts[id] = s
+	}
+}
+
+func (r *SessionMgr) addToken(s *Session) {
+	r.l.Lock()
+	defer r.l.Unlock()
+	r.tokens[s.token] = s
+}
+
+func (r *SessionMgr) getToken(token string) *Session {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	return r.tokens[token]
+}
+
+// expireDetached drops sessions waiting for resume, called when all session goroutines finished.
+func (r *SessionMgr) expireDetached() {
+	r.l.RLock()
+	var sessions = make([]*Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		sessions = append(sessions, s)
+	}
+	r.l.RUnlock()
+	for _, s := range sessions {
+		s.expire()
+	}
+}
+
+// SessionInfo is a session snapshot for admin.
+type SessionInfo struct {
+	ID       SessionID          `json:"id"`
+	Account  string             `json:"account"`
+	Remote   string             `json:"remote"`
+	Codec    msg.SerializerType `json:"codec"`
+	Detached bool               `json:"detached"` // waiting for resume
+}
+
+// Sessions returns snapshots of all sessions ordered by id.
+func (r *SessionMgr) Sessions() []SessionInfo {
+	// read id and account from the maps, they are changed by login and resume under l
+	r.l.RLock()
+	var accounts = make(map[*Session]string, len(r.accounts))
+	for id, s := range r.accounts {
+		accounts[s] = id
+	}
+	var infos = make([]SessionInfo, 0, len(r.sessions))
+	var sessions = make([]*Session, 0, len(r.sessions))
+	for id, s := range r.sessions {
+		infos = append(infos, SessionInfo{ID: id, Account: accounts[s]})
+		sessions = append(sessions, s)
+	}
+	r.l.RUnlock()
+
+	for i, s := range sessions {
+		s.info(&infos[i])
+	}
+	sort.Slice(infos, func(i, j int) bool {
+		return infos[i].ID < infos[j].ID
+	})
+	return infos
+}
+
+func (r *SessionMgr) Get(id SessionID) *Session {
+	r.l.RLock()
+	defer r.l.RUnlock()
+	return r.sessions[id]
+}
+
+// Push ----------------------------------------------------------------------------------------------------
+
+// Push sends a push message to one session.
+func (r *SessionMgr) Push(id SessionID, mode uint32, v interface{}) error {
+	var s = r.Get(id)
+	if s == nil {
+		return fmt.Errorf("push mode %d session %d not find", mode, id)
+	}
+	return s.Push(mode, v)
+}
+
+// PushSessions sends a push message to a set of sessions, the message is marshaled once.
+func (r *SessionMgr) PushSessions(ids []SessionID, mode uint32, v interface{}) error {
+	var sessions = make([]*Session, 0, len(ids))
+	r.l.RLock()
+	for _, id := range ids {
+		if s := r.sessions[id]; s != nil {
+			sessions = append(sessions, s)
+		}
+	}
+	r.l.RUnlock()
+	return r.push(sessions, mode, v)
+}
+
+// Broadcast sends a push message to all sessions.
+func (r *SessionMgr) Broadcast(mode uint32, v interface{}) error {
+	r.l.RLock()
+	var sessions = make([]*Session, 0, len(r.sessions))
+	for _, s := range r.sessions {
+		sessions = append(sessions, s)
+	}
+	r.l.RUnlock()
+	return r.push(sessions, mode, v)
+}
+
+func (r *SessionMgr) push(sessions []*Session, mode uint32, v interface{}) error {
+	// marshal once for each codec
+	var encoded = make(map[msg.SerializerType][]byte, 1)
+	var fail int
+	for _, s := range sessions {
+		var codec = s.Codec()
+		var data, ok = encoded[codec]
+		if !ok {
+			var err error
+			data, err = msg.MarshalWith(codec, v)
+			if err != nil {
+				return fmt.Errorf("push mode %d marshal err %v", mode, err)
+			}
+			encoded[codec] = data
+		}
+		if err := s.push(mode, codec, data); err != nil {
+			log.Error("push mode %d session %d err %v", mode, s.ID, err)
+			fail++
+		}
+	}
+	if fail > 0 {
+		return fmt.Errorf("push mode %d fail %d/%d sessions", mode, fail, len(sessions))
+	}
+	return nil
 }
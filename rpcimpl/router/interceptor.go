@@ -0,0 +1,187 @@
+package router
+
+import (
+	"runtime"
+	"sync"
+	"time"
+
+	"tiny_rpc/codes"
+	"tiny_rpc/log"
+	"tiny_rpc/msg"
+)
+
+// HandleFunc Interceptor ----------------------------------------------------------------------------------------------------
+type HandleFunc func(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg)
+
+func (f HandleFunc) Serve(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg) {
+	f(ctx, req, rsp)
+}
+
+// Interceptor wrap the handle serve, call next to continue the chain or fill rsp to break it.
+type Interceptor func(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg, next HandleFunc)
+
+type chain struct {
+	global []Interceptor
+	modes  map[uint32][]Interceptor
+}
+
+var interceptors = &chain{
+	modes: make(map[uint32][]Interceptor),
+}
+
+// Use registers global interceptors, run before mode interceptors in order.
+func Use(in ...Interceptor) {
+	interceptors.global = append(interceptors.global, in...)
+}
+
+// UseMode registers interceptors for mode only.
+func UseMode(mode uint32, in ...Interceptor) {
+	interceptors.modes[mode] = append(interceptors.modes[mode], in...)
+}
+
+// ResetInterceptors removes all registered interceptors.
+func ResetInterceptors() {
+	interceptors.global = nil
+	interceptors.modes = make(map[uint32][]Interceptor)
+}
+
+func (c *chain) serve(h HandleInterface, ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg) {
+	var global, mode = c.global, c.modes[req.GetMode()]
+	if len(global) == 0 && len(mode) == 0 {
+		h.Serve(ctx, req, rsp)
+		return
+	}
+
+	var i int
+	var next HandleFunc
+	next = func(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg) {
+		switch {
+		case i < len(global):
+			i++
+			global[i-1](ctx, req, rsp, next)
+		case i < len(global)+len(mode):
+			i++
+			mode[i-1-len(global)](ctx, req, rsp, next)
+		default:
+			h.Serve(ctx, req, rsp)
+		}
+	}
+	next(ctx, req, rsp)
+}
+
+func accountID(ctx ContextInterface) string {
+	if a := AccountOf(ctx); a != nil {
+		return a.ID()
+	}
+	return ""
+}
+
+// LogInterceptor ----------------------------------------------------------------------------------------------------
+func LogInterceptor() Interceptor {
+	return func(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg, next HandleFunc) {
+		var start = time.Now()
+		next(ctx, req, rsp)
+		log.Debug("account %s mode %d request len %d response code %d len %d cost %v",
+			accountID(ctx), req.GetMode(), len(req.GetData()), rsp.GetCode(), len(rsp.GetData()), time.Since(start))
+	}
+}
+
+// RecoverInterceptor ----------------------------------------------------------------------------------------------------
+func RecoverInterceptor() Interceptor {
+	return func(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg, next HandleFunc) {
+		defer func() {
+			if err := recover(); err != nil {
+				buf := make([]byte, 4096)
+				n := runtime.Stack(buf, false)
+				buf = buf[:n]
+
+				log.Error("[handle panic]: %v, account: %s, mode: %d, stack: %s", err, accountID(ctx), req.GetMode(), buf)
+				rsp.FillIn(codes.Panic, nil)
+			}
+		}()
+		next(ctx, req, rsp)
+	}
+}
+
+// AuthInterceptor rejects request with codes.Unauth when check fails,
+// a nil check requires ctx to be an account with non-empty id.
+func AuthInterceptor(check func(ctx ContextInterface) bool) Interceptor {
+	if check == nil {
+		check = func(ctx ContextInterface) bool {
+			return accountID(ctx) != ""
+		}
+	}
+	return func(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg, next HandleFunc) {
+		if !check(ctx) {
+			log.Warn("account %s mode %d unauthenticated", accountID(ctx), req.GetMode())
+			rsp.FillIn(codes.Unauth, nil)
+			return
+		}
+		next(ctx, req, rsp)
+	}
+}
+
+// RateLimitInterceptor ----------------------------------------------------------------------------------------------------
+
+// RateLimitInterceptor limits each account to rate requests per second with burst,
+// exceeded requests are rejected with codes.RateLimit.
+func RateLimitInterceptor(rate float64, burst int) Interceptor {
+	var limiter = &rateLimiter{
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+	return func(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg, next HandleFunc) {
+		if !limiter.allow(accountID(ctx), time.Now()) {
+			log.Warn("account %s mode %d rate limit", accountID(ctx), req.GetMode())
+			rsp.FillIn(codes.RateLimit, nil)
+			return
+		}
+		next(ctx, req, rsp)
+	}
+}
+
+const bucketIdle = time.Minute
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	l       sync.Mutex
+	rate    float64
+	burst   float64
+	buckets map[string]*bucket
+	sweep   time.Time
+}
+
+func (r *rateLimiter) allow(key string, now time.Time) bool {
+	r.l.Lock()
+	defer r.l.Unlock()
+
+	if now.Sub(r.sweep) > bucketIdle {
+		r.sweep = now
+		for k, b := range r.buckets {
+			if now.Sub(b.last) > bucketIdle {
+				delete(r.buckets, k)
+			}
+		}
+	}
+
+	var b = r.buckets[key]
+	if b == nil {
+		b = &bucket{tokens: r.burst, last: now}
+		r.buckets[key] = b
+	}
+	b.tokens += now.Sub(b.last).Seconds() * r.rate
+	if b.tokens > r.burst {
+		b.tokens = r.burst
+	}
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
@@ -1,6 +1,13 @@
 package router
 
 import (
+	"context"
+	"runtime/debug"
+	"time"
+
+	"tiny_rpc/codes"
+	"tiny_rpc/log"
+	"tiny_rpc/model"
 	"tiny_rpc/msg"
 )
 
@@ -16,6 +23,28 @@ const (
 type ContextInterface interface {
 }
 
+// Context is the ContextInterface passed by sessions, it carries the account and the request trace.
+// Pass it to module.SyncWorkCtx and friends so module works join the request trace.
+type Context struct {
+	context.Context
+	Account model.AccountI
+}
+
+// AccountOf returns the account of ctx, ctx is a *Context or the account itself.
+func AccountOf(ctx ContextInterface) model.AccountI {
+	switch c := ctx.(type) {
+	case *Context:
+		if c == nil {
+			return nil
+		}
+		return c.Account
+	case model.AccountI:
+		return c
+	}
+	return nil
+}
+
+// HandleInterface req data is pooled by the session, it is only valid during Serve.
 type HandleInterface interface {
 	Serve(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg)
 }
@@ -41,6 +70,16 @@ func RegHandle(mode uint32, handleInterface HandleInterface) {
 	Instance.RegHandle(mode, handleInterface)
 }
 
-func HandleServe(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg) error {
+// HandleServe serves req by the router instance and records request metrics.
+// A failed request always has a code in rsp, a panic not recovered by interceptors fills codes.Panic.
+func HandleServe(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg) (err error) {
+	var start = time.Now()
+	defer func() {
+		if p := recover(); p != nil {
+			log.Error("[handle panic]: %v, account: %s, mode: %d, stack: %s", p, accountID(ctx), req.GetMode(), debug.Stack())
+			rsp.FillIn(codes.Panic, nil)
+		}
+		observe(req.GetMode(), rsp.GetCode(), err, time.Since(start))
+	}()
 	return Instance.HandleServe(ctx, req, rsp)
 }
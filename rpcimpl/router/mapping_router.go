@@ -3,6 +3,8 @@ package router
 import (
 	"fmt"
 
+	"tiny_rpc/codes"
+	"tiny_rpc/log"
 	"tiny_rpc/msg"
 )
 
@@ -10,6 +12,10 @@ import (
 type MappingRouter map[uint32]HandleInterface
 
 func (r *MappingRouter) RegHandle(mode uint32, handleInterface HandleInterface) {
+	if handleInterface == nil {
+		log.Error("reg handle mode %d nil, ignored", mode)
+		return
+	}
 	(*r)[mode] = handleInterface
 }
 
@@ -17,8 +23,9 @@ func (r *MappingRouter) HandleServe(ctx ContextInterface, req msg.ModeMsg, rsp m
 	var mode = req.GetMode()
 	var f = (*r)[mode]
 	if f == nil {
-		return fmt.Errorf("mode %d not find", req.GetMode())
+		rsp.FillIn(codes.UnknownMode, nil)
+		return fmt.Errorf("mode %d %w", mode, codes.ErrUnknownMode)
 	}
-	f.Serve(ctx, req, rsp)
+	interceptors.serve(f, ctx, req, rsp)
 	return nil
 }
@@ -0,0 +1,109 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tiny_rpc/codes"
+	"tiny_rpc/metrics"
+)
+
+var (
+	requestsVec = metrics.NewCounterVec("tiny_rpc_requests_total", "Requests served by mode.", "mode")
+	errorsVec   = metrics.NewCounterVec("tiny_rpc_request_errors_total", "Requests failed by mode and code, code err means the router failed without a code.", "mode", "code")
+	durationVec = metrics.NewHistogramVec("tiny_rpc_request_duration_seconds", "Request serve latency by mode.", metrics.LatencyBuckets, "mode")
+)
+
+func init() {
+	metrics.Register(requestsVec, durationVec, errorsVec)
+}
+
+type modeMetric struct {
+	errs     uint64 // requests counted by errorsVec under any code, first for 64-bit atomic alignment
+	max      int64  // nanoseconds
+	mode     string
+	requests *metrics.Counter
+	duration *metrics.Histogram
+}
+
+var modeMetrics sync.Map // uint32: *modeMetric
+
+// unknownMetric records requests of modes without a handle under one label,
+// so clients can not create a series per mode.
+var unknownMetric = newModeMetric("unknown")
+
+func newModeMetric(label string) *modeMetric {
+	return &modeMetric{
+		mode:     label,
+		requests: requestsVec.With(label),
+		duration: durationVec.With(label),
+	}
+}
+
+func observe(mode, code uint32, err error, cost time.Duration) {
+	var m = unknownMetric
+	if !errors.Is(err, codes.ErrUnknownMode) {
+		var v, ok = modeMetrics.Load(mode)
+		if !ok {
+			v, _ = modeMetrics.LoadOrStore(mode, newModeMetric(strconv.FormatUint(uint64(mode), 10)))
+		}
+		m = v.(*modeMetric)
+	}
+	m.requests.Inc()
+	m.duration.ObserveDuration(cost)
+	for {
+		var old = atomic.LoadInt64(&m.max)
+		if int64(cost) <= old || atomic.CompareAndSwapInt64(&m.max, old, int64(cost)) {
+			break
+		}
+	}
+	switch {
+	case code != 0:
+		errorsVec.With(m.mode, strconv.FormatUint(uint64(code), 10)).Inc()
+		atomic.AddUint64(&m.errs, 1)
+	case err != nil:
+		errorsVec.With(m.mode, "err").Inc()
+		atomic.AddUint64(&m.errs, 1)
+	}
+}
+
+// ModeStat ----------------------------------------------------------------------------------------------------
+
+// ModeStat is the summary of a mode read from the request metrics, errors count a code or a router err.
+type ModeStat struct {
+	Count    uint64
+	ErrCount uint64
+	Total    time.Duration
+	Max      time.Duration
+}
+
+func (s ModeStat) Avg() time.Duration {
+	if s.Count == 0 {
+		return 0
+	}
+	return s.Total / time.Duration(s.Count)
+}
+
+func (s ModeStat) String() string {
+	return fmt.Sprintf("count %d err %d avg %v max %v", s.Count, s.ErrCount, s.Avg(), s.Max)
+}
+
+// Stats returns the stats of modes served by HandleServe, unknown modes are not included.
+func Stats() map[uint32]ModeStat {
+	var ret = make(map[uint32]ModeStat)
+	modeMetrics.Range(func(k, v interface{}) bool {
+		var m = v.(*modeMetric)
+		ret[k.(uint32)] = ModeStat{
+			Count:    m.requests.Value(),
+			ErrCount: atomic.LoadUint64(&m.errs),
+			Total:    time.Duration(m.duration.Sum() * float64(time.Second)),
+			Max:      time.Duration(atomic.LoadInt64(&m.max)),
+		}
+		return true
+	})
+	return ret
+}
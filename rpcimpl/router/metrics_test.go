@@ -0,0 +1,46 @@
+package router
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+	"time"
+
+	"tiny_rpc/codes"
+)
+
+func TestObserveUnknownMode(t *testing.T) {
+	const mode = 987654
+	observe(mode, codes.UnknownMode, fmt.Errorf("mode %d %w", mode, codes.ErrUnknownMode), time.Millisecond)
+	if _, ok := modeMetrics.Load(uint32(mode)); ok {
+		t.Fatalf("unknown mode %d has its own metric", mode)
+	}
+
+	observe(mode+1, 0, nil, time.Millisecond)
+	if _, ok := modeMetrics.Load(uint32(mode + 1)); !ok {
+		t.Fatalf("mode %d has no metric", mode+1)
+	}
+}
+
+func TestStats(t *testing.T) {
+	const mode = 987656
+	observe(mode, 0, nil, time.Millisecond)
+	observe(mode, codes.Unauth, nil, 3*time.Millisecond)
+	observe(mode, 0, fmt.Errorf("mode %d decode fail", mode), 2*time.Millisecond)
+
+	var s = Stats()[mode]
+	if s.Count != 3 || s.ErrCount != 2 || s.Max != 3*time.Millisecond || s.Avg() != 2*time.Millisecond {
+		t.Fatalf("stats %v", s)
+	}
+	// the stats are read from the request metrics, they can not disagree
+	var label = "987656"
+	if n := requestsVec.With(label).Value(); n != s.Count {
+		t.Fatalf("requests %d stats count %d", n, s.Count)
+	}
+	if n := errorsVec.With(label, strconv.Itoa(int(codes.Unauth))).Value() + errorsVec.With(label, "err").Value(); n != s.ErrCount {
+		t.Fatalf("errors %d stats err count %d", n, s.ErrCount)
+	}
+	if h := durationVec.With(label); h.Count() != s.Count || time.Duration(h.Sum()*float64(time.Second)) != s.Total {
+		t.Fatalf("duration count %d sum %v stats %v", h.Count(), h.Sum(), s)
+	}
+}
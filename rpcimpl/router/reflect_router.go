@@ -3,49 +3,57 @@ package router
 import (
 	"fmt"
 	"reflect"
-	"runtime"
-	"strings"
 	"sync"
 
+	"tiny_rpc/codes"
 	"tiny_rpc/log"
-	"tiny_rpc/model"
 	"tiny_rpc/msg"
 )
 
 // funcHandle ----------------------------------------------------------------------------------------------------
+// funcHandle calls func(ctx, arg, reply) (code uint32), ctx is the *Context or the account of it.
 type funcHandle struct {
 	funcV     reflect.Value
+	CtxType   reflect.Type
 	ArgType   reflect.Type
 	ReplyType reflect.Type
 }
 
-func NewFuncHandle(fn interface{}) *funcHandle {
+// NewFuncHandle returns a handle calling fn by reflect, fn is func(ctx, arg, reply) uint32.
+// A nil handle is returned for a bad fn, and RegHandle ignores it.
+//
+// Deprecated: use Register or NewTypedHandle, they check fn at compile time.
+func NewFuncHandle(fn interface{}) HandleInterface {
 	f, ok := fn.(reflect.Value)
 	if !ok {
 		f = reflect.ValueOf(fn)
 	}
-	if f.Kind() != reflect.Func {
-		log.Error("function must be func or bound method")
+	if !f.IsValid() || f.Kind() != reflect.Func || f.IsNil() {
+		log.Error("registerFunction: %T must be func or bound method", fn)
 		return nil
 	}
 
 	t := f.Type()
 	if t.NumIn() != 3 {
-		log.Error("registerFunction: has wrong number of ins: %r", f.Type().String())
+		log.Error("registerFunction: %s has wrong number of ins: %d", t, t.NumIn())
 		return nil
 	}
-	if t.NumOut() != 1 {
-		log.Error("registerFunction: has wrong number of outs: %r", f.Type().String())
+	if t.NumOut() != 1 || t.Out(0).Kind() != reflect.Uint32 {
+		log.Error("registerFunction: %s must return one uint32 code", t)
 		return nil
 	}
 
 	argType := t.In(1)
 	replyType := t.In(2)
+	if argType.Kind() != reflect.Ptr || replyType.Kind() != reflect.Ptr {
+		log.Error("registerFunction: %s arg and reply must be ptr", t)
+		return nil
+	}
 
 	reflectTypePools.Init(argType)
 	reflectTypePools.Init(replyType)
 
-	return &funcHandle{funcV: f, ArgType: argType, ReplyType: replyType}
+	return &funcHandle{funcV: f, CtxType: t.In(0), ArgType: argType, ReplyType: replyType}
 }
 
 func (r *funcHandle) Serve(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg) {
@@ -55,54 +63,38 @@ func (r *funcHandle) Serve(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMs
 	defer reflectTypePools.Put(r.ReplyType, replyi)
 
 	// req unmarshal
-	if err := msg.Unmarshal(req.GetData(), argi); err != nil {
-		log.Error("funcHandle Serve Unmarshal err %v", err)
+	if err := msg.UnmarshalWith(req.GetCodec(), req.GetData(), argi); err != nil {
+		log.Error("funcHandle Serve mode %d Unmarshal err %v", req.GetMode(), err)
+		rsp.FillIn(codes.DecodeFail, nil)
 		return
 	}
 
-	var builder strings.Builder
-	argv := reflect.ValueOf(argi)
-	replyv := reflect.ValueOf(replyi)
-	var a, ok = ctx.(model.AccountI)
-	if ok && r.ArgType.Kind() == reflect.Ptr {
-		builder.WriteString(fmt.Sprintf("account %s mode %d request ", a.ID(), req.GetMode()))
-		builder.WriteString(fmt.Sprintf("%+v", argv.Interface()))
-	}
-	var code = r.call(ctx, argv, replyv)
-	if ok && r.ReplyType.Kind() == reflect.Ptr {
-		builder.WriteString(" response ")
-		builder.WriteString(fmt.Sprintf("%+v code %d", replyv.Interface(), code))
-		log.Debug(builder.String())
-	}
+	var code = r.call(ctx, reflect.ValueOf(argi), reflect.ValueOf(replyi))
 
 	// rsp marshal
-	var data, err = msg.Marshal(replyi)
+	var data, err = msg.MarshalWith(rsp.GetCodec(), replyi)
 	if err != nil {
-		log.Error("funcHandle Serve Marshal err %v", err)
+		log.Error("funcHandle Serve mode %d Marshal err %v", req.GetMode(), err)
+		rsp.FillIn(codes.Internal, nil)
 		return
 	}
 	rsp.FillIn(code, data)
 }
 
 func (r *funcHandle) call(ctx ContextInterface, argv, replyv reflect.Value) uint32 {
-	defer func() {
-		if err := recover(); err != nil {
-			buf := make([]byte, 4096)
-			n := runtime.Stack(buf, false)
-			buf = buf[:n]
-
-			err := fmt.Errorf("[callForFunction error]: %v, function: %v, argv: %+v, stack: %v",
-				err, runtime.FuncForPC(r.funcV.Pointer()), argv.Interface(), buf)
-			log.Error("callForFunction %v", err)
-		}
-	}()
+	returnValues := r.funcV.Call([]reflect.Value{r.ctxValue(ctx), argv, replyv})
+	return uint32(returnValues[0].Uint())
+}
 
-	returnValues := r.funcV.Call([]reflect.Value{reflect.ValueOf(ctx), argv, replyv})
-	code := returnValues[0].Interface()
-	if code != nil {
-		return code.(uint32)
+// ctxValue passes ctx as is when the func takes it, otherwise the account of ctx.
+func (r *funcHandle) ctxValue(ctx ContextInterface) reflect.Value {
+	if v := reflect.ValueOf(ctx); v.IsValid() && v.Type().AssignableTo(r.CtxType) {
+		return v
+	}
+	if v := reflect.ValueOf(AccountOf(ctx)); v.IsValid() && v.Type().AssignableTo(r.CtxType) {
+		return v
 	}
-	return 0
+	return reflect.Zero(r.CtxType)
 }
 
 // ReflectRouter ----------------------------------------------------------------------------------------------------
@@ -117,15 +109,20 @@ func NewReflectRouter() *ReflectRouter {
 }
 
 func (r *ReflectRouter) RegHandle(mode uint32, handleInterface HandleInterface) {
+	if handleInterface == nil {
+		log.Error("reg handle mode %d nil, ignored", mode)
+		return
+	}
 	r.function[mode] = handleInterface
 }
 
 func (r *ReflectRouter) HandleServe(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg) error {
 	f := r.function[req.GetMode()]
 	if f == nil {
-		return fmt.Errorf("mode %d not find", req.GetMode())
+		rsp.FillIn(codes.UnknownMode, nil)
+		return fmt.Errorf("mode %d %w", req.GetMode(), codes.ErrUnknownMode)
 	}
-	f.Serve(ctx, req, rsp)
+	interceptors.serve(f, ctx, req, rsp)
 	return nil
 }
 
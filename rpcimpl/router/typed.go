@@ -0,0 +1,94 @@
+package router
+
+import (
+	"context"
+	"sync"
+
+	"tiny_rpc/codes"
+	"tiny_rpc/log"
+	"tiny_rpc/msg"
+)
+
+// typedHandle ----------------------------------------------------------------------------------------------------
+
+// typedHandle calls fn without reflect, req and rsp values are pooled.
+type typedHandle[Req, Rsp any] struct {
+	fn   func(ctx *Context, req *Req, rsp *Rsp) uint32
+	reqs Pool[Req]
+	rsps Pool[Rsp]
+}
+
+// Register registers fn for mode to the router instance, signatures are checked at compile time.
+// fn fills rsp from req, the returned code is sent with rsp.
+func Register[Req, Rsp any](mode uint32, fn func(ctx *Context, req *Req, rsp *Rsp) uint32) {
+	RegHandle(mode, NewTypedHandle(fn))
+}
+
+// NewTypedHandle returns a handle calling fn, such as for registering to a router other than the instance.
+func NewTypedHandle[Req, Rsp any](fn func(ctx *Context, req *Req, rsp *Rsp) uint32) HandleInterface {
+	if fn == nil {
+		return nil
+	}
+	return &typedHandle[Req, Rsp]{fn: fn}
+}
+
+func (r *typedHandle[Req, Rsp]) Serve(ctx ContextInterface, req msg.ModeMsg, rsp msg.CodeMsg) {
+	var in = r.reqs.Get()
+	defer r.reqs.Put(in)
+	var out = r.rsps.Get()
+	defer r.rsps.Put(out)
+
+	// req unmarshal
+	if err := msg.UnmarshalWith(req.GetCodec(), req.GetData(), in); err != nil {
+		log.Error("typedHandle Serve mode %d Unmarshal err %v", req.GetMode(), err)
+		rsp.FillIn(codes.DecodeFail, nil)
+		return
+	}
+
+	var code = r.fn(contextOf(ctx), in, out)
+
+	// rsp marshal
+	var data, err = msg.MarshalWith(rsp.GetCodec(), out)
+	if err != nil {
+		log.Error("typedHandle Serve mode %d Marshal err %v", req.GetMode(), err)
+		rsp.FillIn(codes.Internal, nil)
+		return
+	}
+	rsp.FillIn(code, data)
+}
+
+// contextOf returns ctx as *Context, an account passed directly is wrapped without trace.
+func contextOf(ctx ContextInterface) *Context {
+	if c, ok := ctx.(*Context); ok && c != nil {
+		return c
+	}
+	return &Context{Context: context.Background(), Account: AccountOf(ctx)}
+}
+
+// Pool ----------------------------------------------------------------------------------------------------
+
+// Pool is a typed sync.Pool of *T, values are reset when put back.
+type Pool[T any] struct {
+	p sync.Pool
+}
+
+func (p *Pool[T]) Get() *T {
+	if v := p.p.Get(); v != nil {
+		return v.(*T)
+	}
+	return new(T)
+}
+
+// Put resets x by its Reset method, or to the zero value, and gives it back to the pool.
+func (p *Pool[T]) Put(x *T) {
+	if x == nil {
+		return
+	}
+	if o, ok := any(x).(Reset); ok {
+		o.Reset()
+	} else {
+		var zero T
+		*x = zero
+	}
+	p.p.Put(x)
+}
@@ -0,0 +1,84 @@
+package router
+
+import (
+	"encoding/json"
+	"testing"
+
+	"tiny_rpc/model"
+	"tiny_rpc/msg"
+)
+
+type echoReq struct {
+	Msg  string
+	Seen bool
+}
+
+type echoRsp struct {
+	Msg     string
+	Account string
+}
+
+func serve(t *testing.T, h HandleInterface, ctx ContextInterface, v interface{}) (uint32, echoRsp) {
+	t.Helper()
+	var data, _ = json.Marshal(v)
+	var req = new(msg.RequestBase)
+	req.FillIn(1, data)
+	req.SetCodec(msg.SerializerJson)
+	var rsp = new(msg.ResponseBase)
+	rsp.SetCodec(msg.SerializerJson)
+	h.Serve(ctx, req, rsp)
+	var out echoRsp
+	if err := json.Unmarshal(rsp.GetData(), &out); err != nil {
+		t.Fatalf("rsp %q err %v", rsp.GetData(), err)
+	}
+	return rsp.GetCode(), out
+}
+
+func TestTypedHandle(t *testing.T) {
+	var h = NewTypedHandle(func(ctx *Context, req *echoReq, rsp *echoRsp) uint32 {
+		if req.Seen {
+			t.Error("pooled req not reset")
+		}
+		req.Seen = true
+		rsp.Msg = req.Msg
+		rsp.Account = ctx.Account.ID()
+		return 7
+	})
+	var a = &model.PlayerAccount{AccountId: "typed"}
+	for _, ctx := range []ContextInterface{a, &Context{Account: a}} {
+		var code, rsp = serve(t, h, ctx, echoReq{Msg: "hi"})
+		if code != 7 || rsp.Msg != "hi" || rsp.Account != "typed" {
+			t.Fatalf("code %d rsp %+v", code, rsp)
+		}
+	}
+}
+
+func TestFuncHandle(t *testing.T) {
+	for _, fn := range []interface{}{
+		nil,
+		"not func",
+		func(a model.AccountI, req *echoReq) uint32 { return 0 },
+		func(a model.AccountI, req *echoReq, rsp *echoRsp) int { return 0 },
+		func(a model.AccountI, req echoReq, rsp *echoRsp) uint32 { return 0 },
+	} {
+		if h := NewFuncHandle(fn); h != nil {
+			t.Fatalf("bad func %T handle not nil", fn)
+		}
+	}
+
+	type code uint32
+	var h = NewFuncHandle(func(a *model.PlayerAccount, req *echoReq, rsp *echoRsp) code {
+		rsp.Account = a.AccountId
+		return 3
+	})
+	var c, rsp = serve(t, h, &Context{Account: &model.PlayerAccount{AccountId: "func"}}, echoReq{})
+	if c != 3 || rsp.Account != "func" {
+		t.Fatalf("code %d rsp %+v", c, rsp)
+	}
+
+	var r = NewReflectRouter()
+	r.RegHandle(1, NewFuncHandle(nil))
+	if _, ok := r.function[1]; ok {
+		t.Fatal("nil handle registered")
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/pprof"
+	"strings"
+
+	"tiny_rpc/log"
+	"tiny_rpc/metrics"
+	"tiny_rpc/transport"
+)
+
+// Admin ----------------------------------------------------------------------------------------------------
+
+// AdminHandler serves
+//
+//	/metrics       metrics in Prometheus text format
+//	/sessions      sessions as JSON
+//	/log/level     GET returns the log level spec, POST sets it from the spec form value or body
+//	/debug/pprof/  pprof profiles
+func (s *Server) AdminHandler() http.Handler {
+	var mux = http.NewServeMux()
+	mux.Handle("/metrics", metrics.Default)
+	mux.HandleFunc("/sessions", s.serveSessions)
+	mux.HandleFunc("/log/level", serveLogLevel)
+	mux.HandleFunc("/debug/pprof/", pprof.Index)
+	mux.HandleFunc("/debug/pprof/cmdline", pprof.Cmdline)
+	mux.HandleFunc("/debug/pprof/profile", pprof.Profile)
+	mux.HandleFunc("/debug/pprof/symbol", pprof.Symbol)
+	mux.HandleFunc("/debug/pprof/trace", pprof.Trace)
+	return mux
+}
+
+// ListenAdmin serves AdminHandler over http on a tcp address, it is closed with the server.
+// Call it before Serve, the admin listener is optional.
+func (s *Server) ListenAdmin(address string) error {
+	var ln, err = transport.Listen(transport.TCP, address)
+	if err != nil {
+		return fmt.Errorf("admin listen %s err %v", address, err)
+	}
+	s.admin = &http.Server{Handler: s.AdminHandler()}
+	s.adminAddr = ln.Addr().String()
+	go func() {
+		if err := s.admin.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Error("admin serve err %v", err)
+		}
+	}()
+	log.Info("admin listen %s", s.adminAddr)
+	return nil
+}
+
+// AdminAddr returns the admin listener address, empty when not listening.
+func (s *Server) AdminAddr() string {
+	return s.adminAddr
+}
+
+func (s *Server) closeAdmin(ctx context.Context) {
+	if s.admin == nil {
+		return
+	}
+	if err := s.admin.Shutdown(ctx); err != nil {
+		log.Error("admin shutdown err %v", err)
+	}
+}
+
+func (s *Server) serveSessions(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(s.sm.Sessions())
+}
+
+func serveLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost, http.MethodPut:
+		var spec = r.FormValue("spec")
+		if spec == "" {
+			var body, _ = io.ReadAll(io.LimitReader(r.Body, 4096))
+			spec = strings.TrimSpace(string(body))
+		}
+		if err := log.SetLevelSpec(spec); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		log.Info("admin set log level %s", spec)
+	default:
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	_, _ = io.WriteString(w, log.LevelSpec()+"\n")
+}
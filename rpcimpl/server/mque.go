@@ -8,5 +8,5 @@ import (
 
 var q = module.Que{
 	{M: &a.MA{}, Size: module.ChanSizeDef, MName: module.MA},
-	{M: &b.MB{}, Size: module.ChanSizeDef, MName: module.MB},
+	{M: &b.MB{}, Size: module.ChanSizeDef, MName: module.MB, Deps: []string{module.MA}},
 }
@@ -1,6 +1,11 @@
 package server
 
 import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+
 	"tiny_rpc/handler"
 	"tiny_rpc/log"
 	"tiny_rpc/module"
@@ -10,31 +15,69 @@ import (
 )
 
 type Server struct {
-	sm *net.SessionMgr
+	sm        *net.SessionMgr
+	unreg     func()
+	admin     *http.Server
+	adminAddr string
 }
 
+// NewServer registers the sessions for module.PushAccount and module.ExecAccount.
 func NewServer(network, address string) *Server {
-	return &Server{
-		sm: net.NewSessionMgr(network, address),
+	var s = &Server{
+		sm:    net.NewSessionMgr(network, address),
+		unreg: func() {},
+	}
+	if s.sm != nil {
+		s.unreg = module.RegSender(s.sm)
 	}
+	return s
 }
 
-func (s *Server) Serve() {
-	msg.SetSerializer(msg.SerializerPB)
-	handler.Init(router.ReflectRouterType)
+var (
+	initOnce sync.Once
+	initErr  error
+)
 
-	if err := module.MgrIns().Reg(q); err != nil {
-		log.Error("reg module %v", err)
-		return
-	}
-	if err := module.MgrIns().Start(); err != nil {
-		log.Error("module mgr start %v", err)
+// Init sets the serializer, handlers and modules once, servers in the process share them.
+func Init() error {
+	initOnce.Do(func() {
+		msg.SetSerializer(msg.SerializerPB)
+		handler.Init(router.ReflectRouterType)
+
+		if err := module.MgrIns().Reg(q); err != nil {
+			initErr = fmt.Errorf("reg module %v", err)
+			return
+		}
+		if err := module.MgrIns().Start(); err != nil {
+			initErr = fmt.Errorf("module mgr start %v", err)
+			return
+		}
+	})
+	return initErr
+}
+
+func (s *Server) Serve() {
+	if err := Init(); err != nil {
+		log.Error("server init err %v", err)
 		return
 	}
 	s.sm.Start()
 }
 
+// Listen adds another transport listener, such as ws or kcp.
+func (s *Server) Listen(network, address string) error {
+	return s.sm.Listen(network, address)
+}
+
+func (s *Server) SessionMgr() *net.SessionMgr {
+	return s.sm
+}
+
 func (s *Server) Close() {
+	s.unreg()
+	if s.admin != nil {
+		_ = s.admin.Close()
+	}
 	s.sm.Stop()
 
 	if err := module.MgrIns().Stop(); err != nil {
@@ -42,3 +85,19 @@ func (s *Server) Close() {
 		return
 	}
 }
+
+// Shutdown stops accepting sessions, finishes in-flight requests, then drains and saves modules.
+// Module works left after ctx done fail with module.ErrShutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	if err := s.ShutdownSessions(ctx); err != nil {
+		log.Error("server session mgr shutdown err %v", err)
+	}
+	s.closeAdmin(ctx)
+	return module.MgrIns().Shutdown(ctx)
+}
+
+// ShutdownSessions shuts down sessions only, modules shared by servers in the process keep running.
+func (s *Server) ShutdownSessions(ctx context.Context) error {
+	s.unreg()
+	return s.sm.Shutdown(ctx)
+}
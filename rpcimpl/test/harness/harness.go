@@ -0,0 +1,340 @@
+// Package harness boots server.Server on an in-process memconn listener and returns connected clients,
+// so handler tests run hermetically and in parallel without ports.
+// Harnesses of a process share handlers and modules set by server.Init, each has its own sessions.
+package harness
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	pb "github.com/golang/protobuf/proto"
+
+	"tiny_rpc/client"
+	"tiny_rpc/codes"
+	"tiny_rpc/log"
+	"tiny_rpc/module"
+	"tiny_rpc/msg"
+	"tiny_rpc/net"
+	"tiny_rpc/server"
+	"tiny_rpc/transport"
+)
+
+const (
+	CallTimeoutDef = 3 * time.Second
+	WaitTimeoutDef = time.Second
+
+	shutdownTimeout = 5 * time.Second
+)
+
+var (
+	logOnce sync.Once
+	counter uint32
+)
+
+// TokenAuth is the default authenticator, token is the account id.
+var TokenAuth = net.AuthFunc(func(data []byte) (string, error) {
+	if len(data) == 0 {
+		return "", errors.New("empty token")
+	}
+	return string(data), nil
+})
+
+// Harness ---------------------------------------------------------------------------------------------------
+
+type Harness struct {
+	t       testing.TB
+	ser     *server.Server
+	network string
+	address string
+	auth    net.Authenticator
+	codec   msg.SerializerType
+	setup   []func(sm *net.SessionMgr) error
+
+	l       sync.Mutex
+	records []module.Record
+	signal  chan struct{}
+	cancel  func()
+}
+
+type Option func(h *Harness)
+
+// WithNetwork sets the memconn network, transport.MemU (default) or transport.MemB.
+func WithNetwork(network string) Option {
+	return func(h *Harness) {
+		h.network = network
+	}
+}
+
+// WithAuth replaces TokenAuth, nil auth makes sessions guests without login.
+func WithAuth(auth net.Authenticator) Option {
+	return func(h *Harness) {
+		h.auth = auth
+	}
+}
+
+// WithCodec sets the serializer of clients, default is msg.SerializerPB.
+func WithCodec(codec msg.SerializerType) Option {
+	return func(h *Harness) {
+		h.codec = codec
+	}
+}
+
+// WithSessionMgr configures the session mgr before serving, such as transform and timeouts.
+func WithSessionMgr(f func(sm *net.SessionMgr) error) Option {
+	return func(h *Harness) {
+		h.setup = append(h.setup, f)
+	}
+}
+
+// New starts a server on a unique memconn address, it is shut down by t cleanup.
+func New(t testing.TB, opts ...Option) *Harness {
+	t.Helper()
+	logOnce.Do(func() {
+		log.Init(log.Logrus)
+	})
+	if err := server.Init(); err != nil {
+		t.Fatalf("harness server init err %v", err)
+	}
+
+	var h = &Harness{
+		t:       t,
+		network: transport.MemU,
+		auth:    TokenAuth,
+		codec:   msg.SerializerPB,
+		signal:  make(chan struct{}, 1),
+	}
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.address = fmt.Sprintf("harness-%d-%d", os.Getpid(), atomic.AddUint32(&counter, 1))
+	h.ser = server.NewServer(h.network, h.address)
+	var sm = h.ser.SessionMgr()
+	if sm == nil {
+		t.Fatalf("harness listen %s %s failed", h.network, h.address)
+	}
+	if h.auth != nil {
+		sm.SetAuthenticator(h.auth, 0)
+	}
+	for _, f := range h.setup {
+		if err := f(sm); err != nil {
+			t.Fatalf("harness setup err %v", err)
+		}
+	}
+
+	h.cancel = module.Observe(h.record)
+	go h.ser.Serve()
+	t.Cleanup(h.close)
+	return h
+}
+
+// close shuts down sessions only, modules are shared by harnesses of the process.
+func (h *Harness) close() {
+	h.cancel()
+	var ctx, cancel = context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := h.ser.ShutdownSessions(ctx); err != nil {
+		h.t.Errorf("harness shutdown err %v", err)
+	}
+}
+
+func (h *Harness) Server() *server.Server {
+	return h.ser
+}
+
+func (h *Harness) SessionMgr() *net.SessionMgr {
+	return h.ser.SessionMgr()
+}
+
+func (h *Harness) Network() string {
+	return h.network
+}
+
+func (h *Harness) Address() string {
+	return h.address
+}
+
+// Client ----------------------------------------------------------------------------------------------------
+
+// Client is a connected client with assertions, failures are reported to t.
+type Client struct {
+	*client.Client
+	t       testing.TB
+	Account string
+
+	l      sync.Mutex
+	pushes []push
+	signal chan struct{}
+}
+
+type push struct {
+	mode uint32
+	data []byte
+}
+
+// Client dials the harness and logs in with account as token when the harness has an authenticator,
+// it is closed by t cleanup.
+func (h *Harness) Client(account string) *Client {
+	h.t.Helper()
+	var c = &Client{
+		Client:  client.NewClient(h.network, h.address),
+		t:       h.t,
+		Account: account,
+		signal:  make(chan struct{}, 1),
+	}
+	h.t.Cleanup(c.Close)
+	c.SetCodec(h.codec)
+	c.RegPushDefault(c.receive)
+
+	if h.auth != nil {
+		var ctx, cancel = context.WithTimeout(context.Background(), CallTimeoutDef)
+		defer cancel()
+		var code, err = c.Login(ctx, []byte(account))
+		if err != nil || code != codes.OK {
+			h.t.Fatalf("harness client %s login code %d err %v", account, code, err)
+		}
+	}
+	return c
+}
+
+func (c *Client) receive(mode uint32, data []byte) {
+	c.l.Lock()
+	c.pushes = append(c.pushes, push{mode: mode, data: data})
+	c.l.Unlock()
+	notify(c.signal)
+}
+
+// MustCall calls mode and fails the test on transport error, returns the response code.
+// The error of a non-zero code is not a transport error.
+func (c *Client) MustCall(mode uint32, req, rsp interface{}) uint32 {
+	c.t.Helper()
+	var code, err = c.CallTimeout(CallTimeoutDef, mode, req, rsp)
+	var ce *codes.Error
+	if err != nil && !errors.As(err, &ce) {
+		c.t.Fatalf("client %s call mode %d err %v", c.Account, mode, err)
+	}
+	return code
+}
+
+// ExpectCode calls mode and fails the test unless the response code is want.
+func (c *Client) ExpectCode(mode uint32, req, rsp interface{}, want uint32) {
+	c.t.Helper()
+	if code := c.MustCall(mode, req, rsp); code != want {
+		c.t.Fatalf("client %s call mode %d code %d want %d", c.Account, mode, code, want)
+	}
+}
+
+// ExpectPush waits for the earliest unconsumed push of mode and unmarshals it into v,
+// pushes of other modes are kept for later expectations.
+func (c *Client) ExpectPush(mode uint32, v interface{}) {
+	c.t.Helper()
+	var data, ok = c.waitPush(mode, WaitTimeoutDef)
+	if !ok {
+		c.t.Fatalf("client %s push mode %d not received in %v", c.Account, mode, WaitTimeoutDef)
+	}
+	if err := msg.UnmarshalWith(c.Codec(), data, v); err != nil {
+		c.t.Fatalf("client %s push mode %d unmarshal err %v", c.Account, mode, err)
+	}
+}
+
+// ExpectNoPush fails the test when a push of mode received in wait.
+func (c *Client) ExpectNoPush(mode uint32, wait time.Duration) {
+	c.t.Helper()
+	if _, ok := c.waitPush(mode, wait); ok {
+		c.t.Fatalf("client %s push mode %d unexpected", c.Account, mode)
+	}
+}
+
+func (c *Client) waitPush(mode uint32, wait time.Duration) ([]byte, bool) {
+	var timer = time.NewTimer(wait)
+	defer timer.Stop()
+	for {
+		c.l.Lock()
+		for i, p := range c.pushes {
+			if p.mode == mode {
+				c.pushes = append(c.pushes[:i], c.pushes[i+1:]...)
+				c.l.Unlock()
+				return p.data, true
+			}
+		}
+		c.l.Unlock()
+
+		select {
+		case <-c.signal:
+		case <-timer.C:
+			return nil, false
+		}
+	}
+}
+
+// Module ----------------------------------------------------------------------------------------------------
+
+func (h *Harness) record(rec module.Record) {
+	h.l.Lock()
+	h.records = append(h.records, rec)
+	h.l.Unlock()
+	notify(h.signal)
+}
+
+// CallModule calls a module method directly, bypassing sessions.
+func (h *Harness) CallModule(mo, me string, arg, reply interface{}) error {
+	return module.SyncWork(mo, me, arg, reply)
+}
+
+// ModuleCalls returns works of module method dealt since the harness started, empty method matches all.
+// Modules are shared, works of parallel harnesses are recorded as well.
+func (h *Harness) ModuleCalls(mo, me string) []module.Record {
+	h.l.Lock()
+	defer h.l.Unlock()
+	var recs []module.Record
+	for _, rec := range h.records {
+		if rec.Module == mo && (me == "" || rec.Method == me) {
+			recs = append(recs, rec)
+		}
+	}
+	return recs
+}
+
+// ExpectModuleCall waits for a work of module method with arg equal to arg, nil arg matches any.
+// Proto messages are compared by proto.Equal, others by reflect.DeepEqual.
+func (h *Harness) ExpectModuleCall(mo, me string, arg interface{}) module.Record {
+	h.t.Helper()
+	var timer = time.NewTimer(WaitTimeoutDef)
+	defer timer.Stop()
+	for {
+		for _, rec := range h.ModuleCalls(mo, me) {
+			if arg == nil || equal(rec.Arg, arg) {
+				return rec
+			}
+		}
+
+		select {
+		case <-h.signal:
+		case <-timer.C:
+			h.t.Fatalf("module %s method %s arg %+v not called in %v", mo, me, arg, WaitTimeoutDef)
+			return module.Record{}
+		}
+	}
+}
+
+func equal(a, b interface{}) bool {
+	var ma, ok1 = a.(pb.Message)
+	var mb, ok2 = b.(pb.Message)
+	if ok1 && ok2 {
+		return pb.Equal(ma, mb)
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func notify(signal chan struct{}) {
+	select {
+	case signal <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,442 @@
+package harness
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	stdnet "net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"tiny_rpc/client"
+	"tiny_rpc/codes"
+	"tiny_rpc/log"
+	"tiny_rpc/model"
+	"tiny_rpc/module"
+	"tiny_rpc/msg"
+	"tiny_rpc/net"
+	"tiny_rpc/proto"
+	"tiny_rpc/trace"
+	"tiny_rpc/transport"
+)
+
+const pushMode uint32 = 1001
+
+var networks = []string{transport.MemU, transport.MemB}
+
+func TestHello(t *testing.T) {
+	for _, network := range networks {
+		network := network
+		t.Run(network, func(t *testing.T) {
+			t.Parallel()
+			var h = New(t, WithNetwork(network))
+			var c = h.Client("zhang")
+
+			var rsp = new(proto.HelloRsp)
+			c.ExpectCode(proto.Hello, &proto.HelloReq{HelloMsg: "hello"}, rsp, 0)
+			if rsp.ReplyMsg != "hello~" {
+				t.Fatalf("hello reply %q", rsp.ReplyMsg)
+			}
+			h.ExpectModuleCall(module.MA, module.MA_Hello, &proto.HelloArg{Msg: "ma"})
+			h.ExpectModuleCall(module.MB, module.MB_Hello, nil)
+		})
+	}
+}
+
+func TestPush(t *testing.T) {
+	for _, network := range networks {
+		network := network
+		t.Run(network, func(t *testing.T) {
+			t.Parallel()
+			var h = New(t, WithNetwork(network))
+			var a, b = h.Client("a"), h.Client("b")
+
+			if err := h.SessionMgr().Broadcast(pushMode, &proto.HelloRsp{ReplyMsg: "all"}); err != nil {
+				t.Fatalf("broadcast err %v", err)
+			}
+			for _, c := range []*Client{a, b} {
+				var rsp = new(proto.HelloRsp)
+				c.ExpectPush(pushMode, rsp)
+				if rsp.ReplyMsg != "all" {
+					t.Fatalf("client %s push %q", c.Account, rsp.ReplyMsg)
+				}
+				c.ExpectNoPush(pushMode, 50*time.Millisecond)
+			}
+		})
+	}
+}
+
+func TestCallModule(t *testing.T) {
+	t.Parallel()
+	var h = New(t)
+	var reply = new(proto.HelloReplay)
+	if err := h.CallModule(module.MA, module.MA_Func1, &proto.HelloArg{Msg: "direct"}, reply); err != nil {
+		t.Fatalf("call module err %v", err)
+	}
+	var rec = h.ExpectModuleCall(module.MA, module.MA_Func1, &proto.HelloArg{Msg: "direct"})
+	if rec.Err != nil {
+		t.Fatalf("module record err %v", rec.Err)
+	}
+}
+
+func TestEqual(t *testing.T) {
+	var a = &proto.HelloReq{HelloMsg: "hi"}
+	// marshal fills the size cache, a is proto equal but not deep equal to a new message
+	if _, err := msg.MarshalWith(msg.SerializerPB, a); err != nil {
+		t.Fatalf("marshal err %v", err)
+	}
+	if !equal(a, &proto.HelloReq{HelloMsg: "hi"}) {
+		t.Fatal("marshaled message not equal")
+	}
+	if equal(a, &proto.HelloReq{HelloMsg: "bye"}) {
+		t.Fatal("different messages equal")
+	}
+	if !equal(&proto.HelloArg{Msg: "hi"}, &proto.HelloArg{Msg: "hi"}) {
+		t.Fatal("module args not equal")
+	}
+}
+
+func TestGuest(t *testing.T) {
+	t.Parallel()
+	var h = New(t, WithAuth(nil))
+	var c = h.Client("")
+	c.ExpectCode(proto.Hello, &proto.HelloReq{HelloMsg: "guest"}, new(proto.HelloRsp), 0)
+}
+
+func TestKick(t *testing.T) {
+	t.Parallel()
+	var h = New(t)
+	var old = h.Client("dup")
+	var c = h.Client("dup")
+
+	var deadline = time.Now().Add(WaitTimeoutDef)
+	for {
+		var _, err = old.CallTimeout(CallTimeoutDef, proto.Hello, &proto.HelloReq{}, new(proto.HelloRsp))
+		if errors.Is(err, client.ErrKicked) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("old client not kicked, err %v", err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.ExpectCode(proto.Hello, &proto.HelloReq{HelloMsg: "again"}, new(proto.HelloRsp), 0)
+
+	if err := module.PushAccount("dup", pushMode, &proto.HelloRsp{ReplyMsg: "dup"}); err != nil {
+		t.Fatalf("push account err %v", err)
+	}
+	var rsp = new(proto.HelloRsp)
+	c.ExpectPush(pushMode, rsp)
+	if rsp.ReplyMsg != "dup" {
+		t.Fatalf("push account %q", rsp.ReplyMsg)
+	}
+}
+
+func TestExecAccount(t *testing.T) {
+	t.Parallel()
+	var h = New(t)
+	h.Client("exec")
+
+	if err := module.ExecAccount("offline", func(a model.AccountI) {}); !errors.Is(err, model.ErrAccountOffline) {
+		t.Fatalf("exec offline account err %v", err)
+	}
+
+	const n = 100
+	var seq = make(chan int, n)
+	for i := 0; i < n; i++ {
+		i := i
+		if err := module.ExecAccount("exec", func(a model.AccountI) {
+			if a.ID() != "exec" {
+				t.Errorf("exec account %s", a.ID())
+			}
+			seq <- i
+		}); err != nil {
+			t.Fatalf("exec account err %v", err)
+		}
+	}
+	for i := 0; i < n; i++ {
+		if got := <-seq; got != i {
+			t.Fatalf("exec order %d want %d", got, i)
+		}
+	}
+}
+
+func TestCodes(t *testing.T) {
+	t.Parallel()
+	var h = New(t, WithCodec(msg.SerializerJson))
+	var c = h.Client("codes")
+
+	var code, err = c.CallTimeout(CallTimeoutDef, 0xFFFF, &proto.HelloReq{}, new(proto.HelloRsp))
+	if code != codes.UnknownMode || !errors.Is(err, codes.ErrUnknownMode) {
+		t.Fatalf("unknown mode code %x err %v", code, err)
+	}
+	c.ExpectCode(proto.Hello, "not a hello req", new(proto.HelloRsp), codes.DecodeFail)
+	c.ExpectCode(proto.Hello, &proto.HelloReq{HelloMsg: "after"}, new(proto.HelloRsp), codes.OK)
+}
+
+// TestTrace is not parallel, the exporter is global.
+func TestTrace(t *testing.T) {
+	var spans = trace.NewMemExporter()
+	trace.SetExporter(spans)
+	defer trace.SetExporter(nil)
+
+	var h = New(t)
+	var c = h.Client("trace")
+	var ctx, root = trace.Start(context.Background(), "test")
+	var code, err = c.CallContext(ctx, proto.Hello, &proto.HelloReq{HelloMsg: "trace"}, new(proto.HelloRsp))
+	root.End(nil)
+	if err != nil || code != 0 {
+		t.Fatalf("call code %d err %v", code, err)
+	}
+	var rec = h.ExpectModuleCall(module.MA, module.MA_Hello, nil)
+	if rec.Trace.TraceID != root.TraceID {
+		t.Fatalf("module work trace %v want %v", rec.Trace, root.SpanContext)
+	}
+
+	// the module span ends after the reply is sent
+	var byName map[string]trace.Span
+	for deadline := time.Now().Add(WaitTimeoutDef); ; time.Sleep(10 * time.Millisecond) {
+		byName = make(map[string]trace.Span)
+		for _, s := range spans.Trace(root.TraceID) {
+			byName[s.Name] = s
+		}
+		if len(byName) == 4 || time.Now().After(deadline) {
+			break
+		}
+	}
+	var parent = root.SpanID
+	for _, name := range []string{"call", "rpc", "module"} {
+		var s, ok = byName[name]
+		if !ok || s.Parent != parent {
+			t.Fatalf("span %s %+v parent want %x, spans %+v", name, s, parent, byName)
+		}
+		parent = s.SpanID
+	}
+}
+
+func TestAdmin(t *testing.T) {
+	t.Parallel()
+	var h = New(t)
+	var c = h.Client("admin")
+	c.ExpectCode(proto.Hello, &proto.HelloReq{HelloMsg: "admin"}, new(proto.HelloRsp), 0)
+
+	var admin = httptest.NewServer(h.Server().AdminHandler())
+	defer admin.Close()
+	var get = func(path string) string {
+		var rsp, err = http.Get(admin.URL + path)
+		if err != nil {
+			t.Fatalf("get %s err %v", path, err)
+		}
+		defer rsp.Body.Close()
+		var body, _ = io.ReadAll(rsp.Body)
+		if rsp.StatusCode != http.StatusOK {
+			t.Fatalf("get %s status %d %s", path, rsp.StatusCode, body)
+		}
+		return string(body)
+	}
+
+	var text = get("/metrics")
+	for _, want := range []string{
+		"tiny_rpc_sessions_active ",
+		`tiny_rpc_requests_total{mode="1"} `,
+		`tiny_rpc_request_duration_seconds_bucket{mode="1",le="+Inf"} `,
+		`tiny_rpc_module_queue_length{module="MA"} `,
+		`tiny_rpc_module_work_duration_seconds_count{module="MA"} `,
+		"tiny_rpc_frames_in_total ",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("metrics miss %q", want)
+		}
+	}
+
+	var sessions []net.SessionInfo
+	if err := json.Unmarshal([]byte(get("/sessions")), &sessions); err != nil {
+		t.Fatalf("sessions err %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].Account != "admin" || sessions[0].Detached {
+		t.Fatalf("sessions %+v", sessions)
+	}
+
+	if !strings.HasPrefix(get("/debug/pprof/"), "<html>") {
+		t.Fatal("pprof index")
+	}
+
+	const pkg = "tiny_rpc/test/harness/none"
+	defer log.ResetPkgLevel(pkg)
+	var rsp, err = http.PostForm(admin.URL+"/log/level", url.Values{"spec": {pkg + "=warn"}})
+	if err != nil {
+		t.Fatalf("set log level err %v", err)
+	}
+	_ = rsp.Body.Close()
+	if lvl := log.GetLevel(pkg); lvl != log.WarnLevel || !strings.Contains(get("/log/level"), pkg+"=warn") {
+		t.Fatalf("log level %v", lvl)
+	}
+}
+
+// sessionOf returns the session info of account, ok is false when it has none.
+func sessionOf(h *Harness, account string) (info net.SessionInfo, ok bool) {
+	for _, info := range h.SessionMgr().Sessions() {
+		if info.Account == account {
+			return info, true
+		}
+	}
+	return info, false
+}
+
+// waitSession waits until cond holds for the session info of account.
+func waitSession(t *testing.T, h *Harness, account string, cond func(info net.SessionInfo, ok bool) bool) {
+	t.Helper()
+	var deadline = time.Now().Add(WaitTimeoutDef)
+	for !cond(sessionOf(h, account)) {
+		if time.Now().After(deadline) {
+			var info, ok = sessionOf(h, account)
+			t.Fatalf("session of %s %+v %v", account, info, ok)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestResume(t *testing.T) {
+	t.Parallel()
+	var h = New(t, WithSessionMgr(func(sm *net.SessionMgr) error {
+		sm.SetResumeWindow(time.Second)
+		return sm.SetTransform(msg.FlagSnappy|msg.FlagCRC, nil)
+	}))
+	var c = h.Client("resume")
+	c.SetResume(time.Second)
+	var before, _ = sessionOf(h, "resume")
+
+	// drop the connection server side, the client reconnects and resumes the session
+	if err := h.SessionMgr().Get(before.ID).Conn.Close(); err != nil {
+		t.Fatalf("close conn err %v", err)
+	}
+	// calls written before the client notices the lost connection fail
+	var rsp = new(proto.HelloRsp)
+	var deadline = time.Now().Add(WaitTimeoutDef)
+	for {
+		var code, err = c.CallTimeout(CallTimeoutDef, proto.Hello, &proto.HelloReq{HelloMsg: "back"}, rsp)
+		if err == nil && code == codes.OK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("call after resume code %d err %v", code, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rsp.ReplyMsg != "hello~" {
+		t.Fatalf("hello reply %q", rsp.ReplyMsg)
+	}
+	if after, ok := sessionOf(h, "resume"); !ok || after.ID != before.ID || after.Detached {
+		t.Fatalf("resumed session %+v before %+v", after, before)
+	}
+}
+
+// stallTransport is a memu transport whose dials fail while stalled, the client keeps reconnecting.
+type stallTransport struct {
+	transport.MemTransport
+	stalled int32
+	dials   int32
+}
+
+func (t *stallTransport) Dial(address string, timeout time.Duration) (stdnet.Conn, error) {
+	atomic.AddInt32(&t.dials, 1)
+	if atomic.LoadInt32(&t.stalled) == 1 {
+		return nil, errors.New("stalled")
+	}
+	return t.MemTransport.Dial(address, timeout)
+}
+
+func TestCallDuringResume(t *testing.T) {
+	var tr = &stallTransport{MemTransport: transport.MemTransport{Network: transport.MemU}}
+	transport.Reg("harness-stall", tr)
+	var h = New(t, WithNetwork("harness-stall"), WithSessionMgr(func(sm *net.SessionMgr) error {
+		sm.SetResumeWindow(5 * time.Second)
+		return nil
+	}))
+	var c = h.Client("stall")
+	c.SetResume(5 * time.Second)
+	var info, _ = sessionOf(h, "stall")
+
+	atomic.StoreInt32(&tr.stalled, 1)
+	var dials = atomic.LoadInt32(&tr.dials)
+	_ = h.SessionMgr().Get(info.ID).Conn.Close()
+	var deadline = time.Now().Add(WaitTimeoutDef)
+	for atomic.LoadInt32(&tr.dials) == dials {
+		if time.Now().After(deadline) {
+			t.Fatal("client not reconnecting")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	// the call gives up at its deadline instead of waiting for the resume window
+	var start = time.Now()
+	var _, err = c.CallTimeout(100*time.Millisecond, proto.Hello, &proto.HelloReq{HelloMsg: "stall"}, new(proto.HelloRsp))
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("call during resume err %v want %v", err, context.DeadlineExceeded)
+	}
+	if d := time.Since(start); d > time.Second {
+		t.Fatalf("call during resume returned after %v", d)
+	}
+
+	atomic.StoreInt32(&tr.stalled, 0)
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		var code, err = c.CallTimeout(CallTimeoutDef, proto.Hello, &proto.HelloReq{HelloMsg: "back"}, new(proto.HelloRsp))
+		if err == nil && code == codes.OK {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("call after resume code %d err %v", code, err)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestResumeExpire(t *testing.T) {
+	t.Parallel()
+	const window = 100 * time.Millisecond
+	var h = New(t, WithSessionMgr(func(sm *net.SessionMgr) error {
+		sm.SetResumeWindow(window)
+		return nil
+	}))
+	h.Client("expire") // without client resume, the session is left detached
+	var info, _ = sessionOf(h, "expire")
+	var start = time.Now()
+	_ = h.SessionMgr().Get(info.ID).Conn.Close()
+
+	waitSession(t, h, "expire", func(info net.SessionInfo, ok bool) bool { return ok && info.Detached })
+	waitSession(t, h, "expire", func(info net.SessionInfo, ok bool) bool { return !ok })
+	if d := time.Since(start); d < window {
+		t.Fatalf("session expired after %v window %v", d, window)
+	}
+}
+
+func TestIdleTimeout(t *testing.T) {
+	t.Parallel()
+	const idle = 100 * time.Millisecond
+	var h = New(t, WithSessionMgr(func(sm *net.SessionMgr) error {
+		sm.SetIdleTimeout(idle, 0)
+		sm.SetResumeWindow(0)
+		return nil
+	}))
+
+	// pings keep the session alive past the idle timeout
+	var alive = h.Client("alive")
+	alive.SetHeartbeat(idle/4, 0)
+	var silent = h.Client("silent")
+	silent.SetHeartbeat(0, 0)
+
+	time.Sleep(3 * idle)
+	alive.ExpectCode(proto.Hello, &proto.HelloReq{HelloMsg: "alive"}, new(proto.HelloRsp), codes.OK)
+	waitSession(t, h, "silent", func(info net.SessionInfo, ok bool) bool { return !ok })
+	var _, err = silent.CallTimeout(CallTimeoutDef, proto.Hello, &proto.HelloReq{}, new(proto.HelloRsp))
+	if err == nil {
+		t.Fatal("silent client call after idle timeout")
+	}
+}
@@ -0,0 +1,209 @@
+// protogen reads PROTO_NUM/RPC_NAME/REQ_NAME/RSP_NAME comments of proto files and generates
+// mode constants, typed client methods, router registration tables and missing handle skeletons.
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"go/format"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	protoNum = "PROTO_NUM:"
+	rpcName  = "RPC_NAME:"
+	reqName  = "REQ_NAME:"
+	rspName  = "RSP_NAME:"
+)
+
+var (
+	protoDir = flag.String("proto", ".", "dir of proto files")
+	root     = flag.String("root", "../..", "tiny_rpc module root")
+	module   = flag.String("module", "tiny_rpc", "go module path")
+)
+
+var (
+	rexBlock = regexp.MustCompile(`/\*[\w\W]*?\*/`)
+	rexField = regexp.MustCompile(`(PROTO_NUM|RPC_NAME|REQ_NAME|RSP_NAME):\s*(\S+)`)
+	rexIdent = regexp.MustCompile(`^[A-Z][A-Za-z0-9_]*$`)
+)
+
+// client methods can not be used as rpc name
+var reserved = map[string]bool{
+	"Go": true, "Call": true, "CallTimeout": true, "CallContext": true, "Notify": true,
+	"Login": true, "RegPush": true, "SetCodec": true, "Codec": true, "Close": true,
+	"SetHeartbeat": true, "SetResume": true, "SetTransform": true, "RegPushDefault": true,
+}
+
+// RPC ----------------------------------------------------------------------------------------------------
+type RPC struct {
+	Num  uint32
+	Name string
+	Req  string
+	Rsp  string
+	File string
+}
+
+func (r RPC) Pkg() string {
+	return strings.ToLower(r.Name)
+}
+
+func main() {
+	flag.Parse()
+
+	rpcs, err := parse(*protoDir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "protogen:", err)
+		os.Exit(1)
+	}
+	if err := check(rpcs); err != nil {
+		fmt.Fprintln(os.Stderr, "protogen:", err)
+		os.Exit(1)
+	}
+	if err := gen(rpcs); err != nil {
+		fmt.Fprintln(os.Stderr, "protogen:", err)
+		os.Exit(1)
+	}
+}
+
+func parse(dir string) ([]RPC, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.proto"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+
+	var rpcs []RPC
+	for _, f := range files {
+		content, err := os.ReadFile(f)
+		if err != nil {
+			return nil, err
+		}
+		for _, block := range rexBlock.FindAllString(string(content), -1) {
+			var fields = make(map[string]string, 4)
+			for _, m := range rexField.FindAllStringSubmatch(block, -1) {
+				fields[m[1]+":"] = m[2]
+			}
+			if len(fields) == 0 {
+				continue
+			}
+			if len(fields) != 4 {
+				return nil, fmt.Errorf("%s comment need %s %s %s %s\n%s", f, protoNum, rpcName, reqName, rspName, block)
+			}
+			num, err := strconv.ParseUint(fields[protoNum], 10, 32)
+			if err != nil {
+				return nil, fmt.Errorf("%s %s %v", f, protoNum, err)
+			}
+			rpcs = append(rpcs, RPC{
+				Num:  uint32(num),
+				Name: fields[rpcName],
+				Req:  fields[reqName],
+				Rsp:  fields[rspName],
+				File: filepath.Base(f),
+			})
+		}
+	}
+	sort.SliceStable(rpcs, func(i, j int) bool { return rpcs[i].Num < rpcs[j].Num })
+	return rpcs, nil
+}
+
+// check duplicate mode numbers and names
+func check(rpcs []RPC) error {
+	var nums = make(map[uint32]RPC, len(rpcs))
+	var names = make(map[string]RPC, len(rpcs))
+	var errs []string
+	for _, r := range rpcs {
+		if r.Num == 0 || r.Num >= math.MaxUint32-1 {
+			errs = append(errs, fmt.Sprintf("%s %s mode %d is reserved for login, resume and kick", r.File, r.Name, r.Num))
+		}
+		if o, ok := nums[r.Num]; ok {
+			errs = append(errs, fmt.Sprintf("mode %d duplicate: %s(%s) %s(%s)", r.Num, o.Name, o.File, r.Name, r.File))
+		}
+		if o, ok := names[r.Name]; ok {
+			errs = append(errs, fmt.Sprintf("rpc %s duplicate: %s %s", r.Name, o.File, r.File))
+		}
+		if !rexIdent.MatchString(r.Name) || reserved[r.Name] {
+			errs = append(errs, fmt.Sprintf("%s rpc name %s illegal", r.File, r.Name))
+		}
+		nums[r.Num] = r
+		names[r.Name] = r
+	}
+	if len(errs) > 0 {
+		return fmt.Errorf("check fail\n%s", strings.Join(errs, "\n"))
+	}
+	return nil
+}
+
+func gen(rpcs []RPC) error {
+	var data = struct {
+		Module string
+		RPCs   []RPC
+	}{*module, rpcs}
+
+	var files = []struct {
+		path  string
+		tmpl  *template.Template
+		force bool
+	}{
+		{"proto/proto.go", modeTmpl, true},
+		{"client/stub.go", clientTmpl, true},
+		{"handler/reflect_handles/handles.go", reflectRegTmpl, true},
+		{"handler/mapping_handles/handles.go", mappingRegTmpl, true},
+	}
+	for _, f := range files {
+		if err := write(filepath.Join(*root, f.path), f.tmpl, data, f.force); err != nil {
+			return err
+		}
+	}
+
+	// handle skeletons, never overwrite
+	for _, r := range rpcs {
+		var d = struct {
+			Module string
+			RPC
+		}{*module, r}
+		var p = filepath.Join(*root, "handler/reflect_handles", r.Pkg(), r.Pkg()+"_handle.go")
+		if err := write(p, reflectHandleTmpl, d, false); err != nil {
+			return err
+		}
+		p = filepath.Join(*root, "handler/mapping_handles", r.Pkg(), r.Pkg()+".go")
+		if err := write(p, mappingHandleTmpl, d, false); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func write(path string, tmpl *template.Template, data interface{}, force bool) error {
+	if !force {
+		if _, err := os.Stat(path); err == nil {
+			fmt.Println("protogen skip", path)
+			return nil
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, data); err != nil {
+		return fmt.Errorf("%s template %v", path, err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("%s format %v\n%s", path, err, buf.String())
+	}
+	if err := os.MkdirAll(filepath.Dir(path), os.ModePerm); err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, src, 0644); err != nil {
+		return err
+	}
+	fmt.Println("protogen gen", path)
+	return nil
+}
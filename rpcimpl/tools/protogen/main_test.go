@@ -0,0 +1,61 @@
+package main
+
+import (
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheck(t *testing.T) {
+	var cases = []struct {
+		name string
+		rpcs []RPC
+		want string
+	}{
+		{"duplicate mode", []RPC{{Num: 1, Name: "Hello", File: "a.proto"}, {Num: 1, Name: "Bye", File: "b.proto"}}, "mode 1 duplicate: Hello(a.proto) Bye(b.proto)"},
+		{"duplicate name", []RPC{{Num: 1, Name: "Hello", File: "a.proto"}, {Num: 2, Name: "Hello", File: "b.proto"}}, "rpc Hello duplicate: a.proto b.proto"},
+		{"login mode", []RPC{{Num: 0, Name: "Hello", File: "a.proto"}}, "a.proto Hello mode 0 is reserved"},
+		{"resume mode", []RPC{{Num: math.MaxUint32 - 1, Name: "Hello", File: "a.proto"}}, "mode 4294967294 is reserved"},
+		{"kick mode", []RPC{{Num: math.MaxUint32, Name: "Hello", File: "a.proto"}}, "mode 4294967295 is reserved"},
+		{"client method", []RPC{{Num: 1, Name: "Call", File: "a.proto"}}, "a.proto rpc name Call illegal"},
+	}
+	for _, c := range cases {
+		if err := check(c.rpcs); err == nil || !strings.Contains(err.Error(), c.want) {
+			t.Fatalf("%s check err %v want %q", c.name, err, c.want)
+		}
+	}
+	if err := check([]RPC{{Num: 1, Name: "Hello"}, {Num: 2, Name: "Bye"}}); err != nil {
+		t.Fatalf("check err %v", err)
+	}
+}
+
+func TestGenSkipHandle(t *testing.T) {
+	var old = *root
+	*root = t.TempDir()
+	defer func() { *root = old }()
+
+	var handle = filepath.Join(*root, "handler/reflect_handles/hello/hello_handle.go")
+	if err := os.MkdirAll(filepath.Dir(handle), os.ModePerm); err != nil {
+		t.Fatalf("mkdir err %v", err)
+	}
+	var written = "package hello\n\n// written by hand\n"
+	if err := os.WriteFile(handle, []byte(written), 0644); err != nil {
+		t.Fatalf("write err %v", err)
+	}
+
+	var rpcs = []RPC{{Num: 1, Name: "Hello", Req: "HelloReq", Rsp: "HelloRsp", File: "msg.proto"}}
+	if err := gen(rpcs); err != nil {
+		t.Fatalf("gen err %v", err)
+	}
+	if b, err := os.ReadFile(handle); err != nil || string(b) != written {
+		t.Fatalf("existing handle overwritten err %v\n%s", err, b)
+	}
+	// the missing skeleton and the tables are still generated
+	for _, p := range []string{"handler/mapping_handles/hello/hello.go", "proto/proto.go", "client/stub.go"} {
+		if _, err := os.Stat(filepath.Join(*root, p)); err != nil {
+			t.Fatalf("%s not generated err %v", p, err)
+		}
+	}
+}
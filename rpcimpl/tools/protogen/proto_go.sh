@@ -3,7 +3,8 @@
 CURR_DIR=$(pwd)
 IN_PATH=$CURR_DIR
 OUT_PATH=$CURR_DIR/gen
-PROTO_PATH=$CURR_DIR/../../proto
+ROOT_PATH=$CURR_DIR/../..
+PROTO_PATH=$ROOT_PATH/proto
 
 gen() {
     if [ -d "$OUT_PATH"  ];then
@@ -11,11 +12,12 @@ gen() {
     fi
     mkdir "$OUT_PATH"
 
-    python3.9 proto_go.py "$IN_PATH" "$OUT_PATH"
     protoc --proto_path="$IN_PATH" --go_out="$OUT_PATH" "$IN_PATH"/*.proto
     for f in $OUT_PATH/*;do
       go fmt "$f"
     done
+    # mode constants, client stubs, router tables and missing handle skeletons
+    go run . -proto "$IN_PATH" -root "$ROOT_PATH"
 }
 
 clean() {
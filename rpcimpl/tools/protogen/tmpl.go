@@ -0,0 +1,123 @@
+package main
+
+import "text/template"
+
+const genHead = `// Code generated by protogen. DO NOT EDIT.
+`
+
+var modeTmpl = template.Must(template.New("mode").Parse(genHead + `
+package proto
+
+const (
+{{- range .RPCs}}
+	{{.Name}} = {{.Num}}
+{{- end}}
+)
+`))
+
+var clientTmpl = template.Must(template.New("client").Parse(genHead + `
+package client
+
+import (
+	"context"
+
+	"{{.Module}}/proto"
+)
+{{range .RPCs}}
+func (c *Client) {{.Name}}(ctx context.Context, req *proto.{{.Req}}) (*proto.{{.Rsp}}, uint32, error) {
+	var rsp = new(proto.{{.Rsp}})
+	code, err := c.CallContext(ctx, proto.{{.Name}}, req, rsp)
+	return rsp, code, err
+}
+{{end}}`))
+
+var reflectRegTmpl = template.Must(template.New("reflectReg").Parse(genHead + `
+package reflect_handles
+
+import (
+{{- range .RPCs}}
+	"{{$.Module}}/handler/reflect_handles/{{.Pkg}}"
+{{- end}}
+	"{{.Module}}/proto"
+	"{{.Module}}/router"
+)
+
+// RegHandlesFunc ----------------------------------------------------------------------------------------------------
+func RegHandlesFunc() {
+{{- range .RPCs}}
+	router.Register(proto.{{.Name}}, {{.Pkg}}.{{.Name}}Handle)
+{{- end}}
+}
+`))
+
+var mappingRegTmpl = template.Must(template.New("mappingReg").Parse(genHead + `
+package mapping_handles
+
+import (
+{{- range .RPCs}}
+	"{{$.Module}}/handler/mapping_handles/{{.Pkg}}"
+{{- end}}
+	"{{.Module}}/proto"
+	"{{.Module}}/router"
+)
+
+// RegHandles ----------------------------------------------------------------------------------------------------
+func RegHandles() {
+{{- range .RPCs}}
+	router.RegHandle(proto.{{.Name}}, {{.Pkg}}.{{.Name}}Proto{})
+{{- end}}
+}
+`))
+
+var reflectHandleTmpl = template.Must(template.New("reflectHandle").Parse(`package {{.Pkg}}
+
+import (
+	"{{.Module}}/proto"
+	"{{.Module}}/router"
+)
+
+func {{.Name}}Handle(ctx *router.Context, req *proto.{{.Req}}, rsp *proto.{{.Rsp}}) (code uint32) {
+	return
+}
+`))
+
+var mappingHandleTmpl = template.Must(template.New("mappingHandle").Parse(`package {{.Pkg}}
+
+import (
+	"{{.Module}}/codes"
+	"{{.Module}}/model"
+	"{{.Module}}/msg"
+	"{{.Module}}/proto"
+	"{{.Module}}/router"
+)
+
+type {{.Name}}Proto struct {
+	*proto.{{.Req}}
+}
+
+func ({{.Name}}Proto) Serve(ctx router.ContextInterface, baseReq msg.ModeMsg, baseRsp msg.CodeMsg) {
+	var account, ok = router.AccountOf(ctx).(*model.PlayerAccount)
+	if !ok {
+		baseRsp.FillIn(codes.Unauth, nil)
+		return
+	}
+	var req = new(proto.{{.Req}})
+	var rsp = new(proto.{{.Rsp}})
+	if err := msg.UnmarshalWith(baseReq.GetCodec(), baseReq.GetData(), req); err != nil {
+		baseRsp.FillIn(codes.DecodeFail, nil)
+		return
+	}
+	var r = &{{.Name}}Proto{ {{- .Req}}: req}
+	var code = r.{{.Name}}Handle(account, rsp)
+	var data, err = msg.MarshalWith(baseRsp.GetCodec(), rsp)
+	if err != nil {
+		baseRsp.FillIn(codes.Internal, nil)
+		return
+	}
+	baseRsp.FillIn(code, data)
+}
+
+func (r *{{.Name}}Proto) {{.Name}}Handle(a *model.PlayerAccount, rsp *proto.{{.Rsp}}) (code uint32) {
+	return
+}
+`))
@@ -0,0 +1,137 @@
+package trace
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"tiny_rpc/log"
+)
+
+// MemExporter ----------------------------------------------------------------------------------------------------
+
+// MemExporter keeps spans in memory for tests.
+type MemExporter struct {
+	l     sync.Mutex
+	spans []Span
+}
+
+func NewMemExporter() *MemExporter {
+	return new(MemExporter)
+}
+
+func (m *MemExporter) Export(s *Span) {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.spans = append(m.spans, *s)
+}
+
+// Spans returns spans exported in end order.
+func (m *MemExporter) Spans() []Span {
+	m.l.Lock()
+	defer m.l.Unlock()
+	return append([]Span(nil), m.spans...)
+}
+
+// Trace returns spans of traceID in end order.
+func (m *MemExporter) Trace(traceID uint64) []Span {
+	m.l.Lock()
+	defer m.l.Unlock()
+	var ret []Span
+	for _, s := range m.spans {
+		if s.TraceID == traceID {
+			ret = append(ret, s)
+		}
+	}
+	return ret
+}
+
+func (m *MemExporter) Reset() {
+	m.l.Lock()
+	defer m.l.Unlock()
+	m.spans = nil
+}
+
+// JSONExporter ----------------------------------------------------------------------------------------------------
+
+// JSONExporter writes one JSON object per span, such as
+// {"trace":"..","span":"..","parent":"..","name":"rpc","start":"..","duration_us":120,"mode":1}
+// attributes follow the fixed keys, err is added for failed spans.
+type JSONExporter struct {
+	l sync.Mutex
+	w io.Writer
+	c io.Closer
+	b []byte
+}
+
+func NewJSONExporter(w io.Writer) *JSONExporter {
+	return &JSONExporter{w: w}
+}
+
+// OpenJSONFile appends spans to the file at path, it is created if not exists.
+func OpenJSONFile(path string) (*JSONExporter, error) {
+	var f, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("trace open %s err %v", path, err)
+	}
+	return &JSONExporter{w: f, c: f}, nil
+}
+
+func (j *JSONExporter) Export(s *Span) {
+	j.l.Lock()
+	defer j.l.Unlock()
+	j.b = appendJSON(j.b[:0], s)
+	_, _ = j.w.Write(j.b)
+}
+
+// Close closes the file opened by OpenJSONFile.
+func (j *JSONExporter) Close() error {
+	if j.c == nil {
+		return nil
+	}
+	j.l.Lock()
+	defer j.l.Unlock()
+	return j.c.Close()
+}
+
+func appendJSON(b []byte, s *Span) []byte {
+	b = append(b, `{"trace":"`...)
+	b = appendHex(b, s.TraceID)
+	b = append(b, `","span":"`...)
+	b = appendHex(b, s.SpanID)
+	b = append(b, '"')
+	if s.Parent != 0 {
+		b = append(b, `,"parent":"`...)
+		b = appendHex(b, s.Parent)
+		b = append(b, '"')
+	}
+	b = append(b, `,"name":`...)
+	b = log.AppendJSONString(b, s.Name)
+	b = append(b, `,"start":"`...)
+	b = s.Start.AppendFormat(b, time.RFC3339Nano)
+	b = append(b, `","duration_us":`...)
+	b = strconv.AppendInt(b, s.Duration.Microseconds(), 10)
+	for _, f := range s.Attrs {
+		b = append(b, ',')
+		b = log.AppendJSONString(b, f.Key)
+		b = append(b, ':')
+		b = log.AppendJSONValue(b, f.Value)
+	}
+	if s.Err != "" {
+		b = append(b, `,"err":`...)
+		b = log.AppendJSONString(b, s.Err)
+	}
+	return append(b, '}', '\n')
+}
+
+// appendHex appends id as 16 hex digits.
+func appendHex(b []byte, id uint64) []byte {
+	const digits = "0123456789abcdef"
+	for shift := 60; shift >= 0; shift -= 4 {
+		b = append(b, digits[id>>uint(shift)&0xf])
+	}
+	return b
+}
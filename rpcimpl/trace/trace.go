@@ -0,0 +1,160 @@
+// Package trace carries trace and span ids from client calls through sessions, handlers and module works,
+// spans are recorded to a pluggable exporter.
+package trace
+
+import (
+	"context"
+	"math/rand"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"tiny_rpc/log"
+)
+
+// SpanContext ----------------------------------------------------------------------------------------------------
+
+// SpanContext identifies a span, it is carried in frames with msg.FlagTrace.
+type SpanContext struct {
+	TraceID uint64
+	SpanID  uint64
+}
+
+func (c SpanContext) IsValid() bool {
+	return c.TraceID != 0
+}
+
+func (c SpanContext) String() string {
+	return hexID(c.TraceID) + "/" + hexID(c.SpanID)
+}
+
+// Fields returns trace and span log fields, nil when c is not valid.
+func (c SpanContext) Fields() []log.Field {
+	if !c.IsValid() {
+		return nil
+	}
+	return []log.Field{log.F(log.KeyTrace, hexID(c.TraceID)), log.F(log.KeySpan, hexID(c.SpanID))}
+}
+
+type ctxKey struct{}
+
+// NewContext returns ctx carrying c, such as the span of a remote caller.
+func NewContext(ctx context.Context, c SpanContext) context.Context {
+	return context.WithValue(ctx, ctxKey{}, c)
+}
+
+// FromContext returns the span context carried by ctx, a nil ctx carries none.
+func FromContext(ctx context.Context) SpanContext {
+	if ctx == nil {
+		return SpanContext{}
+	}
+	var c, _ = ctx.Value(ctxKey{}).(SpanContext)
+	return c
+}
+
+// Span ----------------------------------------------------------------------------------------------------
+
+type Span struct {
+	SpanContext
+	Parent   uint64 // span id of the parent, 0 for a root span
+	Name     string
+	Start    time.Time
+	Duration time.Duration
+	Attrs    []log.Field
+	Err      string
+}
+
+// Start starts a span named name as a child of the span in ctx, the returned ctx carries the new span.
+// A root span is started only when an exporter is set, otherwise ctx is returned as is with a nil span.
+// Methods of a nil span do nothing.
+func Start(ctx context.Context, name string, attrs ...log.Field) (context.Context, *Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if !Enabled() {
+		return ctx, nil
+	}
+	var parent = FromContext(ctx)
+	var s = &Span{
+		SpanContext: SpanContext{TraceID: parent.TraceID, SpanID: newID()},
+		Parent:      parent.SpanID,
+		Name:        name,
+		Start:       time.Now(),
+		Attrs:       attrs,
+	}
+	if !parent.IsValid() {
+		s.TraceID = newID()
+	}
+	return NewContext(ctx, s.SpanContext), s
+}
+
+// SetAttrs adds attributes to s.
+func (s *Span) SetAttrs(attrs ...log.Field) {
+	if s == nil {
+		return
+	}
+	s.Attrs = append(s.Attrs, attrs...)
+}
+
+// End records the duration and err of s and exports it, s must not be used after.
+func (s *Span) End(err error) {
+	if s == nil {
+		return
+	}
+	s.Duration = time.Since(s.Start)
+	if err != nil {
+		s.Err = err.Error()
+	}
+	if e := exporter.Load().(*holder).Exporter; e != nil {
+		e.Export(s)
+	}
+}
+
+// Exporter ----------------------------------------------------------------------------------------------------
+
+// Exporter records ended spans, it is called by the goroutine ending the span and must not block.
+type Exporter interface {
+	Export(s *Span)
+}
+
+var exporter atomic.Value // *holder
+
+type holder struct {
+	Exporter
+}
+
+func init() {
+	exporter.Store(&holder{})
+}
+
+// SetExporter sets the span exporter, nil stops recording spans. Ids carried by frames are still passed on.
+func SetExporter(e Exporter) {
+	exporter.Store(&holder{e})
+}
+
+// Enabled reports whether spans are recorded.
+func Enabled() bool {
+	return exporter.Load().(*holder).Exporter != nil
+}
+
+// ids ----------------------------------------------------------------------------------------------------
+
+var ids = struct {
+	sync.Mutex
+	r *rand.Rand
+}{r: rand.New(rand.NewSource(time.Now().UnixNano()))}
+
+// newID returns a random non-zero id.
+func newID() uint64 {
+	ids.Lock()
+	defer ids.Unlock()
+	for {
+		if id := ids.r.Uint64(); id != 0 {
+			return id
+		}
+	}
+}
+
+func hexID(id uint64) string {
+	return string(appendHex(nil, id))
+}
@@ -0,0 +1,82 @@
+package trace
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+	"time"
+
+	"tiny_rpc/log"
+)
+
+func TestStart(t *testing.T) {
+	SetExporter(nil)
+	var remote = NewContext(context.Background(), SpanContext{TraceID: 1, SpanID: 2})
+	if ctx, s := Start(remote, "off"); s != nil || FromContext(ctx) != (SpanContext{TraceID: 1, SpanID: 2}) {
+		t.Fatalf("start without exporter span %+v ctx %v", s, FromContext(ctx))
+	}
+
+	var mem = NewMemExporter()
+	SetExporter(mem)
+	defer SetExporter(nil)
+	var ctx, root = Start(nil, "root")
+	var _, child = Start(ctx, "child", log.Mode(1))
+	child.End(errors.New("fail"))
+	root.End(nil)
+	var _, other = Start(remote, "other")
+	other.End(nil)
+
+	var spans = mem.Trace(root.TraceID)
+	if len(spans) != 2 || spans[0].Name != "child" || spans[0].Parent != root.SpanID || spans[0].Err != "fail" {
+		t.Fatalf("spans %+v", spans)
+	}
+	if spans[1].Parent != 0 || spans[1].SpanID != root.SpanID {
+		t.Fatalf("root span %+v", spans[1])
+	}
+	if s := mem.Trace(1); len(s) != 1 || s[0].Parent != 2 {
+		t.Fatalf("remote child %+v", s)
+	}
+}
+
+func TestJSONExporter(t *testing.T) {
+	var buf bytes.Buffer
+	var j = NewJSONExporter(&buf)
+	j.Export(&Span{
+		SpanContext: SpanContext{TraceID: 0xab, SpanID: 0xcd},
+		Parent:      0xef,
+		Name:        "rpc",
+		Start:       time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Duration:    1500 * time.Microsecond,
+		Attrs:       []log.Field{log.Mode(1), log.Account("a")},
+		Err:         "fail",
+	})
+	const want = `{"trace":"00000000000000ab","span":"00000000000000cd","parent":"00000000000000ef","name":"rpc",` +
+		`"start":"2024-01-02T03:04:05Z","duration_us":1500,"mode":1,"account":"a","err":"fail"}` + "\n"
+	if buf.String() != want {
+		t.Fatalf("json\n%s want\n%s", buf.String(), want)
+	}
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("json err %v", err)
+	}
+}
+
+func TestJSONExporterEscape(t *testing.T) {
+	var buf bytes.Buffer
+	var j = NewJSONExporter(&buf)
+	j.Export(&Span{
+		SpanContext: SpanContext{TraceID: 1, SpanID: 2},
+		Name:        "rpc\x1b",
+		Attrs:       []log.Field{log.F("key\a", "v\xff")},
+		Err:         "fail\x00\xfe",
+	})
+	var m map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &m); err != nil {
+		t.Fatalf("json %q err %v", buf.String(), err)
+	}
+	if m["name"] != "rpc\x1b" || m["key\a"] != "v\ufffd" || m["err"] != "fail\x00\ufffd" {
+		t.Fatalf("span %v", m)
+	}
+}
@@ -0,0 +1,128 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/xtaci/kcp-go/v5"
+)
+
+// KcpTransport ----------------------------------------------------------------------------------------------------
+
+// KcpTransport reliable udp for realtime traffic, sessions run in stream mode with nodelay.
+type KcpTransport struct {
+	DataShards   int
+	ParityShards int
+}
+
+func (t *KcpTransport) Listen(address string) (net.Listener, error) {
+	listener, err := kcp.ListenWithOptions(address, nil, t.DataShards, t.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+	return &kcpListener{Listener: listener}, nil
+}
+
+// Dial resolves address within timeout, kcp has no handshake of its own, so the timeout then
+// holds as a deadline on the session until the peer answers, like the handshake of tcp and ws.
+func (t *KcpTransport) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	var ctx, cancel = context.Background(), context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+	defer cancel()
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	ips, err := net.DefaultResolver.LookupIPAddr(ctx, host)
+	if err != nil {
+		return nil, &net.OpError{Op: "dial", Net: KCP, Err: err}
+	}
+	sess, err := kcp.DialWithOptions(net.JoinHostPort(ips[0].IP.String(), port), nil, t.DataShards, t.ParityShards)
+	if err != nil {
+		return nil, err
+	}
+	tune(sess)
+	if timeout <= 0 {
+		return sess, nil
+	}
+	_ = sess.SetDeadline(time.Now().Add(timeout))
+	return &kcpConn{UDPSession: sess}, nil
+}
+
+// kcpConn clears the dial deadline on the first answer of the peer,
+// deadlines set by the user replace the dial deadline.
+type kcpConn struct {
+	*kcp.UDPSession
+	l                 sync.Mutex
+	answered          bool
+	readSet, writeSet bool
+}
+
+func (c *kcpConn) Read(b []byte) (int, error) {
+	n, err := c.UDPSession.Read(b)
+	if n > 0 {
+		c.answer()
+	}
+	return n, err
+}
+
+func (c *kcpConn) answer() {
+	c.l.Lock()
+	defer c.l.Unlock()
+	if c.answered {
+		return
+	}
+	c.answered = true
+	if !c.readSet {
+		_ = c.UDPSession.SetReadDeadline(time.Time{})
+	}
+	if !c.writeSet {
+		_ = c.UDPSession.SetWriteDeadline(time.Time{})
+	}
+}
+
+func (c *kcpConn) SetDeadline(t time.Time) error {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.readSet, c.writeSet = true, true
+	return c.UDPSession.SetDeadline(t)
+}
+
+func (c *kcpConn) SetReadDeadline(t time.Time) error {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.readSet = true
+	return c.UDPSession.SetReadDeadline(t)
+}
+
+func (c *kcpConn) SetWriteDeadline(t time.Time) error {
+	c.l.Lock()
+	defer c.l.Unlock()
+	c.writeSet = true
+	return c.UDPSession.SetWriteDeadline(t)
+}
+
+type kcpListener struct {
+	*kcp.Listener
+}
+
+func (l *kcpListener) Accept() (net.Conn, error) {
+	sess, err := l.AcceptKCP()
+	if err != nil {
+		return nil, err
+	}
+	tune(sess)
+	return sess, nil
+}
+
+func tune(sess *kcp.UDPSession) {
+	sess.SetStreamMode(true)
+	sess.SetWriteDelay(false)
+	sess.SetNoDelay(1, 10, 2, 1)
+	sess.SetWindowSize(1024, 1024)
+	sess.SetACKNoDelay(true)
+}
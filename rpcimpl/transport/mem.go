@@ -0,0 +1,32 @@
+package transport
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/akutz/memconn"
+)
+
+const (
+	MemU = "memu"
+	MemB = "memb"
+)
+
+// MemTransport ----------------------------------------------------------------------------------------------------
+
+// MemTransport in-process named connections of memconn, address is any unique name.
+// Network is memu (unbuffered, write waits for read) or memb (buffered).
+type MemTransport struct {
+	Network string
+}
+
+func (t MemTransport) Listen(address string) (net.Listener, error) {
+	return memconn.Listen(t.Network, address)
+}
+
+func (t MemTransport) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	var ctx, cancel = context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return memconn.DialContext(ctx, t.Network, address)
+}
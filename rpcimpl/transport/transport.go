@@ -0,0 +1,85 @@
+package transport
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Transport carry the frame stream, every transport gives a reliable ordered net.Conn.
+type Transport interface {
+	Listen(address string) (net.Listener, error)
+	Dial(address string, timeout time.Duration) (net.Conn, error)
+}
+
+const (
+	TCP = "tcp"
+	WS  = "ws"
+	KCP = "kcp"
+)
+
+var (
+	l          sync.RWMutex
+	transports = map[string]Transport{
+		TCP:  TcpTransport{},
+		WS:   &WsTransport{Path: WsPathDef}, // same origin only, see WsTransport for browsers of other origins
+		KCP:  &KcpTransport{DataShards: 10, ParityShards: 3},
+		MemU: MemTransport{Network: MemU},
+		MemB: MemTransport{Network: MemB},
+	}
+)
+
+// Reg registers transport as network, it replaces the one with same network.
+func Reg(network string, t Transport) {
+	l.Lock()
+	defer l.Unlock()
+	transports[network] = t
+}
+
+func Get(network string) Transport {
+	l.RLock()
+	defer l.RUnlock()
+	return transports[network]
+}
+
+// Listen listens with the transport registered as network, unknown network defers to net.Listen.
+func Listen(network, address string) (net.Listener, error) {
+	if t := Get(network); t != nil {
+		return t.Listen(address)
+	}
+	return net.Listen(network, address)
+}
+
+// Dial dials with the transport registered as network, unknown network defers to net.DialTimeout.
+func Dial(network, address string, timeout time.Duration) (net.Conn, error) {
+	if t := Get(network); t != nil {
+		return t.Dial(address, timeout)
+	}
+	return net.DialTimeout(network, address, timeout)
+}
+
+// TcpTransport ----------------------------------------------------------------------------------------------------
+type TcpTransport struct{}
+
+func (TcpTransport) Listen(address string) (net.Listener, error) {
+	return net.Listen("tcp", address)
+}
+
+func (TcpTransport) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	return net.DialTimeout("tcp", address, timeout)
+}
+
+// acceptErr is returned by Accept after the listener closed
+func acceptErr(network string, addr net.Addr) error {
+	return &net.OpError{Op: "accept", Net: network, Addr: addr, Err: fmt.Errorf("use of closed network connection")}
+}
+
+// IsClosed reports whether err means the connection is closed normally.
+func IsClosed(err error) bool {
+	return err == io.EOF || errors.Is(err, io.ErrClosedPipe) ||
+		strings.Contains(err.Error(), "use of closed network connection")
+}
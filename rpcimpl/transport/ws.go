@@ -0,0 +1,185 @@
+package transport
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"tiny_rpc/log"
+)
+
+const (
+	WsPathDef       = "/ws"
+	wsAcceptChanLen = 128
+)
+
+// WsTransport ----------------------------------------------------------------------------------------------------
+
+// WsTransport carry frames in binary websocket messages, address is host:port with optional path.
+// Browsers send an Origin header, the zero Upgrader only accepts the one same as the host.
+// To serve pages of other origins set AllowOrigins and Reg the transport as WS before Listen,
+// or set Upgrader.CheckOrigin which takes precedence.
+type WsTransport struct {
+	Path         string
+	AllowOrigins []string // hosts of origins accepted besides the same one, "*" accepts any
+	Upgrader     websocket.Upgrader
+}
+
+// checkOrigin accepts requests without Origin, of the same host, or of AllowOrigins.
+func (t *WsTransport) checkOrigin(r *http.Request) bool {
+	var origin = r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+	if strings.EqualFold(u.Host, r.Host) {
+		return true
+	}
+	for _, o := range t.AllowOrigins {
+		if o == "*" || strings.EqualFold(o, u.Host) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *WsTransport) split(address string) (string, string) {
+	if i := strings.Index(address, "/"); i >= 0 {
+		return address[:i], address[i:]
+	}
+	if t.Path == "" {
+		return address, WsPathDef
+	}
+	return address, t.Path
+}
+
+func (t *WsTransport) Listen(address string) (net.Listener, error) {
+	host, path := t.split(address)
+	ln, err := net.Listen("tcp", host)
+	if err != nil {
+		return nil, err
+	}
+
+	var l = &wsListener{
+		ln:     ln,
+		conns:  make(chan net.Conn, wsAcceptChanLen),
+		closed: make(chan struct{}),
+	}
+	var upgrader = t.Upgrader
+	if upgrader.CheckOrigin == nil {
+		upgrader.CheckOrigin = t.checkOrigin
+	}
+	var mux = http.NewServeMux()
+	mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+		c, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			log.Error("ws upgrade err %v", err)
+			return
+		}
+		select {
+		case l.conns <- &wsConn{Conn: c}:
+		case <-l.closed:
+			_ = c.Close()
+		}
+	})
+	l.srv = &http.Server{Handler: mux}
+	go func() {
+		if err := l.srv.Serve(ln); err != nil && err != http.ErrServerClosed {
+			log.Error("ws serve err %v", err)
+		}
+	}()
+	return l, nil
+}
+
+func (t *WsTransport) Dial(address string, timeout time.Duration) (net.Conn, error) {
+	host, path := t.split(address)
+	var dialer = websocket.Dialer{HandshakeTimeout: timeout}
+	c, _, err := dialer.Dial("ws://"+host+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &wsConn{Conn: c}, nil
+}
+
+type wsListener struct {
+	ln     net.Listener
+	srv    *http.Server
+	conns  chan net.Conn
+	once   sync.Once
+	closed chan struct{}
+}
+
+func (l *wsListener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case <-l.closed:
+		return nil, acceptErr(WS, l.Addr())
+	}
+}
+
+func (l *wsListener) Close() error {
+	var err error
+	l.once.Do(func() {
+		close(l.closed)
+		err = l.srv.Close()
+	})
+	return err
+}
+
+func (l *wsListener) Addr() net.Addr {
+	return l.ln.Addr()
+}
+
+// wsConn stream over websocket messages, each Write is one binary message.
+type wsConn struct {
+	*websocket.Conn
+	r io.Reader
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for {
+		if c.r == nil {
+			_, r, err := c.NextReader()
+			if err != nil {
+				if _, ok := err.(*websocket.CloseError); ok {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			c.r = r
+		}
+		n, err := c.r.Read(b)
+		if err == io.EOF {
+			c.r = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+func (c *wsConn) Write(b []byte) (int, error) {
+	if err := c.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
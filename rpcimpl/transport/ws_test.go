@@ -0,0 +1,56 @@
+package transport
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// dialOrigin dials the ws listener at address with the Origin header, it reports whether the upgrade succeeded.
+func dialOrigin(t *testing.T, address, origin string) bool {
+	t.Helper()
+	var dialer = websocket.Dialer{HandshakeTimeout: time.Second}
+	var h = http.Header{}
+	if origin != "" {
+		h.Set("Origin", origin)
+	}
+	c, rsp, err := dialer.Dial("ws://"+address+WsPathDef, h)
+	if err != nil {
+		if rsp == nil {
+			t.Fatalf("dial err %v", err)
+		}
+		return false
+	}
+	_ = c.Close()
+	return true
+}
+
+func TestWsOrigin(t *testing.T) {
+	var cases = []struct {
+		name    string
+		allow   []string
+		origins map[string]bool
+	}{
+		{"same only", nil, map[string]bool{"": true, "http://game.com": false}},
+		{"allow list", []string{"game.com"}, map[string]bool{"http://GAME.com": true, "http://other.com": false}},
+		{"any", []string{"*"}, map[string]bool{"http://other.com": true}},
+	}
+	for _, c := range cases {
+		ln, err := (&WsTransport{AllowOrigins: c.allow}).Listen("127.0.0.1:0")
+		if err != nil {
+			t.Fatalf("listen err %v", err)
+		}
+		var address = ln.Addr().String()
+		for origin, want := range c.origins {
+			if got := dialOrigin(t, address, origin); got != want {
+				t.Fatalf("%s origin %q accepted %v want %v", c.name, origin, got, want)
+			}
+		}
+		if got := dialOrigin(t, address, "http://"+address); !got {
+			t.Fatalf("%s same origin rejected", c.name)
+		}
+		_ = ln.Close()
+	}
+}